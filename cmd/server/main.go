@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
+	// The scratch image has no zoneinfo, subscriber timezones are loaded from the embedded copy.
+	_ "time/tzdata"
 
 	"fmt"
 
@@ -23,7 +26,6 @@ import (
 	"github.com/kievzenit/genesis-case/internal/config"
 	"github.com/kievzenit/genesis-case/internal/database"
 	"github.com/kievzenit/genesis-case/internal/jobs"
-	"github.com/kievzenit/genesis-case/internal/models"
 	"github.com/kievzenit/genesis-case/internal/services"
 )
 
@@ -38,9 +40,26 @@ func main() {
 		log.Fatalf("failed to create scheduler: %v", err)
 	}
 
-	weatherService := services.NewWeatherService(cfg.WeatherServiceConfig)
+	weatherService, err := services.NewWeatherService(cfg.WeatherServiceConfig)
+	if err != nil {
+		log.Fatalf("failed to create weather service: %v", err)
+	}
+	weatherService = services.NewCachedWeatherService(weatherService, cfg.WeatherCacheConfig)
+
+	authService, err := services.NewAuthService(cfg.AuthConfig)
+	if err != nil {
+		log.Fatalf("failed to create auth service: %v", err)
+	}
 
-	emailService := services.NewEmailService(cfg.BaseURL, cfg.EmailServiceConfig)
+	mailer, err := services.NewMailer(cfg.EmailServiceConfig)
+	if err != nil {
+		log.Fatalf("failed to create mailer: %v", err)
+	}
+	emailTemplates, err := services.NewEmailTemplates(cfg.EmailServiceConfig)
+	if err != nil {
+		log.Fatalf("failed to load email templates: %v", err)
+	}
+	emailService := services.NewEmailService(cfg.BaseURLScheme+"://"+cfg.BaseURL, cfg.EmailServiceConfig, mailer, emailTemplates, authService)
 
 	sqlCon, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		cfg.DatabaseConfig.Host,
@@ -81,9 +100,11 @@ func main() {
 	router := routes.RegisterRoutes(
 		weatherService,
 		emailService,
+		authService,
 		sqlCon,
 		txManager,
 		cfg.CORSConfig,
+		cfg.AuthConfig,
 	)
 
 	server := &http.Server{
@@ -93,39 +114,84 @@ func main() {
 		WriteTimeout: time.Duration(cfg.ServerConfig.WriteTimeout) * time.Second,
 	}
 
-	sendConfirmationEmailJob := jobs.NewSendConfirmationEmailJob(
+	sendEmailsJob := jobs.NewSendEmailsJob(
 		emailService,
-		txManager,
+		authService,
+		sqlCon,
+		cfg.JobsConfig.EmailMaxAttempts,
+		cfg.JobsConfig.EmailSendConcurrency,
 	)
 
+	// Login links are short lived, so the outbox is checked often.
 	_, err = scheduler.NewJob(
-		gocron.DurationJob(time.Duration(cfg.JobsConfig.EmailConfirmationInterval)*time.Minute),
-		gocron.NewTask(sendConfirmationEmailJob.Run),
+		gocron.DurationJob(time.Duration(cfg.JobsConfig.EmailOutboxInterval)*time.Second),
+		gocron.NewTask(sendEmailsJob.Run),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
 	)
 	if err != nil {
-		log.Fatalf("failed to create send confirmation email job: %v", err)
+		log.Fatalf("failed to create send emails job: %v", err)
 	}
 
 	sendWeatherReportJob := jobs.NewSendWeatherReportJob(
 		weatherService,
-		emailService,
 		sqlCon,
+		cfg.JobsConfig.ReportFetchConcurrency,
+	)
+
+	_, err = scheduler.NewJob(
+		gocron.CronJob("* * * * *", false),
+		gocron.NewTask(sendWeatherReportJob.Run),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		log.Fatalf("failed to create send weather report job: %v", err)
+	}
+
+	sendWeatherAlertJob := jobs.NewSendWeatherAlertJob(
+		weatherService,
+		sqlCon,
+		time.Duration(cfg.JobsConfig.AlertCooldown)*time.Minute,
+		cfg.JobsConfig.ReportFetchConcurrency,
 	)
 
 	_, err = scheduler.NewJob(
-		gocron.DurationJob(time.Duration(1)*time.Hour),
-		gocron.NewTask(sendWeatherReportJob.Run, models.Hourly),
+		gocron.DurationJob(time.Duration(cfg.JobsConfig.AlertCheckInterval)*time.Minute),
+		gocron.NewTask(sendWeatherAlertJob.Run),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
 	)
 	if err != nil {
-		log.Fatalf("failed to create send hourly weather report job: %v", err)
+		log.Fatalf("failed to create send weather alert job: %v", err)
 	}
 
+	deleteUnconfirmedSubscribersJob := jobs.NewDeleteUnconfirmedSubscribersJob(sqlCon)
+
 	_, err = scheduler.NewJob(
-		gocron.DailyJob(1, gocron.NewAtTimes(gocron.NewAtTime(12, 0, 0))),
-		gocron.NewTask(sendWeatherReportJob.Run, models.Daily),
+		gocron.DurationJob(time.Duration(cfg.JobsConfig.UnconfirmedCleanupInterval)*time.Minute),
+		gocron.NewTask(deleteUnconfirmedSubscribersJob.Run),
 	)
 	if err != nil {
-		log.Fatalf("failed to create send daily weather report job: %v", err)
+		log.Fatalf("failed to create delete unconfirmed subscribers job: %v", err)
+	}
+
+	resumeSubscriptionsJob := jobs.NewResumeSubscriptionsJob(sqlCon)
+
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(resumeSubscriptionsJob.Run),
+	)
+	if err != nil {
+		log.Fatalf("failed to create resume subscriptions job: %v", err)
+	}
+
+	if cfg.EmailServiceConfig.ReloadTemplates {
+		_, err = scheduler.NewJob(
+			gocron.DurationJob(time.Duration(cfg.EmailServiceConfig.TemplatesReloadInterval)*time.Second),
+			gocron.NewTask(emailTemplates.ReloadChanged),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			log.Fatalf("failed to create reload email templates job: %v", err)
+		}
 	}
 
 	go func() {
@@ -153,6 +219,13 @@ func main() {
 		log.Fatalf("failed to shutdown scheduler: %v", err)
 	}
 
+	// Mailers that keep connections open, like the smtp one, close them.
+	if closer, ok := mailer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("failed to close mailer: %v", err)
+		}
+	}
+
 	log.Println("server shut down gracefully")
 	log.Println("exiting")
 }
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+type accountPageSubscription struct {
+	Id        int
+	Token     string
+	City      string
+	Schedule  string
+	Confirmed bool
+	Paused    bool
+}
+
+// AccountPageHandler lists the subscriptions of the signed in subscriber,
+// without a session it asks for a login link instead.
+func AccountPageHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriberId, ok := parseSessionCookie(c, authService)
+		if !ok {
+			c.HTML(http.StatusUnauthorized, "account.html", gin.H{})
+			return
+		}
+
+		subscriber, err := repositories.NewSubscribersRepository(database).GetSubscriberByIdContext(ctx, subscriberId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.HTML(http.StatusUnauthorized, "account.html", gin.H{})
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		subscriptions, err := repositories.NewSubscriptionRepository(database).GetSubscriptionsBySubscriberContext(
+			ctx,
+			subscriber.Id,
+		)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		pageSubscriptions := make([]accountPageSubscription, 0, len(subscriptions))
+		for _, subscription := range subscriptions {
+			pageSubscriptions = append(pageSubscriptions, accountPageSubscription{
+				Id:        subscription.Id,
+				Token:     authService.ManageToken(subscription.Id),
+				City:      subscription.City,
+				Schedule:  subscription.DescribeSchedule(),
+				Confirmed: subscription.Confirmed,
+				Paused:    subscription.Paused,
+			})
+		}
+
+		c.HTML(http.StatusOK, "account.html", gin.H{
+			"SignedIn":      true,
+			"Email":         subscriber.Email,
+			"Subscriptions": pageSubscriptions,
+		})
+	}
+}
+
+func ListAccountSubscriptionsHandler(database database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptions, err := repositories.NewSubscriptionRepository(database).GetSubscriptionsBySubscriberContext(
+			ctx,
+			sessionSubscriberId(c),
+		)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		alertRulesRepository := repositories.NewAlertRulesRepository(database)
+		response := make([]gin.H, 0, len(subscriptions))
+		for _, subscription := range subscriptions {
+			alertRules, err := alertRulesRepository.GetAlertRulesBySubscriptionContext(ctx, subscription.Id)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			response = append(response, accountSubscriptionResponse(subscription, alertRules))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"subscriptions": response})
+	}
+}
+
+// UpdateAccountSubscriptionHandler accepts the same fields as PATCH /subscriptions/:token.
+func UpdateAccountSubscriptionHandler(
+	weatherService services.WeatherService,
+	database database.Database,
+	txManager *database.TransactionManger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscription, err := getAccountSubscription(ctx, c, database)
+		if err != nil {
+			c.AbortWithError(updateSubscriptionErrorStatus(err), err)
+			return
+		}
+
+		var patch subscriptionPatchData
+		err = c.BindJSON(&patch)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		subscription, alertRules, err := updateSubscription(
+			ctx,
+			weatherService,
+			database,
+			txManager,
+			subscription.Id,
+			patch,
+		)
+		if err != nil {
+			c.AbortWithError(updateSubscriptionErrorStatus(err), err)
+			return
+		}
+
+		c.JSON(http.StatusOK, accountSubscriptionResponse(subscription, alertRules))
+	}
+}
+
+func DeleteAccountSubscriptionHandler(database database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := deleteAccountSubscription(c, database)
+		if err != nil {
+			c.AbortWithError(updateSubscriptionErrorStatus(err), err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// SubmitDeleteAccountSubscriptionHandler deletes a subscription from
+// the account page, HTML forms cannot send DELETE requests.
+func SubmitDeleteAccountSubscriptionHandler(database database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := deleteAccountSubscription(c, database)
+		if err != nil {
+			c.AbortWithError(updateSubscriptionErrorStatus(err), err)
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, "/account")
+	}
+}
+
+func deleteAccountSubscription(c *gin.Context, database database.Database) error {
+	ctx := c.Request.Context()
+
+	subscription, err := getAccountSubscription(ctx, c, database)
+	if err != nil {
+		return err
+	}
+
+	return repositories.NewSubscriptionRepository(database).UnsubscribeContext(ctx, subscription.Id)
+}
+
+// getAccountSubscription returns the subscription with the id from the path,
+// subscriptions of other subscribers are reported as not found.
+func getAccountSubscription(
+	ctx context.Context,
+	c *gin.Context,
+	database database.Database,
+) (models.Subscription, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return models.Subscription{}, errInvalidSubscriptionUpdate
+	}
+
+	subscriptions, err := repositories.NewSubscriptionRepository(database).GetSubscriptionsBySubscriberContext(
+		ctx,
+		sessionSubscriberId(c),
+	)
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	for _, subscription := range subscriptions {
+		if subscription.Id == id {
+			return subscription, nil
+		}
+	}
+	return models.Subscription{}, sql.ErrNoRows
+}
+
+func accountSubscriptionResponse(subscription models.Subscription, alertRules []models.AlertRule) gin.H {
+	response := subscriptionResponse(subscription, alertRules)
+	response["id"] = subscription.Id
+	return response
+}
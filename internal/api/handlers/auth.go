@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+const (
+	sessionCookieName  = "wapp_session"
+	subscriberIdKey    = "subscriber_id"
+	loginLinkRateLimit = time.Hour
+)
+
+// RequestMagicLinkHandler stores a login link for the address and queues its
+// email in the outbox. The response is the same for unknown addresses and
+// rate limited requests, so it does not tell which addresses are subscribed.
+func RequestMagicLinkHandler(
+	database database.Database,
+	txManager *database.TransactionManger,
+	authService services.AuthService,
+	authConfig *config.AuthConfig,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var data struct {
+			Email string `json:"email"`
+		}
+		contentType := c.Request.Header.Get("Content-Type")
+		if contentType == "application/json" {
+			err := c.BindJSON(&data)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+		} else if contentType == "application/x-www-form-urlencoded" {
+			data.Email = c.PostForm("email")
+		} else {
+			c.AbortWithStatus(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		email := models.NormalizeEmail(data.Email)
+		if email == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		err := txManager.ExecuteTx(func(tx *sql.Tx) error {
+			subscribersRepository := repositories.NewSubscribersRepository(tx)
+			loginLinksRepository := repositories.NewLoginLinksRepository(tx)
+			emailOutboxRepository := repositories.NewEmailOutboxRepository(tx)
+
+			subscriber, err := subscribersRepository.GetSubscriberByEmailContext(ctx, email)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil
+				}
+				return err
+			}
+
+			now := time.Now().UTC()
+			count, err := loginLinksRepository.CountLoginLinksSinceContext(ctx, subscriber.Id, now.Add(-loginLinkRateLimit))
+			if err != nil {
+				return err
+			}
+			if count >= authConfig.LoginLinksPerHour {
+				log.Printf("login links for subscriber %d are rate limited", subscriber.Id)
+				return nil
+			}
+
+			loginLinkId, err := loginLinksRepository.StoreLoginLinkContext(ctx, models.LoginLink{
+				SubscriberId: subscriber.Id,
+				CreatedAt:    now,
+				ExpiresAt:    now.Add(authService.LoginLinkTTL()),
+			})
+			if err != nil {
+				return err
+			}
+
+			email, err := models.NewOutboxEmail(
+				models.LoginEmail,
+				subscriber.Email,
+				models.LoginEmailPayload{LoginLinkId: loginLinkId},
+			)
+			if err != nil {
+				return err
+			}
+			return emailOutboxRepository.EnqueueEmailContext(ctx, email)
+		})
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		if contentType == "application/x-www-form-urlencoded" {
+			c.HTML(http.StatusAccepted, "account.html", gin.H{
+				"Message": "If this address has subscriptions, we've sent it a sign in link.",
+			})
+			return
+		}
+		c.Status(http.StatusAccepted)
+	}
+}
+
+// LoginPageHandler asks to sign in with a login link. Links work once, so they
+// are used by the form of the page and not by link previews fetching them.
+func LoginPageHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, ok := parseSignedTokenParam(c, authService.ParseLoginToken)
+		if !ok {
+			return
+		}
+
+		c.HTML(http.StatusOK, "confirm_action.html", gin.H{
+			"Title":       "Sign in",
+			"Description": "Sign in to manage all subscriptions of your address.",
+			"Action":      c.Request.URL.RequestURI(),
+			"Button":      "Sign in",
+		})
+	}
+}
+
+// LoginHandler signs in with a login link and redirects to the account page.
+// Following the link proves the address, so it also confirms the subscriber.
+func LoginHandler(
+	txManager *database.TransactionManger,
+	authService services.AuthService,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		linkId, ok := parseSignedTokenParam(c, authService.ParseLoginToken)
+		if !ok {
+			return
+		}
+
+		var subscriberId int
+		err := txManager.ExecuteTx(func(tx *sql.Tx) error {
+			var err error
+			subscriberId, err = repositories.NewLoginLinksRepository(tx).UseLoginLinkContext(
+				ctx,
+				linkId,
+				time.Now().UTC(),
+			)
+			if err != nil {
+				return err
+			}
+
+			return repositories.NewSubscribersRepository(tx).ConfirmSubscriberByIdContext(ctx, subscriberId)
+		})
+		if err != nil {
+			if errors.Is(err, repositories.ErrLoginLinkNotFound) {
+				c.AbortWithStatus(http.StatusGone)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		expiresAt := time.Now().Add(authService.SessionTTL())
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(
+			sessionCookieName,
+			authService.SessionToken(subscriberId, expiresAt),
+			int(authService.SessionTTL().Seconds()),
+			"/",
+			"",
+			isSecureRequest(c),
+			true,
+		)
+		c.Redirect(http.StatusSeeOther, "/account")
+	}
+}
+
+func LogoutHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(sessionCookieName, "", -1, "/", "", isSecureRequest(c), true)
+		c.Redirect(http.StatusSeeOther, "/account")
+	}
+}
+
+// RequireSession rejects requests without a valid session cookie,
+// handlers after it get the subscriber id with sessionSubscriberId.
+func RequireSession(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriberId, ok := parseSessionCookie(c, authService)
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Set(subscriberIdKey, subscriberId)
+		c.Next()
+	}
+}
+
+func parseSessionCookie(c *gin.Context, authService services.AuthService) (int, bool) {
+	token, err := c.Cookie(sessionCookieName)
+	if err != nil {
+		return 0, false
+	}
+
+	subscriberId, err := authService.ParseSessionToken(token)
+	if err != nil {
+		return 0, false
+	}
+	return subscriberId, true
+}
+
+// isSecureRequest tells if the request came over https, directly or through
+// a proxy, so session cookies are only sent over https then.
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func sessionSubscriberId(c *gin.Context) int {
+	return c.GetInt(subscriberIdKey)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+)
+
+func TestLoginLinkWorksOnce(t *testing.T) {
+	fake, db := newFakeDatabase(t)
+	used := false
+	fake.on("UPDATE login_links SET used_at", func([]driver.Value) fakeResult {
+		if used {
+			return fakeResult{columns: []string{"subscriber_id"}}
+		}
+		used = true
+		return fakeResult{columns: []string{"subscriber_id"}, rows: [][]driver.Value{{int64(5)}}}
+	})
+	fake.on("UPDATE subscribers SET confirmed = true", affected(1))
+
+	authService := newTestAuthService(t)
+	r := newTestRouter()
+	r.GET("auth/login/:token", LoginPageHandler(authService))
+	r.POST("auth/login/:token", LoginHandler(database.NewTransactionManager(db), authService))
+	target := "/auth/login/" + authService.LoginToken(3, time.Now().Add(time.Minute))
+
+	// Link previews fetch the page, which does not use the link.
+	w := serve(r, http.MethodGet, target, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(fake.ran("login_links")) != 0 {
+		t.Fatal("expected the page not to use the link")
+	}
+
+	w = postForm(r, target, nil)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if !strings.Contains(w.Header().Get("Set-Cookie"), sessionCookieName+"=") {
+		t.Errorf("expected a session cookie, got %q", w.Header().Get("Set-Cookie"))
+	}
+	if confirmed := fake.ran("UPDATE subscribers SET confirmed = true"); len(confirmed) != 1 || confirmed[0].args[0] != 5 {
+		t.Errorf("expected subscriber 5 confirmed, got %v", confirmed)
+	}
+
+	w = postForm(r, target, nil)
+	if w.Code != http.StatusGone {
+		t.Errorf("expected %d for the used link, got %d", http.StatusGone, w.Code)
+	}
+	if w.Header().Get("Set-Cookie") != "" {
+		t.Error("expected no session for the used link")
+	}
+}
+
+func TestLoginLinkRejectsBadTokens(t *testing.T) {
+	_, db := newFakeDatabase(t)
+	authService := newTestAuthService(t)
+	r := newTestRouter()
+	r.POST("auth/login/:token", LoginHandler(database.NewTransactionManager(db), authService))
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "expired", token: authService.LoginToken(3, time.Now().Add(-time.Minute)), want: http.StatusGone},
+		{name: "session token", token: authService.SessionToken(3, time.Now().Add(time.Minute)), want: http.StatusBadRequest},
+		{name: "malformed", token: "3", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postForm(r, "/auth/login/"+tt.token, nil); w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// fakeDatabase answers the queries of handlers with scripted results. Tests
+// register responses for fragments of the query text, queries that match
+// no fragment fail the test.
+type fakeDatabase struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	responses []fakeResponse
+	queries   []fakeQuery
+}
+
+type fakeResponse struct {
+	fragment string
+	respond  func(args []driver.Value) fakeResult
+}
+
+// fakeQuery is a query the handler ran.
+type fakeQuery struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeResult holds the rows of a query, or the rows affected by a statement.
+type fakeResult struct {
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+}
+
+func newFakeDatabase(t *testing.T) (*fakeDatabase, *sql.DB) {
+	t.Helper()
+
+	fake := &fakeDatabase{t: t}
+	db := sql.OpenDB(fakeConnector{fake})
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+// on answers queries containing fragment, earlier registrations win.
+func (d *fakeDatabase) on(fragment string, respond func(args []driver.Value) fakeResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.responses = append(d.responses, fakeResponse{fragment: fragment, respond: respond})
+}
+
+// ran returns the queries containing fragment that were run.
+func (d *fakeDatabase) ran(fragment string) []fakeQuery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var queries []fakeQuery
+	for _, query := range d.queries {
+		if strings.Contains(query.query, fragment) {
+			queries = append(queries, query)
+		}
+	}
+	return queries
+}
+
+func (d *fakeDatabase) run(query string, args []driver.NamedValue) (fakeResult, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	d.mu.Lock()
+	d.queries = append(d.queries, fakeQuery{query: query, args: values})
+	var respond func(args []driver.Value) fakeResult
+	for _, response := range d.responses {
+		if strings.Contains(query, response.fragment) {
+			respond = response.respond
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	if respond == nil {
+		d.t.Errorf("unexpected query: %s", query)
+		return fakeResult{}, fmt.Errorf("unexpected query: %s", query)
+	}
+	result := respond(values)
+	return result, result.err
+}
+
+// rowsOf answers with the given rows.
+func rowsOf(columns []string, rows ...[]driver.Value) func([]driver.Value) fakeResult {
+	return func([]driver.Value) fakeResult {
+		return fakeResult{columns: columns, rows: rows}
+	}
+}
+
+// affected answers a statement that changed n rows.
+func affected(n int64) func([]driver.Value) fakeResult {
+	return func([]driver.Value) fakeResult {
+		return fakeResult{rowsAffected: n}
+	}
+}
+
+type fakeConnector struct {
+	db *fakeDatabase
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("use newFakeDatabase")
+}
+
+type fakeConn struct {
+	db *fakeDatabase
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{c.db, query}, nil
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.rowsAffected), nil
+}
+
+// CheckNamedValue passes arguments other than driver.Valuers as they are,
+// so tests see the values handlers passed, like models.Units.
+func (c fakeConn) CheckNamedValue(value *driver.NamedValue) error {
+	if valuer, ok := value.Value.(driver.Valuer); ok {
+		converted, err := valuer.Value()
+		value.Value = converted
+		return err
+	}
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDatabase
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeConn{s.db}.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeConn{s.db}.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var subscriberRowColumns = []string{"id", "email", "token", "confirmed", "confirmation_expires_at"}
+
+// subscriberRow returns the subscriber in the column order the
+// subscribers repository selects.
+func subscriberRow(subscriber models.Subscriber) []driver.Value {
+	var confirmationExpiresAt driver.Value
+	if subscriber.ConfirmationExpiresAt != nil {
+		confirmationExpiresAt = *subscriber.ConfirmationExpiresAt
+	}
+	return []driver.Value{
+		int64(subscriber.Id),
+		subscriber.Email,
+		subscriber.Token.String(),
+		subscriber.Confirmed,
+		confirmationExpiresAt,
+	}
+}
+
+var subscriptionRowColumns = []string{
+	"id", "subscriber_id", "confirmed", "email", "city",
+	"region", "country", "latitude", "longitude", "frequency", "units", "timezone",
+	"delivery_time", "delivery_weekday", "cron_expression",
+	"quiet_hours_start", "quiet_hours_end", "overnight_summary", "next_report_at",
+	"paused", "resume_at",
+}
+
+// subscriptionRow returns the subscription in the column order the
+// subscription repository selects, with a location and without a schedule.
+func subscriptionRow(subscription models.Subscription) []driver.Value {
+	var nextReportAt, resumeAt driver.Value
+	if subscription.NextReportAt != nil {
+		nextReportAt = *subscription.NextReportAt
+	}
+	if subscription.ResumeAt != nil {
+		resumeAt = *subscription.ResumeAt
+	}
+
+	return []driver.Value{
+		int64(subscription.Id), int64(subscription.SubscriberId), subscription.Confirmed, subscription.Email,
+		subscription.City, "Kyiv City", "Ukraine", 50.45, 30.52,
+		string(subscription.Frequency), string(subscription.Units), subscription.Timezone,
+		nil, nil, nil,
+		nil, nil, false, nextReportAt,
+		subscription.Paused, resumeAt,
+	}
+}
+
+// alertRuleRows answers with the rules, given in the metric:operator:threshold
+// form, in the column order the alert rules repository selects.
+func alertRuleRows(t *testing.T, subscriptionId int, rules ...string) func([]driver.Value) fakeResult {
+	t.Helper()
+
+	rows := make([][]driver.Value, 0, len(rules))
+	for i, rule := range rules {
+		alertRule, err := models.ParseAlertRule(rule)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows = append(rows, []driver.Value{
+			int64(i + 1),
+			int64(subscriptionId),
+			string(alertRule.Metric),
+			string(alertRule.Operator),
+			alertRule.Threshold,
+		})
+	}
+	return rowsOf([]string{"id", "subscription_id", "metric", "operator", "threshold"}, rows...)
+}
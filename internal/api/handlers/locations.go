@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+func SearchLocationsHandler(weatherService services.WeatherService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := strings.TrimSpace(c.Query("q"))
+		if query == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		locations, err := weatherService.SearchLocations(c.Request.Context(), query)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		results := make([]gin.H, 0, len(locations))
+		for _, location := range locations {
+			results = append(results, gin.H{
+				"name":      location.Name,
+				"region":    location.Region,
+				"country":   location.Country,
+				"latitude":  location.Latitude,
+				"longitude": location.Longitude,
+				"timezone":  location.Timezone,
+			})
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSearchLocations(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		want       []map[string]any
+	}{
+		{name: "missing query", target: "/locations/search", wantStatus: http.StatusBadRequest},
+		{name: "blank query", target: "/locations/search?q=%20%20", wantStatus: http.StatusBadRequest},
+		{
+			name:       "found",
+			target:     "/locations/search?q=kyiv",
+			wantStatus: http.StatusOK,
+			want: []map[string]any{{
+				"name":      kyiv.Name,
+				"region":    kyiv.Region,
+				"country":   kyiv.Country,
+				"latitude":  kyiv.Latitude,
+				"longitude": kyiv.Longitude,
+				"timezone":  kyiv.Timezone,
+			}},
+		},
+		{name: "not found", target: "/locations/search?q=atlantis", wantStatus: http.StatusOK, want: []map[string]any{}},
+	}
+
+	r := newTestRouter()
+	r.GET("locations/search", SearchLocationsHandler(newTestWeatherService()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, tt.target, "", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got []map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
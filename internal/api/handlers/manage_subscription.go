@@ -0,0 +1,586 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+// subscriptionPatchData holds the fields of PATCH /subscriptions/:token,
+// fields that are not set are left unchanged.
+type subscriptionPatchData struct {
+	City             *string          `json:"city"`
+	Frequency        *string          `json:"frequency"`
+	Units            *string          `json:"units"`
+	Timezone         *string          `json:"timezone"`
+	DeliveryTime     *string          `json:"delivery_time"`
+	Weekday          *string          `json:"weekday"`
+	CronExpression   *string          `json:"cron"`
+	QuietHoursStart  *string          `json:"quiet_hours_start"`
+	QuietHoursEnd    *string          `json:"quiet_hours_end"`
+	OvernightSummary *bool            `json:"overnight_summary"`
+	Alerts           *[]alertRuleData `json:"alerts"`
+}
+
+var (
+	errInvalidSubscriptionUpdate = errors.New("invalid subscription update")
+	errAlreadySubscribed         = errors.New("already subscribed to this location")
+)
+
+func GetSubscriptionHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		subscription, alertRules, err := getSubscription(ctx, database, subscriptionId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, subscriptionResponse(subscription, alertRules))
+	}
+}
+
+func UpdateSubscriptionHandler(
+	weatherService services.WeatherService,
+	authService services.AuthService,
+	database database.Database,
+	txManager *database.TransactionManger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		var patch subscriptionPatchData
+		err := c.BindJSON(&patch)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		subscription, alertRules, err := updateSubscription(
+			ctx,
+			weatherService,
+			database,
+			txManager,
+			subscriptionId,
+			patch,
+		)
+		if err != nil {
+			c.AbortWithError(updateSubscriptionErrorStatus(err), err)
+			return
+		}
+
+		c.JSON(http.StatusOK, subscriptionResponse(subscription, alertRules))
+	}
+}
+
+// ManageSubscriptionPageHandler renders the page linked from emails,
+// its form is submitted to SubmitManageSubscriptionPageHandler.
+func ManageSubscriptionPageHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		subscription, alertRules, err := getSubscription(ctx, database, subscriptionId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		c.HTML(http.StatusOK, "manage_subscription.html", managePageData(
+			authService,
+			subscription,
+			alertRules,
+			"",
+			"",
+		))
+	}
+}
+
+// SubmitManageSubscriptionPageHandler applies the form of the manage page,
+// HTML forms cannot send PATCH requests, so every field is submitted at once.
+func SubmitManageSubscriptionPageHandler(
+	weatherService services.WeatherService,
+	authService services.AuthService,
+	database database.Database,
+	txManager *database.TransactionManger,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		var subscription models.Subscription
+		var alertRules []models.AlertRule
+		patch, err := managePageFormPatch(c)
+		if err == nil {
+			subscription, alertRules, err = updateSubscription(
+				ctx,
+				weatherService,
+				database,
+				txManager,
+				subscriptionId,
+				patch,
+			)
+		}
+		if err == nil {
+			c.HTML(
+				http.StatusOK,
+				"manage_subscription.html",
+				managePageData(authService, subscription, alertRules, "Your subscription was updated.", ""),
+			)
+			return
+		}
+
+		status := updateSubscriptionErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			c.AbortWithError(status, err)
+			return
+		}
+
+		subscription, alertRules, getErr := getSubscription(ctx, database, subscriptionId)
+		if getErr != nil {
+			if errors.Is(getErr, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, getErr)
+			return
+		}
+
+		c.HTML(status, "manage_subscription.html", managePageData(
+			authService,
+			subscription,
+			alertRules,
+			"",
+			updateSubscriptionErrorMessage(err),
+		))
+	}
+}
+
+// parseSignedTokenParam verifies the token in the path with parse, which also
+// checks its purpose. It aborts with 400 for invalid tokens and 410 for expired ones.
+func parseSignedTokenParam[T any](c *gin.Context, parse func(token string) (T, error)) (T, bool) {
+	value, err := parse(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrTokenExpired) {
+			c.AbortWithStatus(http.StatusGone)
+		} else {
+			c.AbortWithStatus(http.StatusBadRequest)
+		}
+
+		var zero T
+		return zero, false
+	}
+	return value, true
+}
+
+func getSubscription(
+	ctx context.Context,
+	database database.Database,
+	subscriptionId int,
+) (models.Subscription, []models.AlertRule, error) {
+	subscription, err := repositories.NewSubscriptionRepository(database).GetSubscriptionByIdContext(ctx, subscriptionId)
+	if err != nil {
+		return models.Subscription{}, nil, err
+	}
+
+	alertRules, err := repositories.NewAlertRulesRepository(database).GetAlertRulesBySubscriptionContext(
+		ctx,
+		subscription.Id,
+	)
+	if err != nil {
+		return models.Subscription{}, nil, err
+	}
+	return subscription, alertRules, nil
+}
+
+// updateSubscription applies patch on top of the stored subscription and
+// validates the result like a new subscription. Changing the city moves the
+// subscription to the city's timezone, unless patch sets the timezone too.
+// Changing the units converts the thresholds of the stored alert rules, also
+// when patch repeats them unchanged, as the manage page form does.
+func updateSubscription(
+	ctx context.Context,
+	weatherService services.WeatherService,
+	database database.Database,
+	txManager *database.TransactionManger,
+	subscriptionId int,
+	patch subscriptionPatchData,
+) (models.Subscription, []models.AlertRule, error) {
+	subscription, alertRules, err := getSubscription(ctx, database, subscriptionId)
+	if err != nil {
+		return models.Subscription{}, nil, err
+	}
+	storedAlertRules := alertRules
+
+	data := subscriptionDataFrom(subscription)
+	if patch.Frequency != nil && *patch.Frequency != data.Frequency {
+		// Schedule fields and rules of the previous frequency do not apply to the new one.
+		data.Frequency = *patch.Frequency
+		data.DeliveryTime, data.Weekday, data.CronExpression = "", "", ""
+		data.QuietHoursStart, data.QuietHoursEnd, data.OvernightSummary = "", "", false
+		alertRules = nil
+	}
+	setIfPresent(&data.Units, patch.Units)
+	setIfPresent(&data.DeliveryTime, patch.DeliveryTime)
+	setIfPresent(&data.Weekday, patch.Weekday)
+	setIfPresent(&data.CronExpression, patch.CronExpression)
+	setIfPresent(&data.QuietHoursStart, patch.QuietHoursStart)
+	setIfPresent(&data.QuietHoursEnd, patch.QuietHoursEnd)
+	setIfPresent(&data.OvernightSummary, patch.OvernightSummary)
+	if patch.Alerts != nil {
+		alertRules = toAlertRules(*patch.Alerts)
+	}
+
+	updated := subscription
+	updated.Frequency = models.Frequency(data.Frequency)
+	updated.Units = models.Units(data.Units)
+	updated.DeliveryTime, updated.Weekday, updated.CronExpression = models.TimeOfDay{}, 0, ""
+	updated.QuietHours, updated.OvernightSummary, updated.NextReportAt = nil, false, nil
+	if !updated.Frequency.IsValid() || !updated.Units.IsValid() || !applyScheduleData(&updated, data) {
+		return models.Subscription{}, nil, errInvalidSubscriptionUpdate
+	}
+	if (updated.Frequency == models.Alert) != (len(alertRules) > 0) {
+		return models.Subscription{}, nil, errInvalidSubscriptionUpdate
+	}
+	for _, alertRule := range alertRules {
+		if !alertRule.IsValid() {
+			return models.Subscription{}, nil, errInvalidSubscriptionUpdate
+		}
+	}
+	if updated.Units != subscription.Units && sameAlertRules(alertRules, storedAlertRules) {
+		converted := make([]models.AlertRule, 0, len(alertRules))
+		for _, alertRule := range alertRules {
+			converted = append(converted, alertRule.ConvertUnits(subscription.Units, updated.Units))
+		}
+		alertRules = converted
+	}
+
+	// An empty timezone resets it to the city's one.
+	resetTimezone := patch.Timezone != nil && *patch.Timezone == ""
+	if patch.Timezone != nil && *patch.Timezone != "" {
+		_, err := models.LoadTimezone(*patch.Timezone)
+		if err != nil {
+			return models.Subscription{}, nil, err
+		}
+		updated.Timezone = *patch.Timezone
+	}
+
+	cityChanged := patch.City != nil && !strings.EqualFold(strings.TrimSpace(*patch.City), subscription.City)
+	// Subscriptions created before cities were resolved get their location now.
+	if cityChanged || subscription.Location == nil {
+		city := subscription.City
+		if cityChanged {
+			city = *patch.City
+		}
+
+		location, err := services.ResolveLocation(ctx, weatherService, city)
+		if err != nil {
+			return models.Subscription{}, nil, err
+		}
+
+		exists, err := repositories.NewSubscribersRepository(database).IsUserSubscribedElsewhereContext(
+			ctx,
+			subscription.Email,
+			location,
+			subscription.Id,
+		)
+		if err != nil {
+			return models.Subscription{}, nil, err
+		}
+		if exists {
+			return models.Subscription{}, nil, errAlreadySubscribed
+		}
+
+		updated.City = location.Name
+		updated.Location = &location
+		if cityChanged && patch.Timezone == nil {
+			resetTimezone = true
+		}
+	}
+
+	if resetTimezone {
+		updated.Timezone = "UTC"
+		timezone, err := weatherService.GetTimezone(ctx, services.LocationCoordinatesQuery(*updated.Location))
+		if err == nil {
+			if _, err := models.LoadTimezone(timezone); err == nil {
+				updated.Timezone = timezone
+			}
+		}
+	}
+
+	if updated.Frequency != models.Alert {
+		nextReportAt, err := updated.NextReportTime(time.Now())
+		if err != nil {
+			return models.Subscription{}, nil, err
+		}
+		updated.NextReportAt = &nextReportAt
+	}
+
+	err = txManager.ExecuteTx(func(tx *sql.Tx) error {
+		subscriptionRepository := repositories.NewSubscriptionRepository(tx)
+		alertRulesRepository := repositories.NewAlertRulesRepository(tx)
+
+		err := subscriptionRepository.UpdateSubscriptionContext(ctx, updated)
+		if err != nil {
+			return err
+		}
+
+		err = alertRulesRepository.DeleteAlertRulesBySubscriptionContext(ctx, updated.Id)
+		if err != nil {
+			return err
+		}
+		return alertRulesRepository.StoreAlertRulesContext(ctx, updated.Id, alertRules)
+	})
+	if err != nil {
+		return models.Subscription{}, nil, err
+	}
+
+	return updated, alertRules, nil
+}
+
+// sameAlertRules compares the conditions of the rules, not their ids.
+func sameAlertRules(a []models.AlertRule, b []models.AlertRule) bool {
+	return slices.EqualFunc(a, b, func(x models.AlertRule, y models.AlertRule) bool {
+		return x.Metric == y.Metric && x.Operator == y.Operator && x.Threshold == y.Threshold
+	})
+}
+
+func setIfPresent[T any](field *T, value *T) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func updateSubscriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, services.ErrCityNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAlreadySubscribed):
+		return http.StatusConflict
+	case errors.Is(err, errInvalidSubscriptionUpdate),
+		errors.Is(err, models.ErrInvalidTimezone),
+		errors.Is(err, models.ErrInvalidCronExpression),
+		errors.Is(err, models.ErrInvalidTimeOfDay),
+		errors.Is(err, models.ErrInvalidWeekday):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func updateSubscriptionErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrCityNotFound):
+		return "We could not find this city."
+	case errors.Is(err, errAlreadySubscribed):
+		return "You are already subscribed to this city."
+	default:
+		return "Please check the values you entered, some of them are not valid for the chosen frequency."
+	}
+}
+
+// subscriptionDataFrom returns the fields of the subscription
+// in the form they are accepted by the API.
+func subscriptionDataFrom(subscription models.Subscription) subscriptionData {
+	data := subscriptionData{
+		Email:     subscription.Email,
+		City:      subscription.City,
+		Frequency: string(subscription.Frequency),
+		Units:     string(subscription.Units),
+		Timezone:  subscription.Timezone,
+	}
+
+	switch subscription.Frequency {
+	case models.Daily:
+		data.DeliveryTime = subscription.DeliveryTime.String()
+	case models.Weekly:
+		data.DeliveryTime = subscription.DeliveryTime.String()
+		data.Weekday = strings.ToLower(subscription.Weekday.String())
+	case models.Custom:
+		data.CronExpression = subscription.CronExpression
+	}
+
+	if subscription.QuietHours != nil {
+		data.QuietHoursStart = subscription.QuietHours.Start.String()
+		data.QuietHoursEnd = subscription.QuietHours.End.String()
+		data.OvernightSummary = subscription.OvernightSummary
+	}
+
+	return data
+}
+
+func subscriptionResponse(subscription models.Subscription, alertRules []models.AlertRule) gin.H {
+	data := subscriptionDataFrom(subscription)
+
+	alerts := make([]gin.H, 0, len(alertRules))
+	for _, alertRule := range alertRules {
+		alerts = append(alerts, gin.H{
+			"metric":    alertRule.Metric,
+			"operator":  alertRule.Operator,
+			"threshold": alertRule.Threshold,
+		})
+	}
+
+	response := gin.H{
+		"email":             data.Email,
+		"city":              data.City,
+		"confirmed":         subscription.Confirmed,
+		"frequency":         data.Frequency,
+		"schedule":          subscription.DescribeSchedule(),
+		"units":             data.Units,
+		"timezone":          data.Timezone,
+		"delivery_time":     data.DeliveryTime,
+		"weekday":           data.Weekday,
+		"cron":              data.CronExpression,
+		"quiet_hours_start": data.QuietHoursStart,
+		"quiet_hours_end":   data.QuietHoursEnd,
+		"overnight_summary": data.OvernightSummary,
+		"alerts":            alerts,
+		"next_report_at":    subscription.NextReportAt,
+		"paused":            subscription.Paused,
+		"resume_at":         subscription.ResumeAt,
+	}
+	if subscription.Location != nil {
+		response["region"] = subscription.Location.Region
+		response["country"] = subscription.Location.Country
+	}
+	return response
+}
+
+// managePageFormPatch reads the manage page form, alert rules are entered
+// one per line in the metric:operator:threshold form. The form shows the fields
+// of every frequency, the ones the chosen frequency does not use are ignored.
+func managePageFormPatch(c *gin.Context) (subscriptionPatchData, error) {
+	frequency := models.Frequency(strings.TrimSpace(c.PostForm("frequency")))
+	formValue := func(name string, frequencies ...models.Frequency) *string {
+		value := strings.TrimSpace(c.PostForm(name))
+		if len(frequencies) > 0 && !slices.Contains(frequencies, frequency) {
+			value = ""
+		}
+		return &value
+	}
+
+	patch := subscriptionPatchData{
+		City:            formValue("city"),
+		Frequency:       formValue("frequency"),
+		Units:           formValue("units"),
+		Timezone:        formValue("timezone"),
+		DeliveryTime:    formValue("delivery_time", models.Daily, models.Weekly),
+		Weekday:         formValue("weekday", models.Weekly),
+		CronExpression:  formValue("cron", models.Custom),
+		QuietHoursStart: formValue("quiet_hours_start", models.Hourly),
+		QuietHoursEnd:   formValue("quiet_hours_end", models.Hourly),
+	}
+
+	overnightSummary := *formValue("overnight_summary", models.Hourly) != ""
+	patch.OvernightSummary = &overnightSummary
+
+	alerts := []alertRuleData{}
+	for _, line := range strings.Split(*formValue("alerts", models.Alert), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		alertRule, err := models.ParseAlertRule(line)
+		if err != nil {
+			return subscriptionPatchData{}, fmt.Errorf("%w: %v", errInvalidSubscriptionUpdate, err)
+		}
+		alerts = append(alerts, alertRuleData{
+			Metric:    string(alertRule.Metric),
+			Operator:  string(alertRule.Operator),
+			Threshold: alertRule.Threshold,
+		})
+	}
+	patch.Alerts = &alerts
+
+	return patch, nil
+}
+
+// managePageData signs new links for the page, so they stay valid
+// for the full email link TTL.
+func managePageData(
+	authService services.AuthService,
+	subscription models.Subscription,
+	alertRules []models.AlertRule,
+	message string,
+	errorMessage string,
+) gin.H {
+	alerts := make([]string, 0, len(alertRules))
+	for _, alertRule := range alertRules {
+		alerts = append(alerts, fmt.Sprintf(
+			"%s:%s:%s",
+			alertRule.Metric,
+			alertRule.Operator,
+			strconv.FormatFloat(alertRule.Threshold, 'f', -1, 64),
+		))
+	}
+
+	return gin.H{
+		"Token":            authService.ManageToken(subscription.Id),
+		"UnsubscribeToken": authService.UnsubscribeToken(subscription.Id),
+		"Subscription":     subscriptionDataFrom(subscription),
+		"Schedule":         subscription.DescribeSchedule(),
+		"Confirmed":        subscription.Confirmed,
+		"Paused":           subscription.Paused,
+		"ResumeAt":         formatResumeAt(subscription),
+		"Alerts":           strings.Join(alerts, "\n"),
+		"Frequencies": []models.Frequency{
+			models.Hourly,
+			models.Daily,
+			models.Weekly,
+			models.Custom,
+			models.Alert,
+		},
+		"Units":    []models.Units{models.Metric, models.Imperial},
+		"Weekdays": []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"},
+		"Message":  message,
+		"Error":    errorMessage,
+	}
+}
+
+func formatResumeAt(subscription models.Subscription) string {
+	if subscription.ResumeAt == nil {
+		return ""
+	}
+	return subscription.ResumeAt.In(subscription.TimeLocation()).Format("January 2, 2006 15:04 MST")
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+func TestUpdateSubscriptionUnitsConvertsAlertRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		json           string
+		form           url.Values
+		wantThresholds []float64
+	}{
+		{
+			name:           "patch of the units",
+			json:           `{"units": "imperial"}`,
+			wantThresholds: []float64{32, 24.85, 60},
+		},
+		{
+			// The form submits the stored rules with every change.
+			name: "form with the stored rules",
+			form: url.Values{
+				"city":      {"Kyiv"},
+				"frequency": {"alert"},
+				"units":     {"imperial"},
+				"timezone":  {"Europe/Kyiv"},
+				"alerts":    {"temperature:below:0\nwind_speed:above:40\nprecipitation:above:60"},
+			},
+			wantThresholds: []float64{32, 24.85, 60},
+		},
+		{
+			name:           "patch with new rules",
+			json:           `{"units": "imperial", "alerts": [{"metric": "temperature", "operator": "below", "threshold": 20}]}`,
+			wantThresholds: []float64{20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDatabase(t)
+			subscription := models.Subscription{
+				Id:           4,
+				SubscriberId: 2,
+				Confirmed:    true,
+				Email:        "user@example.com",
+				City:         "Kyiv",
+				Frequency:    models.Alert,
+				Units:        models.Metric,
+				Timezone:     "Europe/Kyiv",
+			}
+			fake.on("WHERE s.id = $1", rowsOf(subscriptionRowColumns, subscriptionRow(subscription)))
+			fake.on("FROM subscription_alert_rules", alertRuleRows(
+				t,
+				subscription.Id,
+				"temperature:below:0",
+				"wind_speed:above:40",
+				"precipitation:above:60",
+			))
+			fake.on("UPDATE user_subscriptions SET", affected(1))
+			fake.on("DELETE FROM subscription_alert_rules", affected(3))
+			fake.on("INSERT INTO subscription_alert_rules", affected(1))
+
+			authService := newTestAuthService(t)
+			txManager := database.NewTransactionManager(db)
+			r := newTestRouter()
+			r.PATCH("subscriptions/:token", UpdateSubscriptionHandler(nil, authService, db, txManager))
+			r.POST("subscriptions/:token/manage", SubmitManageSubscriptionPageHandler(nil, authService, db, txManager))
+
+			target := "/subscriptions/" + authService.ManageToken(subscription.Id)
+			if tt.form != nil {
+				w := postForm(r, target+"/manage", tt.form)
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+				}
+			} else {
+				w := serve(r, http.MethodPatch, target, tt.json, "application/json")
+				if w.Code != http.StatusOK {
+					t.Fatalf("expected %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+				}
+			}
+
+			if updates := fake.ran("UPDATE user_subscriptions SET"); len(updates) != 1 || updates[0].args[6] != models.Imperial {
+				t.Errorf("expected the subscription updated to imperial units, got %v", updates)
+			}
+			inserts := fake.ran("INSERT INTO subscription_alert_rules")
+			if len(inserts) != len(tt.wantThresholds) {
+				t.Fatalf("expected %d rules stored, got %d", len(tt.wantThresholds), len(inserts))
+			}
+			for i, insert := range inserts {
+				if threshold := insert.args[3]; threshold != tt.wantThresholds[i] {
+					t.Errorf("expected threshold %v, got %v", tt.wantThresholds[i], threshold)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+	"github.com/kievzenit/genesis-case/templates"
+)
+
+// newTestRouter returns an engine with the pages of the app,
+// tests register the handlers they need on it.
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetHTMLTemplate(template.Must(template.ParseFS(templates.FS, "pages/*.html")))
+	return r
+}
+
+func newTestAuthService(t *testing.T) services.AuthService {
+	t.Helper()
+
+	authService, err := services.NewAuthService(&config.AuthConfig{
+		Secret:       "secret",
+		LoginLinkTTL: 15,
+		SessionTTL:   60,
+		EmailLinkTTL: 60,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return authService
+}
+
+func serve(r *gin.Engine, method string, target string, body string, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func postForm(r *gin.Engine, target string, form url.Values) *httptest.ResponseRecorder {
+	return serve(r, http.MethodPost, target, form.Encode(), "application/x-www-form-urlencoded")
+}
+
+// fakeWeatherService finds the locations registered for a search text,
+// other texts find nothing.
+type fakeWeatherService struct {
+	services.WeatherService
+	locations map[string][]models.Location
+	timezone  string
+}
+
+func (s *fakeWeatherService) SearchLocations(_ context.Context, text string) ([]models.Location, error) {
+	return s.locations[strings.ToLower(text)], nil
+}
+
+func (s *fakeWeatherService) GetTimezone(context.Context, services.LocationQuery) (string, error) {
+	return s.timezone, nil
+}
+
+var kyiv = models.Location{
+	Name:      "Kyiv",
+	Region:    "Kyiv City",
+	Country:   "Ukraine",
+	Latitude:  50.45,
+	Longitude: 30.52,
+	Timezone:  "Europe/Kyiv",
+}
+
+func newTestWeatherService() *fakeWeatherService {
+	return &fakeWeatherService{locations: map[string][]models.Location{"kyiv": {kyiv}}}
+}
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/config"
 	"github.com/kievzenit/genesis-case/internal/database"
 	"github.com/kievzenit/genesis-case/internal/database/repositories"
 	"github.com/kievzenit/genesis-case/internal/models"
@@ -14,9 +20,24 @@ import (
 )
 
 type subscriptionData struct {
-	Email     string `json:"email" form:"email"`
-	City      string `json:"city" form:"city"`
-	Frequency string `json:"frequency" form:"frequency"`
+	Email            string          `json:"email" form:"email"`
+	City             string          `json:"city" form:"city"`
+	Frequency        string          `json:"frequency" form:"frequency"`
+	Units            string          `json:"units" form:"units"`
+	DeliveryTime     string          `json:"delivery_time" form:"delivery_time"`
+	Weekday          string          `json:"weekday" form:"weekday"`
+	CronExpression   string          `json:"cron" form:"cron"`
+	Timezone         string          `json:"timezone" form:"timezone"`
+	QuietHoursStart  string          `json:"quiet_hours_start" form:"quiet_hours_start"`
+	QuietHoursEnd    string          `json:"quiet_hours_end" form:"quiet_hours_end"`
+	OvernightSummary bool            `json:"overnight_summary" form:"overnight_summary"`
+	Alerts           []alertRuleData `json:"alerts"`
+}
+
+type alertRuleData struct {
+	Metric    string  `json:"metric"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
 }
 
 func SubscribeForWeatherHandler(
@@ -24,11 +45,13 @@ func SubscribeForWeatherHandler(
 	emailService services.EmailService,
 	database database.Database,
 	txManager *database.TransactionManger,
+	authConfig *config.AuthConfig,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
 		var data subscriptionData
+		var alertRules []models.AlertRule
 
 		// In swagger specification was defined that this endpoint should accept both
 		// application/json and application/x-www-form-urlencoded content types.
@@ -41,15 +64,42 @@ func SubscribeForWeatherHandler(
 				c.AbortWithError(http.StatusBadRequest, err)
 				return
 			}
+
+			alertRules = toAlertRules(data.Alerts)
 		} else if contentType == "application/x-www-form-urlencoded" {
 			data.Email = c.PostForm("email")
 			data.City = c.PostForm("city")
 			data.Frequency = c.PostForm("frequency")
+			data.Units = c.PostForm("units")
+			data.DeliveryTime = c.PostForm("delivery_time")
+			data.Weekday = c.PostForm("weekday")
+			data.CronExpression = c.PostForm("cron")
+			data.Timezone = c.PostForm("timezone")
+			data.QuietHoursStart = c.PostForm("quiet_hours_start")
+			data.QuietHoursEnd = c.PostForm("quiet_hours_end")
+			if overnightSummary := c.PostForm("overnight_summary"); overnightSummary != "" {
+				var err error
+				data.OvernightSummary, err = strconv.ParseBool(overnightSummary)
+				if err != nil {
+					c.AbortWithError(http.StatusBadRequest, err)
+					return
+				}
+			}
+
+			for _, alert := range c.PostFormArray("alerts") {
+				alertRule, err := models.ParseAlertRule(alert)
+				if err != nil {
+					c.AbortWithError(http.StatusBadRequest, err)
+					return
+				}
+				alertRules = append(alertRules, alertRule)
+			}
 		} else {
 			c.AbortWithStatus(http.StatusUnsupportedMediaType)
 			return
 		}
 
+		data.Email = models.NormalizeEmail(data.Email)
 		if data.Email == "" {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
@@ -71,97 +121,674 @@ func SubscribeForWeatherHandler(
 			return
 		}
 
-		subscriptionRepository := repositories.NewSubscriptionRepository(database)
-		exists, err := subscriptionRepository.IsUserSubscribedContext(ctx, data.Email, data.City)
+		// Alert subscriptions are useless without rules,
+		// and rules are never evaluated for scheduled subscriptions.
+		if (frequency == models.Alert) != (len(alertRules) > 0) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		for _, alertRule := range alertRules {
+			if !alertRule.IsValid() {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+		}
+
+		units := models.Metric
+		if data.Units != "" {
+			units = models.Units(data.Units)
+			if !units.IsValid() {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+		}
+
+		subscription := models.Subscription{
+			Email:     data.Email,
+			Frequency: frequency,
+			Units:     units,
+		}
+		if !applyScheduleData(&subscription, data) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if data.Timezone != "" {
+			_, err := models.LoadTimezone(data.Timezone)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		location, err := services.ResolveLocation(ctx, weatherService, data.City)
 		if err != nil {
+			if errors.Is(err, services.ErrCityNotFound) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
-		if exists {
-			c.AbortWithStatus(http.StatusConflict)
-			return
+
+		// The city's timezone is the default, a timezone the provider reported
+		// but Go does not know is treated as unknown.
+		subscription.Timezone = data.Timezone
+		if subscription.Timezone == "" {
+			subscription.Timezone = "UTC"
+			if _, err := models.LoadTimezone(location.Timezone); err == nil {
+				subscription.Timezone = location.Timezone
+			}
+		}
+
+		if frequency != models.Alert {
+			nextReportAt, err := subscription.NextReportTime(time.Now())
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+			subscription.NextReportAt = &nextReportAt
 		}
 
+		confirmationExpiresAt := time.Now().UTC().Add(time.Duration(authConfig.ConfirmationTTL) * time.Minute)
 		err = txManager.ExecuteTx(func(tx *sql.Tx) error {
-			subscriptionRepository = repositories.NewSubscriptionRepository(tx)
-			confirmationEmailRepository := repositories.NewConfirmationEmailsRepository(tx)
+			subscribersRepository := repositories.NewSubscribersRepository(tx)
+			subscriptionRepository := repositories.NewSubscriptionRepository(tx)
+			alertRulesRepository := repositories.NewAlertRulesRepository(tx)
 
-			token := uuid.New()
-			err = subscriptionRepository.SubscribeContext(ctx, data.Email, token, data.City, frequency)
+			subscriber, _, err := subscribersRepository.GetOrCreateSubscriberContext(
+				ctx,
+				data.Email,
+				confirmationExpiresAt,
+			)
 			if err != nil {
 				return err
 			}
 
-			return confirmationEmailRepository.StoreConfirmationEmail(
-				ctx,
-				models.ConfirmationEmail{
-					ToAddress:    data.Email,
-					Token:        token,
-					NextTryAfter: time.Now().UTC(),
-				},
-			)
+			exists, err := subscribersRepository.IsUserSubscribedContext(ctx, data.Email, location)
+			if err != nil {
+				return err
+			}
+			if exists {
+				// Subscribing again before confirming asks for the confirmation again.
+				if subscriber.Confirmed {
+					return errAlreadySubscribed
+				}
+				return issueConfirmation(ctx, tx, subscriber, confirmationExpiresAt)
+			}
+
+			subscription.SubscriberId = subscriber.Id
+			subscription.City = location.Name
+			subscription.Location = &location
+			subscriptionId, err := subscriptionRepository.SubscribeContext(ctx, subscription)
+			if err != nil {
+				return err
+			}
+
+			err = alertRulesRepository.StoreAlertRulesContext(ctx, subscriptionId, alertRules)
+			if err != nil {
+				return err
+			}
+
+			// Confirmation is asked once per address, cities added later are
+			// confirmed together with the first one, or right away once it is.
+			if subscriber.Confirmed {
+				return nil
+			}
+			return issueConfirmation(ctx, tx, subscriber, confirmationExpiresAt)
 		})
 		if err != nil {
+			if errors.Is(err, errAlreadySubscribed) {
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
 }
 
-func ConfirmSubscriptionHandler(database database.Database) gin.HandlerFunc {
+// issueConfirmation gives an unconfirmed subscriber until expiresAt to confirm
+// and queues a confirmation email, unless one is still waiting to be sent.
+// The email lists the subscriptions the subscriber has when it is sent.
+func issueConfirmation(
+	ctx context.Context,
+	database database.Database,
+	subscriber models.Subscriber,
+	expiresAt time.Time,
+) error {
+	err := repositories.NewSubscribersRepository(database).RenewConfirmationContext(ctx, subscriber.Id, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	emailOutboxRepository := repositories.NewEmailOutboxRepository(database)
+	pending, err := emailOutboxRepository.HasPendingConfirmationEmailContext(ctx, subscriber.Token)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return nil
+	}
+
+	email, err := models.NewOutboxEmail(
+		models.ConfirmationEmail,
+		subscriber.Email,
+		models.ConfirmationEmailPayload{Token: subscriber.Token},
+	)
+	if err != nil {
+		return err
+	}
+	return emailOutboxRepository.EnqueueEmailContext(ctx, email)
+}
+
+func toAlertRules(alerts []alertRuleData) []models.AlertRule {
+	alertRules := make([]models.AlertRule, 0, len(alerts))
+	for _, alert := range alerts {
+		alertRules = append(alertRules, models.AlertRule{
+			Metric:    models.AlertMetric(alert.Metric),
+			Operator:  models.AlertOperator(alert.Operator),
+			Threshold: alert.Threshold,
+		})
+	}
+	return alertRules
+}
+
+// applyScheduleData sets the schedule fields of the subscription, it returns
+// false when data has fields that the frequency does not use or they are malformed.
+func applyScheduleData(subscription *models.Subscription, data subscriptionData) bool {
+	usesDeliveryTime := subscription.Frequency == models.Daily || subscription.Frequency == models.Weekly
+	if (data.DeliveryTime != "" && !usesDeliveryTime) ||
+		(data.Weekday != "" && subscription.Frequency != models.Weekly) ||
+		((data.CronExpression != "") != (subscription.Frequency == models.Custom)) {
+		return false
+	}
+
+	if usesDeliveryTime {
+		subscription.DeliveryTime = models.DefaultDeliveryTime
+		if data.DeliveryTime != "" {
+			deliveryTime, err := models.ParseTimeOfDay(data.DeliveryTime)
+			if err != nil {
+				return false
+			}
+			subscription.DeliveryTime = deliveryTime
+		}
+	}
+
+	if subscription.Frequency == models.Weekly {
+		subscription.Weekday = models.DefaultDeliveryWeekday
+		if data.Weekday != "" {
+			weekday, err := models.ParseWeekday(data.Weekday)
+			if err != nil {
+				return false
+			}
+			subscription.Weekday = weekday
+		}
+	}
+
+	if subscription.Frequency == models.Custom {
+		_, err := models.ParseCronExpression(data.CronExpression)
+		if err != nil {
+			return false
+		}
+		subscription.CronExpression = data.CronExpression
+	}
+
+	// Quiet hours need both ends and are only supported by hourly subscriptions.
+	hasQuietHours := data.QuietHoursStart != "" || data.QuietHoursEnd != ""
+	if (hasQuietHours && subscription.Frequency != models.Hourly) || (data.OvernightSummary && !hasQuietHours) {
+		return false
+	}
+	if hasQuietHours {
+		start, err := models.ParseTimeOfDay(data.QuietHoursStart)
+		if err != nil {
+			return false
+		}
+		end, err := models.ParseTimeOfDay(data.QuietHoursEnd)
+		if err != nil {
+			return false
+		}
+
+		quietHours := models.QuietHours{Start: start, End: end}
+		if !quietHours.IsValid() {
+			return false
+		}
+		subscription.QuietHours = &quietHours
+		subscription.OvernightSummary = data.OvernightSummary
+	}
+
+	return true
+}
+
+// confirmationResendPeriod is the period ConfirmationResendsPerHour applies to.
+const confirmationResendPeriod = time.Hour
+
+// ResendConfirmationHandler queues the confirmation email again for an
+// unconfirmed address subscribed to the city. It responds with 202 whether
+// or not an email is sent, so it does not tell which addresses are subscribed.
+func ResendConfirmationHandler(
+	weatherService services.WeatherService,
+	txManager *database.TransactionManger,
+	authConfig *config.AuthConfig,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
-		tokenParam := c.Param("token")
-		if tokenParam == "" {
+		var data struct {
+			Email string `json:"email"`
+			City  string `json:"city"`
+		}
+		contentType := c.Request.Header.Get("Content-Type")
+		if contentType == "application/json" {
+			err := c.BindJSON(&data)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+		} else if contentType == "application/x-www-form-urlencoded" {
+			data.Email = c.PostForm("email")
+			data.City = c.PostForm("city")
+		} else {
+			c.AbortWithStatus(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		email := models.NormalizeEmail(data.Email)
+		if email == "" || data.City == "" {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
 
-		token, err := uuid.Parse(tokenParam)
+		location, err := services.ResolveLocation(ctx, weatherService, data.City)
 		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
+			if errors.Is(err, services.ErrCityNotFound) {
+				c.Status(http.StatusAccepted)
+				return
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+
+		err = txManager.ExecuteTx(func(tx *sql.Tx) error {
+			subscribersRepository := repositories.NewSubscribersRepository(tx)
+			emailOutboxRepository := repositories.NewEmailOutboxRepository(tx)
+
+			subscriber, err := subscribersRepository.GetSubscriberByEmailContext(ctx, email)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil
+				}
+				return err
+			}
+			if subscriber.Confirmed {
+				return nil
+			}
+
+			exists, err := subscribersRepository.IsUserSubscribedContext(ctx, email, location)
+			if err != nil || !exists {
+				return err
+			}
+
+			now := time.Now().UTC()
+			count, err := emailOutboxRepository.CountEmailsSinceContext(
+				ctx,
+				models.ConfirmationEmail,
+				subscriber.Email,
+				now.Add(-confirmationResendPeriod),
+			)
+			if err != nil {
+				return err
+			}
+			if count >= authConfig.ConfirmationResendsPerHour {
+				log.Printf("confirmation emails for subscriber %d are rate limited", subscriber.Id)
+				return nil
+			}
+
+			if authConfig.RotateConfirmationToken {
+				err = emailOutboxRepository.CancelConfirmationEmailsContext(ctx, subscriber.Token)
+				if err != nil {
+					return err
+				}
+
+				subscriber.Token = uuid.New()
+				err = subscribersRepository.RotateTokenContext(ctx, subscriber.Id, subscriber.Token)
+				if err != nil {
+					return err
+				}
+			}
+
+			return issueConfirmation(
+				ctx,
+				tx,
+				subscriber,
+				now.Add(time.Duration(authConfig.ConfirmationTTL)*time.Minute),
+			)
+		})
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 
-		subscriptionRepository := repositories.NewSubscriptionRepository(database)
-		err = subscriptionRepository.ConfirmSubscriptionContext(ctx, token)
+		c.Status(http.StatusAccepted)
+	}
+}
+
+// ConfirmSubscriptionHandler accepts signed confirmation links, and the plain
+// subscriber tokens confirmation emails linked to before links were signed.
+func ConfirmSubscriptionHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		token, err := uuid.Parse(c.Param("token"))
+		if err != nil {
+			var ok bool
+			token, ok = parseSignedTokenParam(c, authService.ParseConfirmationToken)
+			if !ok {
+				return
+			}
+		}
+
+		subscribersRepository := repositories.NewSubscribersRepository(database)
+		err = subscribersRepository.ConfirmSubscriberContext(ctx, token, time.Now().UTC())
 		if err != nil {
 			if err == repositories.ErrConfirmationTokenNotFound {
 				c.AbortWithStatus(http.StatusNotFound)
 				return
 			}
+			if err == repositories.ErrConfirmationTokenExpired {
+				c.AbortWithStatus(http.StatusGone)
+				return
+			}
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 	}
 }
 
-func UnsubscribeHandler(database database.Database) gin.HandlerFunc {
+// UnsubscribePageHandler asks to confirm the unsubscribe link of an email.
+// Mail scanners and clients prefetch links, so following the link
+// unsubscribes nobody, the form of the page posts to UnsubscribeHandler.
+func UnsubscribePageHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := uuid.Parse(c.Param("token")); err != nil {
+			_, ok := parseSignedTokenParam(c, authService.ParseUnsubscribeToken)
+			if !ok {
+				return
+			}
+		}
+
+		c.HTML(http.StatusOK, "confirm_action.html", gin.H{
+			"Title":       "Unsubscribe",
+			"Description": "You will no longer receive the weather reports and alerts of this email.",
+			"Action":      c.Request.URL.RequestURI(),
+			"Button":      "Unsubscribe",
+		})
+	}
+}
+
+// UnsubscribeHandler accepts signed unsubscribe links, and the plain
+// subscription tokens emails linked to before links were signed
+// until their grace period ends.
+// Mail clients post the List-Unsubscribe=One-Click body of RFC 8058
+// for the List-Unsubscribe header, the page of the link posts a form.
+func UnsubscribeHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !unsubscribe(c, database, authService) {
+			return
+		}
+
+		if c.PostForm("List-Unsubscribe") == "One-Click" {
+			c.Status(http.StatusOK)
+			return
+		}
+		respondToConfirmedAction(c, gin.H{
+			"Title":   "Unsubscribed",
+			"Message": "You will no longer receive these weather emails.",
+		})
+	}
+}
+
+func unsubscribe(c *gin.Context, database database.Database, authService services.AuthService) bool {
+	ctx := c.Request.Context()
+
+	subscriptionRepository := repositories.NewSubscriptionRepository(database)
+
+	legacyToken, err := uuid.Parse(c.Param("token"))
+	if err == nil {
+		err = subscriptionRepository.UnsubscribeByLegacyTokenContext(ctx, legacyToken, time.Now().UTC())
+		if err != nil {
+			// Old links stop working once their grace period ends,
+			// like signed links do when they expire.
+			if errors.Is(err, repositories.ErrLegacyTokenNotFound) {
+				c.AbortWithStatus(http.StatusGone)
+				return false
+			}
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return false
+		}
+		return true
+	}
+
+	subscriptionIds, ok := parseSignedTokenParam(c, authService.ParseUnsubscribeToken)
+	if !ok {
+		return false
+	}
+
+	for _, subscriptionId := range subscriptionIds {
+		err = subscriptionRepository.UnsubscribeContext(ctx, subscriptionId)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return false
+		}
+	}
+	return true
+}
+
+// maxPauseDays limits pauses with a resume date,
+// longer pauses have to be indefinite.
+const maxPauseDays = 365
+
+// PauseSubscriptionPageHandler asks to confirm the pause link of an email.
+// Mail scanners open links in emails, so following the link changes
+// nothing, the form of the page posts to PauseSubscriptionHandler.
+func PauseSubscriptionPageHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscription, resumeAt, ok := getSubscriptionToPause(c, database, authService)
+		if !ok {
+			return
+		}
+
+		c.HTML(http.StatusOK, "confirm_action.html", gin.H{
+			"Title": "Pause weather emails",
+			"Description": fmt.Sprintf(
+				"Reports and alerts for %s will be paused %s.",
+				subscription.City,
+				describePause(subscription, resumeAt),
+			),
+			"Action":     c.Request.URL.RequestURI(),
+			"Button":     "Pause",
+			"ManageLink": manageLinkPath(c),
+		})
+	}
+}
+
+// PauseSubscriptionHandler pauses the subscription until the resume_at query
+// parameter (RFC 3339) or for the given number of days. Without either
+// the subscription stays paused until it is resumed.
+func PauseSubscriptionHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
-		tokenParam := c.Param("token")
-		if tokenParam == "" {
-			c.AbortWithStatus(http.StatusBadRequest)
+		subscription, resumeAt, ok := getSubscriptionToPause(c, database, authService)
+		if !ok {
 			return
 		}
 
-		token, err := uuid.Parse(tokenParam)
+		err := repositories.NewSubscriptionRepository(database).PauseSubscriptionContext(ctx, subscription.Id, resumeAt)
 		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
+			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 
-		subscriptionRepository := repositories.NewSubscriptionRepository(database)
-		err = subscriptionRepository.UnsubscribeContext(ctx, token)
+		respondToConfirmedAction(c, gin.H{
+			"Title": "Weather emails paused",
+			"Message": fmt.Sprintf(
+				"Reports and alerts for %s are paused %s.",
+				subscription.City,
+				describePause(subscription, resumeAt),
+			),
+			"ManageLink": manageLinkPath(c),
+		})
+	}
+}
+
+func getSubscriptionToPause(
+	c *gin.Context,
+	database database.Database,
+	authService services.AuthService,
+) (models.Subscription, *time.Time, bool) {
+	subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+	if !ok {
+		return models.Subscription{}, nil, false
+	}
+
+	var resumeAt *time.Time
+	now := time.Now().UTC()
+	if resumeAtParam := c.Query("resume_at"); resumeAtParam != "" {
+		t, err := time.Parse(time.RFC3339, resumeAtParam)
 		if err != nil {
-			if err == repositories.ErrConfirmationTokenNotFound {
-				c.AbortWithStatus(http.StatusNotFound)
+			c.AbortWithError(http.StatusBadRequest, err)
+			return models.Subscription{}, nil, false
+		}
+		t = t.UTC()
+		resumeAt = &t
+	} else if daysParam := c.Query("days"); daysParam != "" {
+		days, err := strconv.Atoi(daysParam)
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return models.Subscription{}, nil, false
+		}
+		t := now.AddDate(0, 0, days)
+		resumeAt = &t
+	}
+	if resumeAt != nil && (!resumeAt.After(now) || resumeAt.After(now.AddDate(0, 0, maxPauseDays))) {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return models.Subscription{}, nil, false
+	}
+
+	subscription, ok := getSubscriptionFromToken(c, database, subscriptionId)
+	return subscription, resumeAt, ok
+}
+
+func describePause(subscription models.Subscription, resumeAt *time.Time) string {
+	if resumeAt == nil {
+		return "until you resume them"
+	}
+	return "until " + resumeAt.In(subscription.TimeLocation()).Format("January 2, 2006 15:04 MST")
+}
+
+// ResumeSubscriptionPageHandler asks to confirm the resume link,
+// the form of the page posts to ResumeSubscriptionHandler.
+func ResumeSubscriptionPageHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		subscription, ok := getSubscriptionFromToken(c, database, subscriptionId)
+		if !ok {
+			return
+		}
+
+		if !subscription.Paused {
+			c.HTML(http.StatusOK, "confirm_action.html", gin.H{
+				"Title":      "Resume weather emails",
+				"Message":    fmt.Sprintf("Reports and alerts for %s are not paused.", subscription.City),
+				"ManageLink": manageLinkPath(c),
+			})
+			return
+		}
+
+		c.HTML(http.StatusOK, "confirm_action.html", gin.H{
+			"Title":       "Resume weather emails",
+			"Description": fmt.Sprintf("Reports and alerts for %s will be sent again.", subscription.City),
+			"Action":      c.Request.URL.RequestURI(),
+			"Button":      "Resume",
+			"ManageLink":  manageLinkPath(c),
+		})
+	}
+}
+
+func ResumeSubscriptionHandler(database database.Database, authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		subscriptionId, ok := parseSignedTokenParam(c, authService.ParseManageToken)
+		if !ok {
+			return
+		}
+
+		subscription, ok := getSubscriptionFromToken(c, database, subscriptionId)
+		if !ok {
+			return
+		}
+
+		var nextReportAt *time.Time
+		if subscription.Frequency != models.Alert {
+			next, err := subscription.NextReportTime(time.Now())
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
 				return
 			}
+			nextReportAt = &next
+		}
+
+		err := repositories.NewSubscriptionRepository(database).ResumeSubscriptionContext(ctx, subscription.Id, nextReportAt)
+		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
+
+		respondToConfirmedAction(c, gin.H{
+			"Title":      "Weather emails resumed",
+			"Message":    fmt.Sprintf("Reports and alerts for %s are sent again.", subscription.City),
+			"ManageLink": manageLinkPath(c),
+		})
+	}
+}
+
+// getSubscriptionFromToken loads the subscription a signed link was made
+// for, it aborts with 404 when the subscription was deleted since.
+func getSubscriptionFromToken(
+	c *gin.Context,
+	database database.Database,
+	subscriptionId int,
+) (models.Subscription, bool) {
+	subscription, err := repositories.NewSubscriptionRepository(database).GetSubscriptionByIdContext(
+		c.Request.Context(),
+		subscriptionId,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return models.Subscription{}, false
+		}
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return models.Subscription{}, false
+	}
+	return subscription, true
+}
+
+// respondToConfirmedAction shows the result page to forms of the confirmation
+// pages, API clients only get the status.
+func respondToConfirmedAction(c *gin.Context, page gin.H) {
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		c.Status(http.StatusOK)
+		return
 	}
+	c.HTML(http.StatusOK, "confirm_action.html", page)
+}
+
+func manageLinkPath(c *gin.Context) string {
+	return "/subscriptions/" + c.Param("token") + "/manage"
 }
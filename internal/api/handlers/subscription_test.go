@@ -0,0 +1,578 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+func TestResendConfirmationRespondsTheSame(t *testing.T) {
+	confirmationExpiresAt := time.Now().Add(time.Hour)
+	unconfirmed := models.Subscriber{
+		Id:                    3,
+		Email:                 "user@example.com",
+		Token:                 uuid.New(),
+		ConfirmationExpiresAt: &confirmationExpiresAt,
+	}
+	confirmed := unconfirmed
+	confirmed.Confirmed = true
+
+	tests := []struct {
+		name       string
+		city       string
+		subscriber *models.Subscriber
+		subscribed bool
+		sentToday  int64
+		wantQueued bool
+	}{
+		{name: "unknown city", city: "Atlantis"},
+		{name: "unknown address", city: "Kyiv"},
+		{name: "confirmed address", city: "Kyiv", subscriber: &confirmed, subscribed: true},
+		{name: "not subscribed to the city", city: "Kyiv", subscriber: &unconfirmed},
+		{name: "rate limited", city: "Kyiv", subscriber: &unconfirmed, subscribed: true, sentToday: 3},
+		{name: "queued", city: "Kyiv", subscriber: &unconfirmed, subscribed: true, sentToday: 2, wantQueued: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDatabase(t)
+			subscribers := [][]driver.Value{}
+			if tt.subscriber != nil {
+				subscribers = append(subscribers, subscriberRow(*tt.subscriber))
+			}
+			fake.on("FROM subscribers WHERE email = $1", rowsOf(subscriberRowColumns, subscribers...))
+			fake.on("SELECT 1 FROM user_subscriptions", rowsOf([]string{"exists"}, []driver.Value{tt.subscribed}))
+			fake.on("SELECT COUNT(*) FROM email_outbox", rowsOf([]string{"count"}, []driver.Value{tt.sentToday}))
+			fake.on("UPDATE subscribers SET confirmation_expires_at", affected(1))
+			fake.on("SELECT 1 FROM email_outbox", rowsOf([]string{"exists"}, []driver.Value{false}))
+			fake.on("INSERT INTO email_outbox", affected(1))
+
+			r := newTestRouter()
+			r.POST("subscribe/resend", ResendConfirmationHandler(
+				newTestWeatherService(),
+				database.NewTransactionManager(db),
+				&config.AuthConfig{ConfirmationTTL: 60, ConfirmationResendsPerHour: 3},
+			))
+
+			// The response does not tell whether an email was sent.
+			w := postForm(r, "/subscribe/resend", url.Values{"email": {"user@example.com"}, "city": {tt.city}})
+			if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+				t.Errorf("expected an empty %d, got %d: %q", http.StatusAccepted, w.Code, w.Body)
+			}
+
+			if queued := len(fake.ran("INSERT INTO email_outbox")) > 0; queued != tt.wantQueued {
+				t.Errorf("expected queued %v, got %v", tt.wantQueued, queued)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeLinkPageDoesNotUnsubscribe(t *testing.T) {
+	fake, db := newFakeDatabase(t)
+	fake.on("DELETE FROM user_subscriptions WHERE id = $1", affected(1))
+
+	authService := newTestAuthService(t)
+	r := newTestRouter()
+	r.GET("unsubscribe/:token", UnsubscribePageHandler(authService))
+	r.POST("unsubscribe/:token", UnsubscribeHandler(db, authService))
+	target := "/unsubscribe/" + authService.UnsubscribeToken(4, 5)
+
+	// Mail scanners follow the link of the email.
+	w := serve(r, http.MethodGet, target, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `action="`+target+`"`) {
+		t.Errorf("expected a form posting to the link, got %s", w.Body)
+	}
+	if len(fake.ran("DELETE")) != 0 {
+		t.Fatal("expected the page not to unsubscribe")
+	}
+
+	w = postForm(r, target, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Unsubscribed") {
+		t.Errorf("expected the unsubscribed page, got %d: %s", w.Code, w.Body)
+	}
+	deletes := fake.ran("DELETE FROM user_subscriptions")
+	if len(deletes) != 2 || deletes[0].args[0] != 4 || deletes[1].args[0] != 5 {
+		t.Errorf("expected subscriptions 4 and 5 deleted, got %v", deletes)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	authService := newTestAuthService(t)
+	expiredLinks, err := services.NewAuthService(&config.AuthConfig{Secret: "secret", EmailLinkTTL: -1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		body        url.Values
+		deleted     int64
+		wantStatus  int
+		wantDeletes int
+	}{
+		{
+			// RFC 8058 clients post without showing the page.
+			name:        "one click",
+			token:       authService.UnsubscribeToken(4),
+			body:        url.Values{"List-Unsubscribe": {"One-Click"}},
+			deleted:     1,
+			wantStatus:  http.StatusOK,
+			wantDeletes: 1,
+		},
+		{
+			name:        "legacy token in its grace period",
+			token:       uuid.NewString(),
+			deleted:     1,
+			wantStatus:  http.StatusOK,
+			wantDeletes: 1,
+		},
+		{
+			name:        "legacy token after its grace period",
+			token:       uuid.NewString(),
+			wantStatus:  http.StatusGone,
+			wantDeletes: 1,
+		},
+		{
+			name:       "expired link",
+			token:      expiredLinks.UnsubscribeToken(4),
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "manage token",
+			token:      authService.ManageToken(4),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDatabase(t)
+			fake.on("DELETE FROM user_subscriptions", affected(tt.deleted))
+
+			r := newTestRouter()
+			r.POST("unsubscribe/:token", UnsubscribeHandler(db, authService))
+
+			w := postForm(r, "/unsubscribe/"+tt.token, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.body != nil && w.Body.Len() != 0 {
+				t.Errorf("expected no page for one click, got %s", w.Body)
+			}
+			if deletes := len(fake.ran("DELETE")); deletes != tt.wantDeletes {
+				t.Errorf("expected %d deletes, got %d", tt.wantDeletes, deletes)
+			}
+		})
+	}
+}
+
+func testSubscription(frequency models.Frequency) models.Subscription {
+	return models.Subscription{
+		Id:           4,
+		SubscriberId: 2,
+		Confirmed:    true,
+		Email:        "user@example.com",
+		City:         "Kyiv",
+		Frequency:    frequency,
+		Units:        models.Metric,
+		Timezone:     "Europe/Kyiv",
+	}
+}
+
+func TestPauseSubscription(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantResumeIn time.Duration
+		wantPaused   bool
+	}{
+		{name: "until resumed", wantStatus: http.StatusOK, wantPaused: true},
+		{name: "for days", query: "?days=7", wantStatus: http.StatusOK, wantPaused: true, wantResumeIn: 7 * 24 * time.Hour},
+		{
+			name:         "until a date",
+			query:        "?resume_at=" + url.QueryEscape(time.Now().Add(48*time.Hour).Format(time.RFC3339)),
+			wantStatus:   http.StatusOK,
+			wantPaused:   true,
+			wantResumeIn: 48 * time.Hour,
+		},
+		{name: "resume date in the past", query: "?days=0", wantStatus: http.StatusBadRequest},
+		{name: "resume date too far", query: "?days=400", wantStatus: http.StatusBadRequest},
+		{name: "malformed resume date", query: "?resume_at=tomorrow", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDatabase(t)
+			fake.on("WHERE s.id = $1", rowsOf(subscriptionRowColumns, subscriptionRow(testSubscription(models.Daily))))
+			fake.on("UPDATE user_subscriptions SET paused = true", affected(1))
+
+			authService := newTestAuthService(t)
+			r := newTestRouter()
+			r.GET("pause/:token", PauseSubscriptionPageHandler(db, authService))
+			r.POST("pause/:token", PauseSubscriptionHandler(db, authService))
+			target := "/pause/" + authService.ManageToken(4) + tt.query
+
+			w := serve(r, http.MethodGet, target, "", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected the page with %d, got %d", tt.wantStatus, w.Code)
+			}
+			if len(fake.ran("UPDATE")) != 0 {
+				t.Fatal("expected the page not to pause")
+			}
+
+			w = serve(r, http.MethodPost, target, "", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			pauses := fake.ran("UPDATE user_subscriptions SET paused = true")
+			if !tt.wantPaused {
+				if len(pauses) != 0 {
+					t.Error("expected the subscription not to be paused")
+				}
+				return
+			}
+			if len(pauses) != 1 {
+				t.Fatalf("expected the subscription paused, got %v", pauses)
+			}
+			resumeAt := pauses[0].args[0].(*time.Time)
+			if tt.wantResumeIn == 0 {
+				if resumeAt != nil {
+					t.Errorf("expected no resume date, got %v", resumeAt)
+				}
+				return
+			}
+			if resumeAt == nil || time.Until(*resumeAt).Round(time.Hour) != tt.wantResumeIn {
+				t.Errorf("expected to resume in %s, got %v", tt.wantResumeIn, resumeAt)
+			}
+		})
+	}
+}
+
+func TestResumeSubscription(t *testing.T) {
+	tests := []struct {
+		name           string
+		frequency      models.Frequency
+		wantNextReport bool
+	}{
+		{name: "scheduled subscription", frequency: models.Daily, wantNextReport: true},
+		{name: "alert subscription", frequency: models.Alert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := testSubscription(tt.frequency)
+			subscription.Paused = true
+			fake, db := newFakeDatabase(t)
+			fake.on("WHERE s.id = $1", rowsOf(subscriptionRowColumns, subscriptionRow(subscription)))
+			fake.on("UPDATE user_subscriptions SET paused = false", affected(1))
+
+			authService := newTestAuthService(t)
+			r := newTestRouter()
+			r.POST("resume/:token", ResumeSubscriptionHandler(db, authService))
+
+			before := time.Now()
+			w := postForm(r, "/resume/"+authService.ManageToken(4), nil)
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "resumed") {
+				t.Fatalf("expected the resumed page, got %d: %s", w.Code, w.Body)
+			}
+
+			resumes := fake.ran("UPDATE user_subscriptions SET paused = false")
+			if len(resumes) != 1 {
+				t.Fatalf("expected the subscription resumed, got %v", resumes)
+			}
+			nextReportAt := resumes[0].args[0].(*time.Time)
+			if !tt.wantNextReport {
+				if nextReportAt != nil {
+					t.Errorf("expected no next report, got %v", nextReportAt)
+				}
+				return
+			}
+			// Reports missed while paused are not sent at once.
+			expected, _ := subscription.NextReportTime(before)
+			if nextReportAt == nil || !nextReportAt.Equal(expected) {
+				t.Errorf("expected the next report at %v, got %v", expected, nextReportAt)
+			}
+		})
+	}
+}
+
+func TestPauseDeletedSubscription(t *testing.T) {
+	fake, db := newFakeDatabase(t)
+	fake.on("WHERE s.id = $1", rowsOf(subscriptionRowColumns))
+
+	authService := newTestAuthService(t)
+	r := newTestRouter()
+	r.POST("pause/:token", PauseSubscriptionHandler(db, authService))
+	r.POST("resume/:token", ResumeSubscriptionHandler(db, authService))
+
+	for _, target := range []string{"/pause/", "/resume/"} {
+		if w := serve(r, http.MethodPost, target+authService.ManageToken(4), "", ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected %d for %s, got %d", http.StatusNotFound, target, w.Code)
+		}
+	}
+}
+
+// subscribeDatabase answers the queries of a subscription to a city, for
+// the subscriber the address belongs to or a new one when created is set.
+func subscribeDatabase(
+	t *testing.T,
+	subscriber models.Subscriber,
+	created bool,
+	subscribed bool,
+	pendingConfirmation bool,
+) (*fakeDatabase, *gin.Engine) {
+	fake, db := subscribeQueries(t, subscriber, created, subscribed, pendingConfirmation)
+	return fake, subscribeRouter(newTestWeatherService(), db)
+}
+
+// subscribeQueries scripts the queries behind subscribeDatabase.
+func subscribeQueries(
+	t *testing.T,
+	subscriber models.Subscriber,
+	created bool,
+	subscribed bool,
+	pendingConfirmation bool,
+) (*fakeDatabase, *sql.DB) {
+	fake, db := newFakeDatabase(t)
+	createdRows := [][]driver.Value{}
+	if created {
+		createdRows = append(createdRows, subscriberRow(subscriber))
+	}
+	fake.on("INSERT INTO subscribers", rowsOf(subscriberRowColumns, createdRows...))
+	fake.on("FROM subscribers WHERE email = $1", rowsOf(subscriberRowColumns, subscriberRow(subscriber)))
+	fake.on("SELECT 1 FROM user_subscriptions", rowsOf([]string{"exists"}, []driver.Value{subscribed}))
+	fake.on("INSERT INTO user_subscriptions", rowsOf([]string{"id"}, []driver.Value{int64(9)}))
+	fake.on("INSERT INTO subscription_alert_rules", affected(1))
+	fake.on("UPDATE subscribers SET confirmation_expires_at", affected(1))
+	fake.on("SELECT 1 FROM email_outbox", rowsOf([]string{"exists"}, []driver.Value{pendingConfirmation}))
+	fake.on("INSERT INTO email_outbox", affected(1))
+	return fake, db
+}
+
+func subscribeRouter(weatherService services.WeatherService, db *sql.DB) *gin.Engine {
+	r := newTestRouter()
+	r.POST("subscribe", SubscribeForWeatherHandler(
+		weatherService,
+		nil,
+		db,
+		database.NewTransactionManager(db),
+		&config.AuthConfig{ConfirmationTTL: 60},
+	))
+	return r
+}
+
+func newSubscriber() models.Subscriber {
+	confirmationExpiresAt := time.Now().Add(time.Hour)
+	return models.Subscriber{
+		Id:                    2,
+		Email:                 "user@example.com",
+		Token:                 uuid.New(),
+		ConfirmationExpiresAt: &confirmationExpiresAt,
+	}
+}
+
+func TestSubscribeResolvesCity(t *testing.T) {
+	tests := []struct {
+		name       string
+		city       string
+		wantStatus int
+	}{
+		{name: "known city", city: "Kyiv", wantStatus: http.StatusOK},
+		{name: "case and spaces", city: "  kyiv ", wantStatus: http.StatusOK},
+		{name: "unknown city", city: "Atlantis", wantStatus: http.StatusNotFound},
+		{name: "missing city", city: "", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, r := subscribeDatabase(t, newSubscriber(), true, false, false)
+
+			w := postForm(r, "/subscribe", url.Values{
+				"email":     {"user@example.com"},
+				"city":      {tt.city},
+				"frequency": {"daily"},
+			})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			inserts := fake.ran("INSERT INTO user_subscriptions")
+			if tt.wantStatus != http.StatusOK {
+				if len(fake.ran("INSERT")) != 0 {
+					t.Error("expected nothing stored")
+				}
+				return
+			}
+			// The subscription stores the location the provider resolved.
+			if len(inserts) != 1 ||
+				inserts[0].args[1] != kyiv.Name ||
+				inserts[0].args[4] != kyiv.Latitude ||
+				inserts[0].args[5] != kyiv.Longitude {
+				t.Errorf("expected a subscription to %+v, got %v", kyiv, inserts)
+			}
+		})
+	}
+}
+
+func TestSubscribeTimezone(t *testing.T) {
+	unknownZone := kyiv
+	unknownZone.Name = "Nowhere"
+	unknownZone.Timezone = "Nowhere/Town"
+	noZone := kyiv
+	noZone.Name = "Lviv"
+	noZone.Timezone = ""
+
+	tests := []struct {
+		name         string
+		city         string
+		timezone     string
+		wantStatus   int
+		wantTimezone string
+	}{
+		{name: "city timezone", city: "Kyiv", wantStatus: http.StatusOK, wantTimezone: "Europe/Kyiv"},
+		{
+			name:         "explicit timezone",
+			city:         "Kyiv",
+			timezone:     "America/New_York",
+			wantStatus:   http.StatusOK,
+			wantTimezone: "America/New_York",
+		},
+		{name: "invalid timezone", city: "Kyiv", timezone: "Mars/Olympus", wantStatus: http.StatusBadRequest},
+		{name: "unknown city timezone", city: "Nowhere", wantStatus: http.StatusOK, wantTimezone: "UTC"},
+		{name: "looked up timezone", city: "Lviv", wantStatus: http.StatusOK, wantTimezone: "Asia/Tokyo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := subscribeQueries(t, newSubscriber(), true, false, false)
+			weatherService := newTestWeatherService()
+			weatherService.locations["nowhere"] = []models.Location{unknownZone}
+			weatherService.locations["lviv"] = []models.Location{noZone}
+			weatherService.timezone = "Asia/Tokyo"
+			r := subscribeRouter(weatherService, db)
+
+			w := postForm(r, "/subscribe", url.Values{
+				"email":     {"user@example.com"},
+				"city":      {tt.city},
+				"frequency": {"daily"},
+				"timezone":  {tt.timezone},
+			})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			inserts := fake.ran("INSERT INTO user_subscriptions")
+			if tt.wantStatus != http.StatusOK {
+				if len(inserts) != 0 {
+					t.Error("expected no subscription stored")
+				}
+				return
+			}
+			if len(inserts) != 1 || inserts[0].args[8] != tt.wantTimezone {
+				t.Errorf("expected timezone %q, got %v", tt.wantTimezone, inserts)
+			}
+		})
+	}
+}
+
+func TestSubscribeAnotherCity(t *testing.T) {
+	confirmed := newSubscriber()
+	confirmed.Confirmed = true
+	confirmed.ConfirmationExpiresAt = nil
+
+	tests := []struct {
+		name                string
+		subscriber          models.Subscriber
+		created             bool
+		subscribed          bool
+		pendingConfirmation bool
+		wantStatus          int
+		wantSubscription    bool
+		wantRenewed         bool
+		wantQueued          bool
+	}{
+		{
+			name:             "new subscriber",
+			subscriber:       newSubscriber(),
+			created:          true,
+			wantStatus:       http.StatusOK,
+			wantSubscription: true,
+			wantRenewed:      true,
+			wantQueued:       true,
+		},
+		{
+			name:             "confirmed subscriber adds a city",
+			subscriber:       confirmed,
+			wantStatus:       http.StatusOK,
+			wantSubscription: true,
+		},
+		{
+			name:                "unconfirmed subscriber adds a city",
+			subscriber:          newSubscriber(),
+			pendingConfirmation: true,
+			wantStatus:          http.StatusOK,
+			wantSubscription:    true,
+			wantRenewed:         true,
+		},
+		{
+			name:       "confirmed subscriber subscribes again",
+			subscriber: confirmed,
+			subscribed: true,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:        "unconfirmed subscriber subscribes again",
+			subscriber:  newSubscriber(),
+			subscribed:  true,
+			wantStatus:  http.StatusOK,
+			wantRenewed: true,
+			wantQueued:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, r := subscribeDatabase(t, tt.subscriber, tt.created, tt.subscribed, tt.pendingConfirmation)
+
+			w := postForm(r, "/subscribe", url.Values{
+				"email":     {"user@example.com"},
+				"city":      {"Kyiv"},
+				"frequency": {"daily"},
+			})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			inserts := fake.ran("INSERT INTO user_subscriptions")
+			if subscribed := len(inserts) == 1; subscribed != tt.wantSubscription {
+				t.Errorf("expected subscription stored %v, got %v", tt.wantSubscription, inserts)
+			}
+			if tt.wantSubscription && inserts[0].args[0] != tt.subscriber.Id {
+				t.Errorf("expected subscriber %d, got %v", tt.subscriber.Id, inserts[0].args[0])
+			}
+			if renewed := len(fake.ran("UPDATE subscribers SET confirmation_expires_at")) == 1; renewed != tt.wantRenewed {
+				t.Errorf("expected confirmation renewed %v, got %v", tt.wantRenewed, renewed)
+			}
+			if queued := len(fake.ran("INSERT INTO email_outbox")) == 1; queued != tt.wantQueued {
+				t.Errorf("expected confirmation queued %v, got %v", tt.wantQueued, queued)
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kievzenit/genesis-case/internal/models"
 	"github.com/kievzenit/genesis-case/internal/services"
 )
 
@@ -16,20 +19,119 @@ func GetWeatherForCityHandler(weatherService services.WeatherService) gin.Handle
 			return
 		}
 
-		weatherResponse, err := weatherService.GetCurrentWeatherForCity(city)
+		units, ok := parseUnitsQuery(c)
+		if !ok {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		weatherResponse, err := weatherService.GetCurrentWeather(c.Request.Context(), services.CityQuery(city))
 		if err == nil {
+			weatherResponse = weatherResponse.InUnits(units)
 			c.JSON(http.StatusOK, gin.H{
-				"temperature": weatherResponse.Temperature,
-				"humidity":    weatherResponse.Humidity,
-				"description": weatherResponse.Condition,
+				"temperature":    weatherResponse.Temperature,
+				"feels_like":     weatherResponse.FeelsLike,
+				"humidity":       weatherResponse.Humidity,
+				"wind_speed":     weatherResponse.WindSpeed,
+				"wind_degree":    weatherResponse.WindDegree,
+				"wind_direction": weatherResponse.WindDirection,
+				"pressure":       weatherResponse.Pressure,
+				"visibility":     weatherResponse.Visibility,
+				"uv_index":       weatherResponse.UVIndex,
+				"cloud_cover":    weatherResponse.CloudCover,
+				"description":    weatherResponse.Condition,
+				"condition_code": weatherResponse.ConditionCode,
+				"icon_url":       weatherResponse.IconURL,
 			})
 			return
 		}
 
 		if errors.Is(err, services.ErrCityNotFound) {
 			c.AbortWithStatus(http.StatusNotFound)
+			return
 		}
 
 		c.AbortWithError(http.StatusInternalServerError, err)
 	}
 }
+
+const defaultForecastDays = 3
+
+func GetForecastForCityHandler(weatherService services.WeatherService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		city := c.Query("city")
+		if city == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		days := defaultForecastDays
+		if daysParam := c.Query("days"); daysParam != "" {
+			var err error
+			days, err = strconv.Atoi(daysParam)
+			if err != nil || days < 1 || days > services.MaxForecastDays {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+		}
+
+		units, ok := parseUnitsQuery(c)
+		if !ok {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		forecast, err := weatherService.GetForecast(c.Request.Context(), services.CityQuery(city), days)
+		if err != nil {
+			if errors.Is(err, services.ErrCityNotFound) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		forecast = forecast.InUnits(units)
+
+		daily := make([]gin.H, 0, len(forecast.Daily))
+		for _, day := range forecast.Daily {
+			daily = append(daily, gin.H{
+				"date":                 day.Date.Format(time.DateOnly),
+				"min_temperature":      day.MinTemperature,
+				"max_temperature":      day.MaxTemperature,
+				"precipitation_chance": day.PrecipitationChance,
+				"max_wind_speed":       day.MaxWindSpeed,
+				"uv_index":             day.UVIndex,
+				"description":          day.Condition,
+			})
+		}
+
+		hourly := make([]gin.H, 0, len(forecast.Hourly))
+		for _, hour := range forecast.Hourly {
+			hourly = append(hourly, gin.H{
+				"time":                 hour.Time.Format(time.RFC3339),
+				"temperature":          hour.Temperature,
+				"precipitation_chance": hour.PrecipitationChance,
+				"wind_speed":           hour.WindSpeed,
+				"uv_index":             hour.UVIndex,
+				"description":          hour.Condition,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"daily":  daily,
+			"hourly": hourly,
+		})
+	}
+}
+
+// parseUnitsQuery reads the optional units query parameter, defaulting to metric.
+func parseUnitsQuery(c *gin.Context) (models.Units, bool) {
+	unitsParam := c.Query("units")
+	if unitsParam == "" {
+		return models.Metric, true
+	}
+
+	units := models.Units(unitsParam)
+	return units, units.IsValid()
+}
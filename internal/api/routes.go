@@ -1,22 +1,28 @@
 package routes
 
 import (
+	"html/template"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kievzenit/genesis-case/internal/api/handlers"
 	"github.com/kievzenit/genesis-case/internal/config"
 	"github.com/kievzenit/genesis-case/internal/database"
 	"github.com/kievzenit/genesis-case/internal/services"
+	"github.com/kievzenit/genesis-case/templates"
 )
 
 func RegisterRoutes(
 	weatherService services.WeatherService,
 	emailService services.EmailService,
+	authService services.AuthService,
 	database database.Database,
 	txManager *database.TransactionManger,
 	corsConfig *config.CORSConfig,
+	authConfig *config.AuthConfig,
 ) *gin.Engine {
 	r := gin.Default()
+	r.SetHTMLTemplate(template.Must(template.ParseFS(templates.FS, "pages/*.html")))
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     corsConfig.AllowOrigins,
@@ -26,15 +32,51 @@ func RegisterRoutes(
 	}))
 
 	r.GET("weather", handlers.GetWeatherForCityHandler(weatherService))
+	r.GET("forecast", handlers.GetForecastForCityHandler(weatherService))
+	r.GET("locations/search", handlers.SearchLocationsHandler(weatherService))
 
 	r.POST("subscribe", handlers.SubscribeForWeatherHandler(
 		weatherService,
 		emailService,
 		database,
 		txManager,
+		authConfig,
+	))
+	r.POST("subscribe/resend", handlers.ResendConfirmationHandler(weatherService, txManager, authConfig))
+	r.GET("confirm/:token", handlers.ConfirmSubscriptionHandler(database, authService))
+	r.GET("unsubscribe/:token", handlers.UnsubscribePageHandler(authService))
+	r.POST("unsubscribe/:token", handlers.UnsubscribeHandler(database, authService))
+	r.GET("pause/:token", handlers.PauseSubscriptionPageHandler(database, authService))
+	r.POST("pause/:token", handlers.PauseSubscriptionHandler(database, authService))
+	r.GET("resume/:token", handlers.ResumeSubscriptionPageHandler(database, authService))
+	r.POST("resume/:token", handlers.ResumeSubscriptionHandler(database, authService))
+
+	r.GET("subscriptions/:token", handlers.GetSubscriptionHandler(database, authService))
+	r.PATCH("subscriptions/:token", handlers.UpdateSubscriptionHandler(
+		weatherService,
+		authService,
+		database,
+		txManager,
 	))
-	r.GET("confirm/:token", handlers.ConfirmSubscriptionHandler(database))
-	r.GET("unsubscribe/:token", handlers.UnsubscribeHandler(database))
+	r.GET("subscriptions/:token/manage", handlers.ManageSubscriptionPageHandler(database, authService))
+	r.POST("subscriptions/:token/manage", handlers.SubmitManageSubscriptionPageHandler(
+		weatherService,
+		authService,
+		database,
+		txManager,
+	))
+
+	r.POST("auth/magic-link", handlers.RequestMagicLinkHandler(database, txManager, authService, authConfig))
+	r.GET("auth/login/:token", handlers.LoginPageHandler(authService))
+	r.POST("auth/login/:token", handlers.LoginHandler(txManager, authService))
+	r.POST("auth/logout", handlers.LogoutHandler())
+
+	r.GET("account", handlers.AccountPageHandler(database, authService))
+	account := r.Group("account", handlers.RequireSession(authService))
+	account.GET("subscriptions", handlers.ListAccountSubscriptionsHandler(database))
+	account.PATCH("subscriptions/:id", handlers.UpdateAccountSubscriptionHandler(weatherService, database, txManager))
+	account.DELETE("subscriptions/:id", handlers.DeleteAccountSubscriptionHandler(database))
+	account.POST("subscriptions/:id/delete", handlers.SubmitDeleteAccountSubscriptionHandler(database))
 
 	return r
 }
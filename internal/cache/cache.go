@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLoadPanicked is returned to the callers that waited for a load
+// which panicked, the panic itself goes to the caller that ran it.
+var ErrLoadPanicked = errors.New("cache load panicked")
+
+// Cache is a size bounded LRU cache with per lookup max age and
+// single-flight loading of missing keys.
+type Cache[V any] struct {
+	mu       sync.Mutex
+	maxSize  int
+	items    map[string]*list.Element
+	order    *list.List
+	calls    map[string]*call[V]
+	errorTTL func(error) time.Duration
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	err       error
+	fetchedAt time.Time
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// New creates a cache holding at most maxSize entries. errorTTL decides for
+// how long a failed load is remembered, errors with zero TTL are not cached.
+func New[V any](maxSize int, errorTTL func(error) time.Duration) *Cache[V] {
+	if errorTTL == nil {
+		errorTTL = func(error) time.Duration { return 0 }
+	}
+
+	return &Cache[V]{
+		maxSize:  maxSize,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		calls:    make(map[string]*call[V]),
+		errorTTL: errorTTL,
+	}
+}
+
+// Load returns the cached result for key if it is younger than maxAge,
+// otherwise it calls load. Concurrent loads of the same key share one call.
+func (c *Cache[V]) Load(key string, maxAge time.Duration, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	if cached, ok := c.get(key, maxAge); ok {
+		c.mu.Unlock()
+		return cached.value, cached.err
+	}
+
+	if inFlight, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-inFlight.done
+		return inFlight.value, inFlight.err
+	}
+
+	current := &call[V]{done: make(chan struct{}), err: ErrLoadPanicked}
+	c.calls[key] = current
+	c.mu.Unlock()
+
+	// Waiters are released even when load panics.
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(current.done)
+	}()
+
+	value, err := load()
+	current.value, current.err = value, err
+
+	c.mu.Lock()
+	if err == nil || c.errorTTL(err) > 0 {
+		c.set(key, value, err)
+	}
+	c.mu.Unlock()
+
+	return value, err
+}
+
+func (c *Cache[V]) get(key string, maxAge time.Duration) (*entry[V], bool) {
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	cached := element.Value.(*entry[V])
+	if cached.err != nil {
+		maxAge = c.errorTTL(cached.err)
+	}
+	if time.Since(cached.fetchedAt) >= maxAge {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return cached, true
+}
+
+func (c *Cache[V]) set(key string, value V, err error) {
+	cached := &entry[V]{
+		key:       key,
+		value:     value,
+		err:       err,
+		fetchedAt: time.Now(),
+	}
+
+	if element, ok := c.items[key]; ok {
+		element.Value = cached
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(cached)
+	for c.maxSize > 0 && c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[V]).key)
+	}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+func notFoundTTL(err error) time.Duration {
+	if errors.Is(err, errNotFound) {
+		return time.Hour
+	}
+	return 0
+}
+
+// countingLoad returns load funcs that count their calls.
+func countingLoad[V any](calls *atomic.Int32, value V, err error) func() (V, error) {
+	return func() (V, error) {
+		calls.Add(1)
+		return value, err
+	}
+}
+
+func TestLoadCachesValues(t *testing.T) {
+	c := New[int](10, nil)
+	var calls atomic.Int32
+
+	for range 3 {
+		value, err := c.Load("kyiv", time.Minute, countingLoad(&calls, 1, nil))
+		if err != nil || value != 1 {
+			t.Fatalf("expected 1, got %v, %v", value, err)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 load, got %d", calls.Load())
+	}
+}
+
+func TestLoadMaxAgePerCall(t *testing.T) {
+	c := New[int](10, nil)
+	var calls atomic.Int32
+
+	c.Load("kyiv", time.Minute, countingLoad(&calls, 1, nil))
+	time.Sleep(20 * time.Millisecond)
+
+	// A long max age still accepts the entry, a short one does not.
+	value, _ := c.Load("kyiv", time.Minute, countingLoad(&calls, 2, nil))
+	if value != 1 || calls.Load() != 1 {
+		t.Fatalf("expected the cached value, got %v after %d loads", value, calls.Load())
+	}
+
+	value, _ = c.Load("kyiv", 10*time.Millisecond, countingLoad(&calls, 2, nil))
+	if value != 2 || calls.Load() != 2 {
+		t.Fatalf("expected a new value, got %v after %d loads", value, calls.Load())
+	}
+}
+
+func TestLoadEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string](2, nil)
+	var calls atomic.Int32
+
+	c.Load("kyiv", time.Minute, countingLoad(&calls, "kyiv", nil))
+	c.Load("lviv", time.Minute, countingLoad(&calls, "lviv", nil))
+	// Using kyiv makes lviv the least recently used entry.
+	c.Load("kyiv", time.Minute, countingLoad(&calls, "kyiv", nil))
+	c.Load("odesa", time.Minute, countingLoad(&calls, "odesa", nil))
+
+	if len(c.items) != 2 || c.order.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(c.items))
+	}
+	if _, ok := c.items["lviv"]; ok {
+		t.Error("expected lviv to be evicted")
+	}
+	if _, ok := c.items["kyiv"]; !ok {
+		t.Error("expected kyiv to be kept")
+	}
+
+	calls.Store(0)
+	c.Load("lviv", time.Minute, countingLoad(&calls, "lviv", nil))
+	if calls.Load() != 1 {
+		t.Errorf("expected the evicted key to be loaded again")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantLoads int32
+	}{
+		{name: "errors with a TTL are cached", err: fmt.Errorf("kyiv: %w", errNotFound), wantLoads: 1},
+		{name: "other errors are not cached", err: errors.New("provider unavailable"), wantLoads: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[int](10, notFoundTTL)
+			var calls atomic.Int32
+
+			for range 3 {
+				_, err := c.Load("kyiv", time.Minute, countingLoad(&calls, 0, tt.err))
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+			}
+
+			if calls.Load() != tt.wantLoads {
+				t.Errorf("expected %d loads, got %d", tt.wantLoads, calls.Load())
+			}
+		})
+	}
+}
+
+func TestLoadErrorTTLOverridesMaxAge(t *testing.T) {
+	c := New[int](10, func(error) time.Duration { return 10 * time.Millisecond })
+	var calls atomic.Int32
+
+	c.Load("kyiv", time.Hour, countingLoad(&calls, 0, errNotFound))
+	time.Sleep(20 * time.Millisecond)
+	c.Load("kyiv", time.Hour, countingLoad(&calls, 0, errNotFound))
+
+	if calls.Load() != 2 {
+		t.Errorf("expected the expired error to be loaded again, got %d loads", calls.Load())
+	}
+}
+
+func TestLoadConcurrentCallsShareOneLoad(t *testing.T) {
+	c := New[int](10, nil)
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	load := func() (int, error) {
+		calls.Add(1)
+		<-release
+		return 1, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	values := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], _ = c.Load("kyiv", time.Minute, load)
+		}()
+	}
+
+	// Wait until the first caller runs load, the others wait for it.
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 load, got %d", calls.Load())
+	}
+	for i, value := range values {
+		if value != 1 {
+			t.Errorf("caller %d got %d", i, value)
+		}
+	}
+}
+
+func TestLoadPanicReleasesWaiters(t *testing.T) {
+	c := New[int](10, nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		c.Load("kyiv", time.Minute, func() (int, error) {
+			close(started)
+			<-release
+			panic("provider client bug")
+		})
+	}()
+	<-started
+
+	waiterErr := make(chan error)
+	go func() {
+		_, err := c.Load("kyiv", time.Minute, func() (int, error) { return 1, nil })
+		waiterErr <- err
+	}()
+
+	// Give the waiter time to join the panicking call.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-waiterErr:
+		if err != nil && !errors.Is(err, ErrLoadPanicked) {
+			t.Errorf("expected %v, got %v", ErrLoadPanicked, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after the load panicked")
+	}
+
+	value, err := c.Load("kyiv", time.Minute, func() (int, error) { return 2, nil })
+	if err != nil || value != 2 {
+		t.Errorf("expected a new load after the panic, got %v, %v", value, err)
+	}
+}
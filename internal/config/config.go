@@ -3,16 +3,22 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+// Config BaseURL is the host (and port) links in emails point to,
+// BaseURLScheme is http or https.
 type Config struct {
-	BaseURL string
+	BaseURL       string
+	BaseURLScheme string
 	*ServerConfig
 	*JobsConfig
 	*WeatherServiceConfig
+	*WeatherCacheConfig
 	*EmailServiceConfig
+	*AuthConfig
 	*DatabaseConfig
 	*CORSConfig
 }
@@ -24,22 +30,80 @@ type ServerConfig struct {
 	WriteTimeout int
 }
 
+// JobsConfig intervals and cooldowns are in minutes, except EmailOutboxInterval
+// which is in seconds. EmailMaxAttempts is how many times an email is tried
+// before it is given up on.
+// EmailSendConcurrency and ReportFetchConcurrency limit how many emails
+// are sent and how many weather lookups of the report and alert jobs
+// run at once.
 type JobsConfig struct {
-	EmailConfirmationInterval int
+	EmailOutboxInterval        int
+	EmailMaxAttempts           int
+	EmailSendConcurrency       int
+	ReportFetchConcurrency     int
+	AlertCheckInterval         int
+	AlertCooldown              int
+	UnconfirmedCleanupInterval int
 }
 
 type WeatherServiceConfig struct {
-	ApiKey      string
-	HttpTimeout int
+	Providers            []string
+	ApiKey               string
+	OpenWeatherMapApiKey string
+	HttpTimeout          int
 }
 
+// WeatherCacheConfig holds TTLs in seconds for cached weather lookups.
+// Report jobs use the TTL of their frequency, everything else uses DefaultTTL.
+type WeatherCacheConfig struct {
+	Size        int
+	DefaultTTL  int
+	HourlyTTL   int
+	DailyTTL    int
+	NotFoundTTL int
+	SearchTTL   int
+}
+
+// EmailServiceConfig Transport chooses how emails are delivered: smtp, http,
+// file or log. Host to IdleTimeout configure smtp, HttpURL and HttpApiKey
+// the http one and FileDirectory the file one. IdleTimeout is in seconds,
+// connections idle for longer are not reused. MaxMessagesPerConnection
+// of zero does not limit them. Templates in TemplatesDirectory replace
+// the embedded ones, ReloadTemplates checks it for changes every
+// TemplatesReloadInterval seconds.
 type EmailServiceConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
-	From     string
-	SSL      bool
+	Transport                string
+	Host                     string
+	Port                     int
+	Username                 string
+	Password                 string
+	From                     string
+	SSL                      bool
+	MaxConnections           int
+	MaxMessagesPerConnection int
+	IdleTimeout              int
+	HttpURL                  string
+	HttpApiKey               string
+	FileDirectory            string
+	TemplatesDirectory       string
+	ReloadTemplates          bool
+	TemplatesReloadInterval  int
+}
+
+// AuthConfig TTLs are in minutes. Secret signs sessions and email links,
+// it is required, so links that were sent keep working after a restart.
+// Addresses that are not confirmed within ConfirmationTTL are deleted.
+// RotateConfirmationToken invalidates earlier confirmation links on resend.
+// EmailLinkTTL applies to the manage and unsubscribe links of emails.
+type AuthConfig struct {
+	Secret                     string
+	ConfirmationTTL            int
+	ConfirmationResendsPerHour int
+	RotateConfirmationToken    bool
+	LoginLinkTTL               int
+	SessionTTL                 int
+	LoginLinksPerHour          int
+	EmailLinkTTL               int
 }
 
 type DatabaseConfig struct {
@@ -66,6 +130,12 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("missing required environment variable: WAPP_BASE_URL")
 	}
 	config.BaseURL = baseURL
+	if scheme := os.Getenv("WAPP_BASE_URL_SCHEME"); scheme != "" {
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("malformed environment variable WAPP_BASE_URL_SCHEME: %q is not http or https", scheme)
+		}
+		config.BaseURLScheme = scheme
+	}
 
 	if addr := os.Getenv("WAPP_SERVER_ADDRESS"); addr != "" {
 		config.ServerConfig.Address = addr
@@ -92,18 +162,82 @@ func LoadConfig() (*Config, error) {
 		config.ServerConfig.WriteTimeout = wrt
 	}
 
-	if emailConfirmationInterval := os.Getenv("WAPP_EMAIL_CONFIRMATION_INTERVAL"); emailConfirmationInterval != "" {
-		eci, err := strconv.Atoi(emailConfirmationInterval)
+	// WAPP_EMAIL_CONFIRMATION_INTERVAL is the name the outbox interval had
+	// when only confirmation emails were queued, it is still read in minutes.
+	if outboxInterval := os.Getenv("WAPP_EMAIL_OUTBOX_INTERVAL"); outboxInterval != "" {
+		oi, err := strconv.Atoi(outboxInterval)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_OUTBOX_INTERVAL: %w", err)
+		}
+		config.JobsConfig.EmailOutboxInterval = oi
+	} else if confirmationInterval := os.Getenv("WAPP_EMAIL_CONFIRMATION_INTERVAL"); confirmationInterval != "" {
+		ci, err := strconv.Atoi(confirmationInterval)
 		if err != nil {
 			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_CONFIRMATION_INTERVAL: %w", err)
 		}
-		config.JobsConfig.EmailConfirmationInterval = eci
+		config.JobsConfig.EmailOutboxInterval = ci * 60
+	}
+	if emailMaxAttempts := os.Getenv("WAPP_EMAIL_MAX_ATTEMPTS"); emailMaxAttempts != "" {
+		ema, err := strconv.Atoi(emailMaxAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_MAX_ATTEMPTS: %w", err)
+		}
+		config.JobsConfig.EmailMaxAttempts = ema
+	}
+	if emailSendConcurrency := os.Getenv("WAPP_EMAIL_SEND_CONCURRENCY"); emailSendConcurrency != "" {
+		esc, err := strconv.Atoi(emailSendConcurrency)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_SEND_CONCURRENCY: %w", err)
+		}
+		config.JobsConfig.EmailSendConcurrency = esc
+	}
+	if reportFetchConcurrency := os.Getenv("WAPP_REPORT_FETCH_CONCURRENCY"); reportFetchConcurrency != "" {
+		rfc, err := strconv.Atoi(reportFetchConcurrency)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_REPORT_FETCH_CONCURRENCY: %w", err)
+		}
+		config.JobsConfig.ReportFetchConcurrency = rfc
+	}
+	if alertCheckInterval := os.Getenv("WAPP_ALERT_CHECK_INTERVAL"); alertCheckInterval != "" {
+		aci, err := strconv.Atoi(alertCheckInterval)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_ALERT_CHECK_INTERVAL: %w", err)
+		}
+		config.JobsConfig.AlertCheckInterval = aci
+	}
+	if alertCooldown := os.Getenv("WAPP_ALERT_COOLDOWN"); alertCooldown != "" {
+		ac, err := strconv.Atoi(alertCooldown)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_ALERT_COOLDOWN: %w", err)
+		}
+		config.JobsConfig.AlertCooldown = ac
+	}
+	if cleanupInterval := os.Getenv("WAPP_UNCONFIRMED_CLEANUP_INTERVAL"); cleanupInterval != "" {
+		ci, err := strconv.Atoi(cleanupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_UNCONFIRMED_CLEANUP_INTERVAL: %w", err)
+		}
+		config.JobsConfig.UnconfirmedCleanupInterval = ci
 	}
 
+	if weatherProviders := os.Getenv("WAPP_WEATHER_PROVIDERS"); weatherProviders != "" {
+		providers := make([]string, 0)
+		for _, provider := range strings.Split(weatherProviders, ",") {
+			provider = strings.TrimSpace(provider)
+			if provider != "" {
+				providers = append(providers, provider)
+			}
+		}
+		config.WeatherServiceConfig.Providers = providers
+	}
 	apiKey := os.Getenv("WAPP_WEATHER_API_KEY")
-	if apiKey == "" {
+	if apiKey == "" && slices.Contains(config.WeatherServiceConfig.Providers, "weatherapi") {
 		return nil, fmt.Errorf("missing required environment variable: WAPP_WEATHER_API_KEY")
 	}
+	openWeatherMapApiKey := os.Getenv("WAPP_OPENWEATHERMAP_API_KEY")
+	if openWeatherMapApiKey == "" && slices.Contains(config.WeatherServiceConfig.Providers, "openweathermap") {
+		return nil, fmt.Errorf("missing required environment variable: WAPP_OPENWEATHERMAP_API_KEY")
+	}
 	if weatherApiHttpTimeout := os.Getenv("WAPP_WEATHER_API_HTTP_TIMEOUT"); weatherApiHttpTimeout != "" {
 		httpTimeout, err := strconv.Atoi(weatherApiHttpTimeout)
 		if err != nil {
@@ -113,6 +247,50 @@ func LoadConfig() (*Config, error) {
 	}
 
 	config.WeatherServiceConfig.ApiKey = apiKey
+	config.WeatherServiceConfig.OpenWeatherMapApiKey = openWeatherMapApiKey
+
+	if cacheSize := os.Getenv("WAPP_WEATHER_CACHE_SIZE"); cacheSize != "" {
+		size, err := strconv.Atoi(cacheSize)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_SIZE: %w", err)
+		}
+		config.WeatherCacheConfig.Size = size
+	}
+	if cacheTTL := os.Getenv("WAPP_WEATHER_CACHE_TTL"); cacheTTL != "" {
+		ttl, err := strconv.Atoi(cacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_TTL: %w", err)
+		}
+		config.WeatherCacheConfig.DefaultTTL = ttl
+	}
+	if cacheHourlyTTL := os.Getenv("WAPP_WEATHER_CACHE_HOURLY_TTL"); cacheHourlyTTL != "" {
+		ttl, err := strconv.Atoi(cacheHourlyTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_HOURLY_TTL: %w", err)
+		}
+		config.WeatherCacheConfig.HourlyTTL = ttl
+	}
+	if cacheDailyTTL := os.Getenv("WAPP_WEATHER_CACHE_DAILY_TTL"); cacheDailyTTL != "" {
+		ttl, err := strconv.Atoi(cacheDailyTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_DAILY_TTL: %w", err)
+		}
+		config.WeatherCacheConfig.DailyTTL = ttl
+	}
+	if cacheNotFoundTTL := os.Getenv("WAPP_WEATHER_CACHE_NOT_FOUND_TTL"); cacheNotFoundTTL != "" {
+		ttl, err := strconv.Atoi(cacheNotFoundTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_NOT_FOUND_TTL: %w", err)
+		}
+		config.WeatherCacheConfig.NotFoundTTL = ttl
+	}
+	if cacheSearchTTL := os.Getenv("WAPP_WEATHER_CACHE_SEARCH_TTL"); cacheSearchTTL != "" {
+		ttl, err := strconv.Atoi(cacheSearchTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_WEATHER_CACHE_SEARCH_TTL: %w", err)
+		}
+		config.WeatherCacheConfig.SearchTTL = ttl
+	}
 
 	if emailHost := os.Getenv("WAPP_EMAIL_HOST"); emailHost != "" {
 		config.EmailServiceConfig.Host = emailHost
@@ -124,13 +302,16 @@ func LoadConfig() (*Config, error) {
 		}
 		config.EmailServiceConfig.Port = port
 	}
+	if emailTransport := os.Getenv("WAPP_EMAIL_TRANSPORT"); emailTransport != "" {
+		config.EmailServiceConfig.Transport = emailTransport
+	}
 	emailUsername := os.Getenv("WAPP_EMAIL_USERNAME")
-	if emailUsername == "" {
+	if emailUsername == "" && config.EmailServiceConfig.Transport == "smtp" {
 		return nil, fmt.Errorf("missing required environment variable: WAPP_EMAIL_USERNAME")
 	}
 	config.EmailServiceConfig.Username = emailUsername
 	emailPassword := os.Getenv("WAPP_EMAIL_PASSWORD")
-	if emailPassword == "" {
+	if emailPassword == "" && config.EmailServiceConfig.Transport == "smtp" {
 		return nil, fmt.Errorf("missing required environment variable: WAPP_EMAIL_PASSWORD")
 	}
 	config.EmailServiceConfig.Password = emailPassword
@@ -146,6 +327,109 @@ func LoadConfig() (*Config, error) {
 		}
 		config.EmailServiceConfig.SSL = emailSSLBool
 	}
+	if maxConnections := os.Getenv("WAPP_EMAIL_MAX_CONNECTIONS"); maxConnections != "" {
+		mc, err := strconv.Atoi(maxConnections)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_MAX_CONNECTIONS: %w", err)
+		}
+		config.EmailServiceConfig.MaxConnections = mc
+	}
+	if maxMessages := os.Getenv("WAPP_EMAIL_MAX_MESSAGES_PER_CONNECTION"); maxMessages != "" {
+		mm, err := strconv.Atoi(maxMessages)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_MAX_MESSAGES_PER_CONNECTION: %w", err)
+		}
+		config.EmailServiceConfig.MaxMessagesPerConnection = mm
+	}
+	if idleTimeout := os.Getenv("WAPP_EMAIL_IDLE_TIMEOUT"); idleTimeout != "" {
+		it, err := strconv.Atoi(idleTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_IDLE_TIMEOUT: %w", err)
+		}
+		config.EmailServiceConfig.IdleTimeout = it
+	}
+	emailHttpURL := os.Getenv("WAPP_EMAIL_HTTP_URL")
+	if emailHttpURL == "" && config.EmailServiceConfig.Transport == "http" {
+		return nil, fmt.Errorf("missing required environment variable: WAPP_EMAIL_HTTP_URL")
+	}
+	config.EmailServiceConfig.HttpURL = emailHttpURL
+	config.EmailServiceConfig.HttpApiKey = os.Getenv("WAPP_EMAIL_HTTP_API_KEY")
+	if emailFileDir := os.Getenv("WAPP_EMAIL_FILE_DIR"); emailFileDir != "" {
+		config.EmailServiceConfig.FileDirectory = emailFileDir
+	}
+	config.EmailServiceConfig.TemplatesDirectory = os.Getenv("WAPP_EMAIL_TEMPLATES_DIR")
+	if reloadTemplates := os.Getenv("WAPP_EMAIL_TEMPLATES_RELOAD"); reloadTemplates != "" {
+		reload, err := strconv.ParseBool(reloadTemplates)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_TEMPLATES_RELOAD: %w", err)
+		}
+		config.EmailServiceConfig.ReloadTemplates = reload
+	}
+	if reloadInterval := os.Getenv("WAPP_EMAIL_TEMPLATES_RELOAD_INTERVAL"); reloadInterval != "" {
+		ri, err := strconv.Atoi(reloadInterval)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_TEMPLATES_RELOAD_INTERVAL: %w", err)
+		}
+		config.EmailServiceConfig.TemplatesReloadInterval = ri
+	}
+	if config.EmailServiceConfig.ReloadTemplates && config.EmailServiceConfig.TemplatesDirectory == "" {
+		return nil, fmt.Errorf("missing required environment variable: WAPP_EMAIL_TEMPLATES_DIR")
+	}
+
+	secret := os.Getenv("WAPP_AUTH_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("missing required environment variable: WAPP_AUTH_SECRET")
+	}
+	config.AuthConfig.Secret = secret
+	if confirmationTTL := os.Getenv("WAPP_CONFIRMATION_TTL"); confirmationTTL != "" {
+		ttl, err := strconv.Atoi(confirmationTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_CONFIRMATION_TTL: %w", err)
+		}
+		config.AuthConfig.ConfirmationTTL = ttl
+	}
+	if resendsPerHour := os.Getenv("WAPP_CONFIRMATION_RESENDS_PER_HOUR"); resendsPerHour != "" {
+		limit, err := strconv.Atoi(resendsPerHour)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_CONFIRMATION_RESENDS_PER_HOUR: %w", err)
+		}
+		config.AuthConfig.ConfirmationResendsPerHour = limit
+	}
+	if rotateToken := os.Getenv("WAPP_CONFIRMATION_ROTATE_TOKEN"); rotateToken != "" {
+		rotateTokenBool, err := strconv.ParseBool(rotateToken)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_CONFIRMATION_ROTATE_TOKEN: %w", err)
+		}
+		config.AuthConfig.RotateConfirmationToken = rotateTokenBool
+	}
+	if loginLinkTTL := os.Getenv("WAPP_LOGIN_LINK_TTL"); loginLinkTTL != "" {
+		ttl, err := strconv.Atoi(loginLinkTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_LOGIN_LINK_TTL: %w", err)
+		}
+		config.AuthConfig.LoginLinkTTL = ttl
+	}
+	if sessionTTL := os.Getenv("WAPP_SESSION_TTL"); sessionTTL != "" {
+		ttl, err := strconv.Atoi(sessionTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_SESSION_TTL: %w", err)
+		}
+		config.AuthConfig.SessionTTL = ttl
+	}
+	if emailLinkTTL := os.Getenv("WAPP_EMAIL_LINK_TTL"); emailLinkTTL != "" {
+		ttl, err := strconv.Atoi(emailLinkTTL)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_EMAIL_LINK_TTL: %w", err)
+		}
+		config.AuthConfig.EmailLinkTTL = ttl
+	}
+	if loginLinksPerHour := os.Getenv("WAPP_LOGIN_LINKS_PER_HOUR"); loginLinksPerHour != "" {
+		limit, err := strconv.Atoi(loginLinksPerHour)
+		if err != nil {
+			return nil, fmt.Errorf("malformed environment variable WAPP_LOGIN_LINKS_PER_HOUR: %w", err)
+		}
+		config.AuthConfig.LoginLinksPerHour = limit
+	}
 
 	if dbHost := os.Getenv("WAPP_DB_HOST"); dbHost != "" {
 		config.DatabaseConfig.Host = dbHost
@@ -196,6 +480,7 @@ func LoadConfig() (*Config, error) {
 
 func getDefaultConfig() *Config {
 	return &Config{
+		BaseURLScheme: "https",
 		ServerConfig: &ServerConfig{
 			Address:      "localhost",
 			Port:         8080,
@@ -203,16 +488,46 @@ func getDefaultConfig() *Config {
 			WriteTimeout: 10,
 		},
 		JobsConfig: &JobsConfig{
-			EmailConfirmationInterval: 1,
+			EmailOutboxInterval:        10,
+			EmailMaxAttempts:           3,
+			EmailSendConcurrency:       4,
+			ReportFetchConcurrency:     8,
+			AlertCheckInterval:         30,
+			AlertCooldown:              360,
+			UnconfirmedCleanupInterval: 60,
 		},
 		WeatherServiceConfig: &WeatherServiceConfig{
-			ApiKey:      "",
-			HttpTimeout: 3,
+			Providers:            []string{"weatherapi"},
+			ApiKey:               "",
+			OpenWeatherMapApiKey: "",
+			HttpTimeout:          3,
+		},
+		WeatherCacheConfig: &WeatherCacheConfig{
+			Size:        1000,
+			DefaultTTL:  300,
+			HourlyTTL:   900,
+			DailyTTL:    1800,
+			NotFoundTTL: 3600,
+			SearchTTL:   86400,
 		},
 		EmailServiceConfig: &EmailServiceConfig{
-			Host: "smtp.gmail.com",
-			Port: 587,
-			SSL:  true,
+			Transport:                "smtp",
+			Host:                     "smtp.gmail.com",
+			Port:                     587,
+			SSL:                      true,
+			MaxConnections:           4,
+			MaxMessagesPerConnection: 100,
+			IdleTimeout:              30,
+			FileDirectory:            "./emails",
+			TemplatesReloadInterval:  2,
+		},
+		AuthConfig: &AuthConfig{
+			ConfirmationTTL:            2880,
+			ConfirmationResendsPerHour: 3,
+			LoginLinkTTL:               15,
+			SessionTTL:                 1440,
+			LoginLinksPerHour:          3,
+			EmailLinkTTL:               129600,
 		},
 		DatabaseConfig: &DatabaseConfig{
 			Host:            "localhost",
@@ -224,7 +539,7 @@ func getDefaultConfig() *Config {
 		},
 		CORSConfig: &CORSConfig{
 			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 			AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
 			AllowCredentials: false,
 		},
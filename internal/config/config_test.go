@@ -0,0 +1,150 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+// setRequiredEnv sets the variables LoadConfig cannot do without.
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("WAPP_BASE_URL", "localhost:8080")
+	t.Setenv("WAPP_AUTH_SECRET", "secret")
+	t.Setenv("WAPP_WEATHER_API_KEY", "weather-api-key")
+	t.Setenv("WAPP_EMAIL_USERNAME", "user")
+	t.Setenv("WAPP_EMAIL_PASSWORD", "password")
+	t.Setenv("WAPP_EMAIL_FROM", "from@example.com")
+}
+
+func TestLoadConfigWeatherProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers string
+		want      []string
+	}{
+		{name: "single", providers: "openmeteo", want: []string{"openmeteo"}},
+		{name: "spaces around names", providers: "weatherapi, openmeteo", want: []string{"weatherapi", "openmeteo"}},
+		{name: "empty entries", providers: " weatherapi,,openmeteo , ", want: []string{"weatherapi", "openmeteo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("WAPP_WEATHER_PROVIDERS", tt.providers)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(cfg.WeatherServiceConfig.Providers, tt.want) {
+				t.Errorf("expected providers %q, got %q", tt.want, cfg.WeatherServiceConfig.Providers)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRequiresKeysOfTrimmedProviders(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("WAPP_WEATHER_PROVIDERS", "openmeteo, openweathermap")
+	t.Setenv("WAPP_OPENWEATHERMAP_API_KEY", "")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("expected an error for the missing WAPP_OPENWEATHERMAP_API_KEY")
+	}
+}
+
+func TestLoadConfigAllowsPatchByDefault(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(cfg.CORSConfig.AllowMethods, "PATCH") {
+		t.Errorf("expected PATCH in the default allowed methods, got %v", cfg.CORSConfig.AllowMethods)
+	}
+}
+
+func TestLoadConfigRequiresAuthSecret(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("WAPP_AUTH_SECRET", "")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("expected an error for the missing WAPP_AUTH_SECRET")
+	}
+}
+
+func TestLoadConfigBaseURLScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		scheme  string
+		want    string
+		wantErr bool
+	}{
+		{name: "https by default", scheme: "", want: "https"},
+		{name: "http for local use", scheme: "http", want: "http"},
+		{name: "unknown scheme", scheme: "ftp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("WAPP_BASE_URL_SCHEME", tt.scheme)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.BaseURLScheme != tt.want {
+				t.Errorf("expected scheme %q, got %q", tt.want, cfg.BaseURLScheme)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEmailOutboxInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		interval    string
+		oldInterval string
+		want        int
+		wantErr     bool
+	}{
+		{name: "default", want: 10},
+		{name: "in seconds", interval: "30", want: 30},
+		{name: "old variable in minutes", oldInterval: "2", want: 120},
+		{name: "new variable first", interval: "5", oldInterval: "2", want: 5},
+		{name: "malformed", interval: "often", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("WAPP_EMAIL_OUTBOX_INTERVAL", tt.interval)
+			t.Setenv("WAPP_EMAIL_CONFIRMATION_INTERVAL", tt.oldInterval)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.JobsConfig.EmailOutboxInterval != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, cfg.JobsConfig.EmailOutboxInterval)
+			}
+		})
+	}
+}
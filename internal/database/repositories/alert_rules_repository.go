@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+type AlertRulesRepository interface {
+	StoreAlertRulesContext(ctx context.Context, subscriptionId int, rules []models.AlertRule) error
+	GetAlertRulesBySubscriptionContext(ctx context.Context, subscriptionId int) ([]models.AlertRule, error)
+	DeleteAlertRulesBySubscriptionContext(ctx context.Context, subscriptionId int) error
+}
+
+func NewAlertRulesRepository(db database.Database) AlertRulesRepository {
+	return &alertRulesRepository{db: db}
+}
+
+type alertRulesRepository struct {
+	db database.Database
+}
+
+func (r *alertRulesRepository) StoreAlertRulesContext(
+	ctx context.Context,
+	subscriptionId int,
+	rules []models.AlertRule,
+) error {
+	for _, rule := range rules {
+		_, err := r.db.ExecContext(
+			ctx,
+			`INSERT INTO subscription_alert_rules (subscription_id, metric, operator, threshold)
+			VALUES ($1, $2, $3, $4)`,
+			subscriptionId,
+			rule.Metric,
+			rule.Operator,
+			rule.Threshold,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *alertRulesRepository) GetAlertRulesBySubscriptionContext(
+	ctx context.Context,
+	subscriptionId int,
+) ([]models.AlertRule, error) {
+	ruleRows, err := r.db.QueryContext(
+		ctx,
+		`SELECT id, subscription_id, metric, operator, threshold
+		FROM subscription_alert_rules
+		WHERE subscription_id = $1
+		ORDER BY id`,
+		subscriptionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer ruleRows.Close()
+
+	var rules []models.AlertRule
+	for ruleRows.Next() {
+		var rule models.AlertRule
+		err := ruleRows.Scan(
+			&rule.Id,
+			&rule.SubscriptionId,
+			&rule.Metric,
+			&rule.Operator,
+			&rule.Threshold,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (r *alertRulesRepository) DeleteAlertRulesBySubscriptionContext(ctx context.Context, subscriptionId int) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM subscription_alert_rules WHERE subscription_id = $1",
+		subscriptionId,
+	)
+	return err
+}
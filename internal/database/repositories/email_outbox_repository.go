@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+type EmailOutboxRepository interface {
+	EnqueueEmailContext(ctx context.Context, email models.OutboxEmail) error
+	// ClaimEmailsToSendContext marks due emails as sending until leaseUntil
+	// and counts the attempt, so other workers do not send them meanwhile.
+	// Emails whose lease ended without a result are due again.
+	ClaimEmailsToSendContext(
+		ctx context.Context,
+		now time.Time,
+		leaseUntil time.Time,
+		limit int,
+	) ([]models.OutboxEmail, error)
+	// UpdateClaimedEmailContext records the result of a claimed email,
+	// it changes nothing when the email is not claimed anymore.
+	UpdateClaimedEmailContext(ctx context.Context, email models.OutboxEmail) error
+	// CountEmailsSinceContext counts emails of the type queued
+	// for the address since the given time.
+	CountEmailsSinceContext(
+		ctx context.Context,
+		emailType models.EmailType,
+		toAddress string,
+		since time.Time,
+	) (int, error)
+	// HasPendingConfirmationEmailContext reports whether an email with the token
+	// is still going to be sent.
+	HasPendingConfirmationEmailContext(ctx context.Context, token uuid.UUID) (bool, error)
+	// CancelConfirmationEmailsContext stops sending emails with the token.
+	CancelConfirmationEmailsContext(ctx context.Context, token uuid.UUID) error
+}
+
+func NewEmailOutboxRepository(db database.Database) EmailOutboxRepository {
+	return &emailOutboxRepository{db: db}
+}
+
+type emailOutboxRepository struct {
+	db database.Database
+}
+
+func (r *emailOutboxRepository) EnqueueEmailContext(ctx context.Context, email models.OutboxEmail) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO email_outbox (type, to_address, payload, status, next_try_after)
+		VALUES ($1, $2, $3, $4, $5)`,
+		email.Type,
+		email.ToAddress,
+		string(email.Payload),
+		email.Status,
+		email.NextTryAfter,
+	)
+	return err
+}
+
+func (r *emailOutboxRepository) ClaimEmailsToSendContext(
+	ctx context.Context,
+	now time.Time,
+	leaseUntil time.Time,
+	limit int,
+) ([]models.OutboxEmail, error) {
+	emailRows, err := r.db.QueryContext(
+		ctx,
+		`UPDATE email_outbox
+		SET status = $1, attempts = attempts + 1, next_try_after = $2
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ($1, $3) AND next_try_after <= $4
+			ORDER BY next_try_after
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, type, to_address, payload, status, attempts, last_error, next_try_after, created_at, sent_at`,
+		models.SendingEmail,
+		leaseUntil,
+		models.PendingEmail,
+		now,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer emailRows.Close()
+
+	var emails []models.OutboxEmail
+	for emailRows.Next() {
+		var email models.OutboxEmail
+		var lastError sql.NullString
+		err := emailRows.Scan(
+			&email.Id,
+			&email.Type,
+			&email.ToAddress,
+			&email.Payload,
+			&email.Status,
+			&email.Attempts,
+			&lastError,
+			&email.NextTryAfter,
+			&email.CreatedAt,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		email.LastError = lastError.String
+		emails = append(emails, email)
+	}
+
+	return emails, emailRows.Err()
+}
+
+func (r *emailOutboxRepository) UpdateClaimedEmailContext(ctx context.Context, email models.OutboxEmail) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE email_outbox
+		SET status = $1, attempts = $2, last_error = NULLIF($3, ''), next_try_after = $4, sent_at = $5
+		WHERE id = $6 AND status = $7`,
+		email.Status,
+		email.Attempts,
+		email.LastError,
+		email.NextTryAfter,
+		email.SentAt,
+		email.Id,
+		models.SendingEmail,
+	)
+	return err
+}
+
+func (r *emailOutboxRepository) CountEmailsSinceContext(
+	ctx context.Context,
+	emailType models.EmailType,
+	toAddress string,
+	since time.Time,
+) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM email_outbox WHERE type = $1 AND to_address = $2 AND created_at >= $3",
+		emailType,
+		toAddress,
+		since,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *emailOutboxRepository) HasPendingConfirmationEmailContext(
+	ctx context.Context,
+	token uuid.UUID,
+) (bool, error) {
+	var pending bool
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM email_outbox
+			WHERE type = $1 AND payload->>'token' = $2 AND status IN ($3, $4)
+		)`,
+		models.ConfirmationEmail,
+		token.String(),
+		models.PendingEmail,
+		models.SendingEmail,
+	).Scan(&pending)
+	return pending, err
+}
+
+func (r *emailOutboxRepository) CancelConfirmationEmailsContext(ctx context.Context, token uuid.UUID) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE email_outbox SET status = $1 WHERE type = $2 AND payload->>'token' = $3 AND status = $4",
+		models.CancelledEmail,
+		models.ConfirmationEmail,
+		token.String(),
+		models.PendingEmail,
+	)
+	return err
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+type LoginLinksRepository interface {
+	// StoreLoginLinkContext returns the id of the stored link.
+	StoreLoginLinkContext(ctx context.Context, loginLink models.LoginLink) (int, error)
+	CountLoginLinksSinceContext(ctx context.Context, subscriberId int, since time.Time) (int, error)
+	GetLoginLinkContext(ctx context.Context, id int) (models.LoginLink, error)
+	// UseLoginLinkContext marks the link as used and returns its subscriber id,
+	// links can be used once and only before they expire.
+	UseLoginLinkContext(ctx context.Context, id int, now time.Time) (int, error)
+}
+
+func NewLoginLinksRepository(db database.Database) LoginLinksRepository {
+	return &loginLinksRepository{db}
+}
+
+type loginLinksRepository struct {
+	db database.Database
+}
+
+var ErrLoginLinkNotFound = errors.New("login link not found, used or expired")
+
+func (r *loginLinksRepository) StoreLoginLinkContext(ctx context.Context, loginLink models.LoginLink) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(
+		ctx,
+		`INSERT INTO login_links (subscriber_id, created_at, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		loginLink.SubscriberId,
+		loginLink.CreatedAt,
+		loginLink.ExpiresAt,
+	).Scan(&id)
+	return id, err
+}
+
+func (r *loginLinksRepository) CountLoginLinksSinceContext(
+	ctx context.Context,
+	subscriberId int,
+	since time.Time,
+) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM login_links WHERE subscriber_id = $1 AND created_at >= $2",
+		subscriberId,
+		since,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *loginLinksRepository) GetLoginLinkContext(ctx context.Context, id int) (models.LoginLink, error) {
+	var loginLink models.LoginLink
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT l.id, l.subscriber_id, sb.email, l.created_at, l.expires_at, l.used_at
+		FROM login_links l
+		JOIN subscribers sb ON sb.id = l.subscriber_id
+		WHERE l.id = $1`,
+		id,
+	).Scan(
+		&loginLink.Id,
+		&loginLink.SubscriberId,
+		&loginLink.Email,
+		&loginLink.CreatedAt,
+		&loginLink.ExpiresAt,
+		&loginLink.UsedAt,
+	)
+	return loginLink, err
+}
+
+func (r *loginLinksRepository) UseLoginLinkContext(ctx context.Context, id int, now time.Time) (int, error) {
+	var subscriberId int
+	err := r.db.QueryRowContext(
+		ctx,
+		`UPDATE login_links SET used_at = $1
+		WHERE id = $2 AND used_at IS NULL AND expires_at > $1
+		RETURNING subscriber_id`,
+		now,
+		id,
+	).Scan(&subscriberId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrLoginLinkNotFound
+	}
+	return subscriberId, err
+}
@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+type SubscribersRepository interface {
+	// GetOrCreateSubscriberContext returns the subscriber with the email, creating
+	// an unconfirmed one, which has to be confirmed before confirmationExpiresAt,
+	// when there is none. created reports which happened.
+	GetOrCreateSubscriberContext(
+		ctx context.Context,
+		email string,
+		confirmationExpiresAt time.Time,
+	) (subscriber models.Subscriber, created bool, err error)
+	GetSubscriberByTokenContext(ctx context.Context, token uuid.UUID) (models.Subscriber, error)
+	GetSubscriberByIdContext(ctx context.Context, id int) (models.Subscriber, error)
+	GetSubscriberByEmailContext(ctx context.Context, email string) (models.Subscriber, error)
+	// ConfirmSubscriberContext accepts the token of the subscriber, and the
+	// token of one of its subscriptions that confirmation links had before
+	// subscriptions were grouped by subscriber, until its grace period ends.
+	ConfirmSubscriberContext(ctx context.Context, token uuid.UUID, now time.Time) error
+	// ConfirmSubscriberByIdContext confirms a subscriber that proved
+	// the address some other way, by following a login link.
+	ConfirmSubscriberByIdContext(ctx context.Context, id int) error
+	// RotateTokenContext replaces the token, so confirmation links sent before stop working.
+	RotateTokenContext(ctx context.Context, id int, token uuid.UUID) error
+	// RenewConfirmationContext gives an unconfirmed subscriber until expiresAt.
+	RenewConfirmationContext(ctx context.Context, id int, expiresAt time.Time) error
+	// DeleteExpiredSubscribersContext deletes subscribers that were not confirmed
+	// in time with all their subscriptions and pending confirmation emails,
+	// it returns the number of deleted subscribers.
+	DeleteExpiredSubscribersContext(ctx context.Context, now time.Time) (int, error)
+	IsUserSubscribedContext(ctx context.Context, email string, location models.Location) (bool, error)
+	// IsUserSubscribedElsewhereContext is IsUserSubscribedContext ignoring
+	// the subscription with the given id, for checks before moving it.
+	IsUserSubscribedElsewhereContext(
+		ctx context.Context,
+		email string,
+		location models.Location,
+		subscriptionId int,
+	) (bool, error)
+}
+
+func NewSubscribersRepository(db database.Database) SubscribersRepository {
+	return &subscribersRepository{db}
+}
+
+type subscribersRepository struct {
+	db database.Database
+}
+
+const subscriberColumns = "id, email, token, confirmed, confirmation_expires_at"
+
+func scanSubscriber(row interface{ Scan(...any) error }) (models.Subscriber, error) {
+	var subscriber models.Subscriber
+	var confirmationExpiresAt sql.NullTime
+	err := row.Scan(
+		&subscriber.Id,
+		&subscriber.Email,
+		&subscriber.Token,
+		&subscriber.Confirmed,
+		&confirmationExpiresAt,
+	)
+	if err != nil {
+		return models.Subscriber{}, err
+	}
+	if confirmationExpiresAt.Valid {
+		subscriber.ConfirmationExpiresAt = &confirmationExpiresAt.Time
+	}
+	return subscriber, nil
+}
+
+func (r *subscribersRepository) GetOrCreateSubscriberContext(
+	ctx context.Context,
+	email string,
+	confirmationExpiresAt time.Time,
+) (models.Subscriber, bool, error) {
+	email = models.NormalizeEmail(email)
+
+	subscriber, err := scanSubscriber(r.db.QueryRowContext(
+		ctx,
+		`INSERT INTO subscribers (email, token, confirmation_expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (email) DO NOTHING
+		RETURNING `+subscriberColumns,
+		email,
+		uuid.New(),
+		confirmationExpiresAt,
+	))
+	if err == nil {
+		return subscriber, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.Subscriber{}, false, err
+	}
+
+	subscriber, err = r.GetSubscriberByEmailContext(ctx, email)
+	return subscriber, false, err
+}
+
+func (r *subscribersRepository) GetSubscriberByTokenContext(
+	ctx context.Context,
+	token uuid.UUID,
+) (models.Subscriber, error) {
+	return scanSubscriber(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+subscriberColumns+" FROM subscribers WHERE token = $1",
+		token,
+	))
+}
+
+func (r *subscribersRepository) GetSubscriberByIdContext(ctx context.Context, id int) (models.Subscriber, error) {
+	return scanSubscriber(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+subscriberColumns+" FROM subscribers WHERE id = $1",
+		id,
+	))
+}
+
+func (r *subscribersRepository) GetSubscriberByEmailContext(
+	ctx context.Context,
+	email string,
+) (models.Subscriber, error) {
+	return scanSubscriber(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+subscriberColumns+" FROM subscribers WHERE email = $1",
+		models.NormalizeEmail(email),
+	))
+}
+
+var (
+	ErrConfirmationTokenNotFound = errors.New("confirmation token not found")
+	ErrConfirmationTokenExpired  = errors.New("confirmation token expired")
+)
+
+func (r *subscribersRepository) ConfirmSubscriberContext(ctx context.Context, token uuid.UUID, now time.Time) error {
+	subscriber, err := scanSubscriber(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+subscriberColumns+" FROM subscribers WHERE token = $1"+
+			" OR id = (SELECT subscriber_id FROM user_subscriptions"+
+			" WHERE legacy_token = $1 AND legacy_token_expires_at > $2)",
+		token,
+		now,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrConfirmationTokenNotFound
+		}
+		return err
+	}
+	if subscriber.Confirmed {
+		return nil
+	}
+	if subscriber.ConfirmationExpiresAt != nil && !now.Before(*subscriber.ConfirmationExpiresAt) {
+		return ErrConfirmationTokenExpired
+	}
+
+	return r.ConfirmSubscriberByIdContext(ctx, subscriber.Id)
+}
+
+func (r *subscribersRepository) ConfirmSubscriberByIdContext(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE subscribers SET confirmed = true, confirmation_expires_at = NULL WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+func (r *subscribersRepository) RotateTokenContext(ctx context.Context, id int, token uuid.UUID) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE subscribers SET token = $1 WHERE id = $2",
+		token,
+		id,
+	)
+	return err
+}
+
+func (r *subscribersRepository) RenewConfirmationContext(ctx context.Context, id int, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE subscribers SET confirmation_expires_at = $1 WHERE id = $2 AND confirmed = false",
+		expiresAt,
+		id,
+	)
+	return err
+}
+
+func (r *subscribersRepository) DeleteExpiredSubscribersContext(ctx context.Context, now time.Time) (int, error) {
+	var deleted int
+	err := r.db.QueryRowContext(
+		ctx,
+		`WITH expired AS (
+			DELETE FROM subscribers
+			WHERE confirmed = false AND confirmation_expires_at <= $1
+			RETURNING token
+		), expired_emails AS (
+			DELETE FROM email_outbox
+			WHERE type = $2 AND payload->>'token' IN (SELECT token::TEXT FROM expired)
+		)
+		SELECT COUNT(*) FROM expired`,
+		now,
+		models.ConfirmationEmail,
+	).Scan(&deleted)
+	return deleted, err
+}
+
+// IsUserSubscribedContext treats locations closer than locationMatchDegrees as
+// the same place, since providers return slightly different coordinates
+// for the same city. Subscriptions without coordinates are matched by name.
+func (r *subscribersRepository) IsUserSubscribedContext(
+	ctx context.Context,
+	email string,
+	location models.Location,
+) (bool, error) {
+	return r.isUserSubscribed(ctx, email, location, 0)
+}
+
+func (r *subscribersRepository) IsUserSubscribedElsewhereContext(
+	ctx context.Context,
+	email string,
+	location models.Location,
+	subscriptionId int,
+) (bool, error) {
+	return r.isUserSubscribed(ctx, email, location, subscriptionId)
+}
+
+// isUserSubscribed ignores the subscription with exceptId, ids start from 1,
+// so 0 ignores nothing.
+func (r *subscribersRepository) isUserSubscribed(
+	ctx context.Context,
+	email string,
+	location models.Location,
+	exceptId int,
+) (bool, error) {
+	var exists bool
+
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM user_subscriptions s
+			JOIN subscribers sb ON sb.id = s.subscriber_id
+			WHERE sb.email = $1 AND s.id <> $6 AND (
+				(s.latitude IS NOT NULL AND ABS(s.latitude - $2) < $4 AND ABS(s.longitude - $3) < $4)
+				OR (s.latitude IS NULL AND LOWER(s.city) = LOWER($5))
+			)
+			LIMIT 1
+		)`,
+		models.NormalizeEmail(email),
+		location.Latitude,
+		location.Longitude,
+		locationMatchDegrees,
+		location.Name,
+		exceptId,
+	).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
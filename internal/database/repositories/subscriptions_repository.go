@@ -2,7 +2,9 @@ package repositories
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kievzenit/genesis-case/internal/database"
@@ -10,24 +12,37 @@ import (
 )
 
 type SubscriptionRepository interface {
-	IsUserSubscribedContext(ctx context.Context, email string, city string) (bool, error)
-	SubscribeContext(
+	// SubscribeContext stores the subscription for its SubscriberId,
+	// Email and Confirmed come from the subscriber.
+	SubscribeContext(ctx context.Context, subscription models.Subscription) (int, error)
+	// UpdateSubscriptionContext stores the location, frequency, units, timezone
+	// and schedule of the subscription, the other fields cannot be changed.
+	UpdateSubscriptionContext(ctx context.Context, subscription models.Subscription) error
+	UnsubscribeContext(ctx context.Context, id int) error
+	// UnsubscribeByLegacyTokenContext deletes the subscription by the token
+	// unsubscribe links had before they were signed. It returns
+	// ErrLegacyTokenNotFound once the grace period of the token ended.
+	UnsubscribeByLegacyTokenContext(ctx context.Context, token uuid.UUID, now time.Time) error
+	GetSubscriptionByIdContext(ctx context.Context, id int) (models.Subscription, error)
+	GetSubscriptionsBySubscriberContext(ctx context.Context, subscriberId int) ([]models.Subscription, error)
+	// GetAlertSubscriptionsDueContext returns confirmed alert subscriptions
+	// that were not alerted since lastAlertSentBefore.
+	GetAlertSubscriptionsDueContext(
 		ctx context.Context,
-		email string,
-		token uuid.UUID,
-		city string,
-		frequency models.Frequency,
-	) error
-	ConfirmSubscriptionContext(ctx context.Context, token uuid.UUID) error
-	UnsubscribeContext(ctx context.Context, token uuid.UUID) error
-	GetSubscriptionByTokenContext(
-		ctx context.Context,
-		token uuid.UUID,
-	) (models.Subscription, error)
-	GetConfirmedSubscriptionsByFrequencyContext(
-		ctx context.Context,
-		frequency models.Frequency,
+		lastAlertSentBefore time.Time,
 	) ([]models.Subscription, error)
+	MarkAlertSentContext(ctx context.Context, id int, sentAt time.Time) error
+	// GetSubscriptionsDueForReportContext returns confirmed scheduled
+	// subscriptions whose next report is due at now.
+	GetSubscriptionsDueForReportContext(ctx context.Context, now time.Time) ([]models.Subscription, error)
+	SetNextReportAtContext(ctx context.Context, id int, nextReportAt time.Time) error
+	// PauseSubscriptionContext stops all emails of the subscription,
+	// until resumeAt or indefinitely when it is nil.
+	PauseSubscriptionContext(ctx context.Context, id int, resumeAt *time.Time) error
+	// ResumeSubscriptionContext sets nextReportAt, so reports missed
+	// while the subscription was paused are not sent at once.
+	ResumeSubscriptionContext(ctx context.Context, id int, nextReportAt *time.Time) error
+	GetSubscriptionsToResumeContext(ctx context.Context, now time.Time) ([]models.Subscription, error)
 }
 
 func NewSubscriptionRepository(db database.Database) SubscriptionRepository {
@@ -38,69 +53,218 @@ type subscriptionRepository struct {
 	db database.Database
 }
 
-func (r *subscriptionRepository) GetSubscriptionByTokenContext(
-	ctx context.Context,
-	token uuid.UUID,
-) (models.Subscription, error) {
-	subscriptionRow := r.db.QueryRowContext(
-		ctx,
-		`SELECT id, confirmed, email, city, frequency_id
-		FROM user_subscriptions
-		WHERE token = $1
-		LIMIT 1`,
-		token,
-	)
+const locationMatchDegrees = 0.05
+
+// locationColumns scans the nullable location columns of user_subscriptions.
+type locationColumns struct {
+	region    sql.NullString
+	country   sql.NullString
+	latitude  sql.NullFloat64
+	longitude sql.NullFloat64
+}
+
+func (c locationColumns) toLocation(city string) *models.Location {
+	if !c.latitude.Valid || !c.longitude.Valid {
+		return nil
+	}
+
+	return &models.Location{
+		Name:      city,
+		Region:    c.region.String,
+		Country:   c.country.String,
+		Latitude:  c.latitude.Float64,
+		Longitude: c.longitude.Float64,
+	}
+}
+
+// scheduleColumns scans the nullable schedule columns of user_subscriptions.
+type scheduleColumns struct {
+	deliveryTime     sql.NullString
+	weekday          sql.NullInt16
+	cronExpression   sql.NullString
+	quietHoursStart  sql.NullString
+	quietHoursEnd    sql.NullString
+	overnightSummary bool
+	nextReportAt     sql.NullTime
+}
+
+func newScheduleColumns(subscription models.Subscription) scheduleColumns {
+	var c scheduleColumns
+	switch subscription.Frequency {
+	case models.Daily:
+		c.deliveryTime = sql.NullString{String: subscription.DeliveryTime.String(), Valid: true}
+	case models.Weekly:
+		c.deliveryTime = sql.NullString{String: subscription.DeliveryTime.String(), Valid: true}
+		c.weekday = sql.NullInt16{Int16: int16(subscription.Weekday), Valid: true}
+	case models.Custom:
+		c.cronExpression = sql.NullString{String: subscription.CronExpression, Valid: true}
+	}
+	if subscription.QuietHours != nil {
+		c.quietHoursStart = sql.NullString{String: subscription.QuietHours.Start.String(), Valid: true}
+		c.quietHoursEnd = sql.NullString{String: subscription.QuietHours.End.String(), Valid: true}
+		c.overnightSummary = subscription.OvernightSummary
+	}
+	if subscription.NextReportAt != nil {
+		c.nextReportAt = sql.NullTime{Time: *subscription.NextReportAt, Valid: true}
+	}
+	return c
+}
+
+func (c scheduleColumns) applyTo(subscription *models.Subscription) error {
+	if c.deliveryTime.Valid {
+		deliveryTime, err := parseTimeColumn(c.deliveryTime.String)
+		if err != nil {
+			return err
+		}
+		subscription.DeliveryTime = deliveryTime
+	}
+	subscription.Weekday = time.Weekday(c.weekday.Int16)
+	subscription.CronExpression = c.cronExpression.String
+	if c.quietHoursStart.Valid && c.quietHoursEnd.Valid {
+		start, err := parseTimeColumn(c.quietHoursStart.String)
+		if err != nil {
+			return err
+		}
+		end, err := parseTimeColumn(c.quietHoursEnd.String)
+		if err != nil {
+			return err
+		}
+		subscription.QuietHours = &models.QuietHours{Start: start, End: end}
+		subscription.OvernightSummary = c.overnightSummary
+	}
+	if c.nextReportAt.Valid {
+		nextReportAt := c.nextReportAt.Time
+		subscription.NextReportAt = &nextReportAt
+	}
+	return nil
+}
+
+// parseTimeColumn parses TIME columns, which are returned as HH:MM:SS.
+func parseTimeColumn(value string) (models.TimeOfDay, error) {
+	t, err := time.Parse("15:04:05", value)
+	if err != nil {
+		return models.TimeOfDay{}, err
+	}
+	return models.TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
 
+const subscriptionColumns = `s.id, s.subscriber_id, sb.confirmed, sb.email, s.city,
+	s.region, s.country, s.latitude, s.longitude, f.name, u.name, s.timezone,
+	s.delivery_time, s.delivery_weekday, s.cron_expression,
+	s.quiet_hours_start, s.quiet_hours_end, s.overnight_summary, s.next_report_at,
+	s.paused, s.resume_at`
+
+const subscriptionJoins = `FROM user_subscriptions s
+	JOIN subscribers sb ON sb.id = s.subscriber_id
+	JOIN frequencies f ON f.id = s.frequency_id
+	JOIN units u ON u.id = s.units_id`
+
+func scanSubscription(row interface{ Scan(...any) error }) (models.Subscription, error) {
 	var subscription models.Subscription
-	var frequencyId int
-	err := subscriptionRow.Scan(
+	var location locationColumns
+	var schedule scheduleColumns
+	var resumeAt sql.NullTime
+	err := row.Scan(
 		&subscription.Id,
+		&subscription.SubscriberId,
 		&subscription.Confirmed,
 		&subscription.Email,
 		&subscription.City,
-		&frequencyId,
+		&location.region,
+		&location.country,
+		&location.latitude,
+		&location.longitude,
+		&subscription.Frequency,
+		&subscription.Units,
+		&subscription.Timezone,
+		&schedule.deliveryTime,
+		&schedule.weekday,
+		&schedule.cronExpression,
+		&schedule.quietHoursStart,
+		&schedule.quietHoursEnd,
+		&schedule.overnightSummary,
+		&schedule.nextReportAt,
+		&subscription.Paused,
+		&resumeAt,
 	)
 	if err != nil {
 		return models.Subscription{}, err
 	}
+	subscription.Location = location.toLocation(subscription.City)
+	if resumeAt.Valid {
+		subscription.ResumeAt = &resumeAt.Time
+	}
 
-	frequencyRow := r.db.QueryRowContext(
-		ctx,
-		"SELECT name FROM frequencies WHERE id = $1 LIMIT 1",
-		frequencyId,
-	)
-	var frequencyName string
-	err = frequencyRow.Scan(&frequencyName)
+	err = schedule.applyTo(&subscription)
 	if err != nil {
 		return models.Subscription{}, err
 	}
-
-	subscription.Token = token
-	subscription.Frequency = models.Frequency(frequencyName)
 	return subscription, nil
 }
 
-func (r *subscriptionRepository) GetConfirmedSubscriptionsByFrequencyContext(
+func (r *subscriptionRepository) GetSubscriptionByIdContext(
 	ctx context.Context,
-	frequency models.Frequency,
+	id int,
+) (models.Subscription, error) {
+	return scanSubscription(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+subscriptionColumns+" "+subscriptionJoins+" WHERE s.id = $1",
+		id,
+	))
+}
+
+func (r *subscriptionRepository) GetSubscriptionsBySubscriberContext(
+	ctx context.Context,
+	subscriberId int,
+) ([]models.Subscription, error) {
+	return r.getSubscriptions(ctx, "s.subscriber_id = $1", subscriberId)
+}
+
+func (r *subscriptionRepository) GetAlertSubscriptionsDueContext(
+	ctx context.Context,
+	lastAlertSentBefore time.Time,
 ) ([]models.Subscription, error) {
-	frequencyRow := r.db.QueryRowContext(
+	return r.getConfirmedSubscriptions(
 		ctx,
-		"SELECT id FROM frequencies WHERE name = $1 LIMIT 1",
-		frequency,
+		"f.name = $1 AND (s.last_alert_sent_at IS NULL OR s.last_alert_sent_at < $2)",
+		models.Alert,
+		lastAlertSentBefore,
 	)
-	var frequencyId int
-	err := frequencyRow.Scan(&frequencyId)
-	if err != nil {
-		return nil, err
-	}
+}
+
+func (r *subscriptionRepository) GetSubscriptionsDueForReportContext(
+	ctx context.Context,
+	now time.Time,
+) ([]models.Subscription, error) {
+	return r.getConfirmedSubscriptions(ctx, "s.next_report_at <= $1", now)
+}
+
+func (r *subscriptionRepository) GetSubscriptionsToResumeContext(
+	ctx context.Context,
+	now time.Time,
+) ([]models.Subscription, error) {
+	return r.getSubscriptions(ctx, "s.paused = true AND s.resume_at <= $1", now)
+}
 
+// getConfirmedSubscriptions returns confirmed subscriptions matching
+// the condition, paused subscriptions are left out.
+func (r *subscriptionRepository) getConfirmedSubscriptions(
+	ctx context.Context,
+	condition string,
+	args ...any,
+) ([]models.Subscription, error) {
+	return r.getSubscriptions(ctx, "sb.confirmed = true AND s.paused = false AND "+condition, args...)
+}
+
+func (r *subscriptionRepository) getSubscriptions(
+	ctx context.Context,
+	condition string,
+	args ...any,
+) ([]models.Subscription, error) {
 	subscriptionRows, err := r.db.QueryContext(
 		ctx,
-		`SELECT id, token, confirmed, email, city
-		FROM user_subscriptions
-		WHERE frequency_id = $1 AND confirmed = true`,
-		frequencyId,
+		"SELECT "+subscriptionColumns+" "+subscriptionJoins+" WHERE "+condition+" ORDER BY s.id",
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -109,85 +273,164 @@ func (r *subscriptionRepository) GetConfirmedSubscriptionsByFrequencyContext(
 
 	var subscriptions []models.Subscription
 	for subscriptionRows.Next() {
-		var subscription models.Subscription
-		err := subscriptionRows.Scan(
-			&subscription.Id,
-			&subscription.Token,
-			&subscription.Confirmed,
-			&subscription.Email,
-			&subscription.City,
-		)
+		subscription, err := scanSubscription(subscriptionRows)
 		if err != nil {
 			return nil, err
 		}
-		subscription.Frequency = frequency
 		subscriptions = append(subscriptions, subscription)
 	}
 
-	return subscriptions, nil
+	return subscriptions, subscriptionRows.Err()
 }
 
-var ErrConfirmationTokenNotFound = errors.New("confirmation token not found")
+func (r *subscriptionRepository) SetNextReportAtContext(ctx context.Context, id int, nextReportAt time.Time) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE user_subscriptions SET next_report_at = $1 WHERE id = $2",
+		nextReportAt,
+		id,
+	)
+	return err
+}
 
-func (r *subscriptionRepository) ConfirmSubscriptionContext(ctx context.Context, token uuid.UUID) error {
+func (r *subscriptionRepository) MarkAlertSentContext(ctx context.Context, id int, sentAt time.Time) error {
 	_, err := r.db.ExecContext(
 		ctx,
-		"UPDATE user_subscriptions SET confirmed = true WHERE token = $1",
-		token,
+		"UPDATE user_subscriptions SET last_alert_sent_at = $1 WHERE id = $2",
+		sentAt,
+		id,
 	)
 	return err
 }
 
-func (r *subscriptionRepository) IsUserSubscribedContext(ctx context.Context, email string, city string) (bool, error) {
-	var exists bool
+// SubscribeContext stores the subscription, its Location must be resolved.
+func (r *subscriptionRepository) SubscribeContext(
+	ctx context.Context,
+	subscription models.Subscription,
+) (int, error) {
+	schedule := newScheduleColumns(subscription)
 
+	var id int
 	err := r.db.QueryRowContext(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM user_subscriptions WHERE email = $1 AND city = $2 LIMIT 1)",
-		email,
-		city,
-	).Scan(&exists)
-	if err != nil {
-		return false, err
-	}
-
-	return exists, nil
+		`INSERT INTO user_subscriptions
+			(subscriber_id, city, region, country, latitude, longitude, frequency_id, units_id, timezone,
+			delivery_time, delivery_weekday, cron_expression,
+			quiet_hours_start, quiet_hours_end, overnight_summary, next_report_at)
+		VALUES ($1, $2, $3, $4, $5, $6,
+			(SELECT id FROM frequencies WHERE name = $7),
+			(SELECT id FROM units WHERE name = $8),
+			$9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id`,
+		subscription.SubscriberId,
+		subscription.Location.Name,
+		subscription.Location.Region,
+		subscription.Location.Country,
+		subscription.Location.Latitude,
+		subscription.Location.Longitude,
+		subscription.Frequency,
+		subscription.Units,
+		subscription.Timezone,
+		schedule.deliveryTime,
+		schedule.weekday,
+		schedule.cronExpression,
+		schedule.quietHoursStart,
+		schedule.quietHoursEnd,
+		schedule.overnightSummary,
+		schedule.nextReportAt,
+	).Scan(&id)
+	return id, err
 }
 
-func (r *subscriptionRepository) SubscribeContext(
+func (r *subscriptionRepository) UpdateSubscriptionContext(
 	ctx context.Context,
-	email string,
-	token uuid.UUID,
-	city string,
-	frequency models.Frequency,
+	subscription models.Subscription,
 ) error {
-	frequencyRow := r.db.QueryRowContext(
+	schedule := newScheduleColumns(subscription)
+
+	_, err := r.db.ExecContext(
 		ctx,
-		"SELECT id FROM frequencies WHERE name = $1 LIMIT 1",
-		frequency,
+		`UPDATE user_subscriptions SET
+			city = $1, region = $2, country = $3, latitude = $4, longitude = $5,
+			frequency_id = (SELECT id FROM frequencies WHERE name = $6),
+			units_id = (SELECT id FROM units WHERE name = $7),
+			timezone = $8,
+			delivery_time = $9, delivery_weekday = $10, cron_expression = $11,
+			quiet_hours_start = $12, quiet_hours_end = $13, overnight_summary = $14,
+			next_report_at = $15
+		WHERE id = $16`,
+		subscription.Location.Name,
+		subscription.Location.Region,
+		subscription.Location.Country,
+		subscription.Location.Latitude,
+		subscription.Location.Longitude,
+		subscription.Frequency,
+		subscription.Units,
+		subscription.Timezone,
+		schedule.deliveryTime,
+		schedule.weekday,
+		schedule.cronExpression,
+		schedule.quietHoursStart,
+		schedule.quietHoursEnd,
+		schedule.overnightSummary,
+		schedule.nextReportAt,
+		subscription.Id,
 	)
-	var frequencyId int
-	err := frequencyRow.Scan(&frequencyId)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	_, err = r.db.ExecContext(
+func (r *subscriptionRepository) PauseSubscriptionContext(ctx context.Context, id int, resumeAt *time.Time) error {
+	_, err := r.db.ExecContext(
 		ctx,
-		"INSERT INTO user_subscriptions (email, token, city, frequency_id) VALUES ($1, $2, $3, $4)",
-		email,
-		token,
-		city,
-		frequencyId,
+		"UPDATE user_subscriptions SET paused = true, resume_at = $1 WHERE id = $2",
+		resumeAt,
+		id,
 	)
 	return err
 }
 
-func (r *subscriptionRepository) UnsubscribeContext(ctx context.Context, token uuid.UUID) error {
+func (r *subscriptionRepository) ResumeSubscriptionContext(ctx context.Context, id int, nextReportAt *time.Time) error {
 	_, err := r.db.ExecContext(
 		ctx,
-		"DELETE FROM user_subscriptions WHERE token = $1",
-		token,
+		"UPDATE user_subscriptions SET paused = false, resume_at = NULL, next_report_at = $1 WHERE id = $2",
+		nextReportAt,
+		id,
 	)
 	return err
 }
+
+func (r *subscriptionRepository) UnsubscribeContext(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM user_subscriptions WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+var ErrLegacyTokenNotFound = errors.New("legacy token not found")
+
+func (r *subscriptionRepository) UnsubscribeByLegacyTokenContext(
+	ctx context.Context,
+	token uuid.UUID,
+	now time.Time,
+) error {
+	result, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM user_subscriptions WHERE legacy_token = $1 AND legacy_token_expires_at > $2",
+		token,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrLegacyTokenNotFound
+	}
+	return nil
+}
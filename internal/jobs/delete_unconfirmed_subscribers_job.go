@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+)
+
+type DeleteUnconfirmedSubscribersJob struct {
+	subscribersRepository repositories.SubscribersRepository
+}
+
+func NewDeleteUnconfirmedSubscribersJob(database database.Database) *DeleteUnconfirmedSubscribersJob {
+	return &DeleteUnconfirmedSubscribersJob{
+		subscribersRepository: repositories.NewSubscribersRepository(database),
+	}
+}
+
+// Run deletes subscribers whose confirmation expired, together
+// with their subscriptions and pending confirmation emails.
+func (j *DeleteUnconfirmedSubscribersJob) Run(ctx context.Context) {
+	deleted, err := j.subscribersRepository.DeleteExpiredSubscribersContext(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("delete unconfirmed subscribers job failed: %v", err)
+		return
+	}
+
+	if deleted > 0 {
+		log.Printf("deleted %d subscribers that did not confirm their address", deleted)
+	}
+}
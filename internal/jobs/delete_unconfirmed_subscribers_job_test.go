@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteUnconfirmedSubscribersJob(t *testing.T) {
+	repository := &fakeSubscribersRepository{deleted: 2}
+	job := &DeleteUnconfirmedSubscribersJob{subscribersRepository: repository}
+
+	before := time.Now().UTC()
+	job.Run(context.Background())
+	after := time.Now().UTC()
+
+	// Confirmations that expired by the time of the run are purged.
+	if repository.deletedAt.Before(before) || repository.deletedAt.After(after) {
+		t.Errorf("expected subscribers expired by the run deleted, got %v", repository.deletedAt)
+	}
+}
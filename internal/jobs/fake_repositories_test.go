@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// fakeSubscriptionRepository serves fixed subscriptions and records the
+// changes jobs make, methods the tests do not use panic.
+type fakeSubscriptionRepository struct {
+	repositories.SubscriptionRepository
+
+	mu            sync.Mutex
+	subscriptions []models.Subscription
+	err           error
+	// dueSince is the argument of the last GetAlertSubscriptionsDueContext.
+	dueSince     time.Time
+	alertsSent   map[int]time.Time
+	nextReports  map[int]time.Time
+	resumed      map[int]*time.Time
+	setReportErr error
+}
+
+func (r *fakeSubscriptionRepository) GetAlertSubscriptionsDueContext(
+	_ context.Context,
+	sentBefore time.Time,
+) ([]models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dueSince = sentBefore
+	return r.subscriptions, r.err
+}
+
+func (r *fakeSubscriptionRepository) GetSubscriptionsDueForReportContext(
+	context.Context,
+	time.Time,
+) ([]models.Subscription, error) {
+	return r.subscriptions, r.err
+}
+
+func (r *fakeSubscriptionRepository) GetSubscriptionsToResumeContext(
+	context.Context,
+	time.Time,
+) ([]models.Subscription, error) {
+	return r.subscriptions, r.err
+}
+
+func (r *fakeSubscriptionRepository) MarkAlertSentContext(_ context.Context, id int, sentAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.alertsSent == nil {
+		r.alertsSent = make(map[int]time.Time)
+	}
+	r.alertsSent[id] = sentAt
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) SetNextReportAtContext(_ context.Context, id int, nextReportAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.setReportErr != nil {
+		return r.setReportErr
+	}
+	if r.nextReports == nil {
+		r.nextReports = make(map[int]time.Time)
+	}
+	r.nextReports[id] = nextReportAt
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) ResumeSubscriptionContext(
+	_ context.Context,
+	id int,
+	nextReportAt *time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resumed == nil {
+		r.resumed = make(map[int]*time.Time)
+	}
+	r.resumed[id] = nextReportAt
+	return nil
+}
+
+type fakeAlertRulesRepository struct {
+	repositories.AlertRulesRepository
+
+	rules map[int][]models.AlertRule
+}
+
+func (r *fakeAlertRulesRepository) GetAlertRulesBySubscriptionContext(
+	_ context.Context,
+	subscriptionId int,
+) ([]models.AlertRule, error) {
+	return r.rules[subscriptionId], nil
+}
+
+type fakeEmailOutboxRepository struct {
+	repositories.EmailOutboxRepository
+
+	mu     sync.Mutex
+	emails []models.OutboxEmail
+	err    error
+}
+
+func (r *fakeEmailOutboxRepository) EnqueueEmailContext(_ context.Context, email models.OutboxEmail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.emails = append(r.emails, email)
+	return nil
+}
+
+type fakeSubscribersRepository struct {
+	repositories.SubscribersRepository
+
+	deleted int
+	// deletedAt is the argument of the last DeleteExpiredSubscribersContext.
+	deletedAt time.Time
+}
+
+func (r *fakeSubscribersRepository) DeleteExpiredSubscribersContext(_ context.Context, now time.Time) (int, error) {
+	r.deletedAt = now
+	return r.deleted, nil
+}
@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// ResumeSubscriptionsJob resumes paused subscriptions whose resume date has come.
+type ResumeSubscriptionsJob struct {
+	subscriptionRepository repositories.SubscriptionRepository
+}
+
+func NewResumeSubscriptionsJob(database database.Database) *ResumeSubscriptionsJob {
+	return &ResumeSubscriptionsJob{
+		subscriptionRepository: repositories.NewSubscriptionRepository(database),
+	}
+}
+
+// Run resumes subscriptions whose resume date has passed, scheduled ones
+// get their next report after now so missed reports are not sent.
+func (j *ResumeSubscriptionsJob) Run(ctx context.Context) {
+	now := time.Now().UTC()
+
+	subscriptions, err := j.subscriptionRepository.GetSubscriptionsToResumeContext(ctx, now)
+	if err != nil {
+		log.Printf("resume subscriptions job failed to get subscriptions: %v", err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		var nextReportAt *time.Time
+		if subscription.Frequency != models.Alert {
+			next, err := subscription.NextReportTime(now)
+			if err != nil {
+				log.Printf("failed to schedule next report for subscription %d: %v", subscription.Id, err)
+				continue
+			}
+			nextReportAt = &next
+		}
+
+		err = j.subscriptionRepository.ResumeSubscriptionContext(ctx, subscription.Id, nextReportAt)
+		if err != nil {
+			log.Printf("failed to resume subscription %d: %v", subscription.Id, err)
+		}
+	}
+}
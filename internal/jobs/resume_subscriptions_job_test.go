@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+func TestResumeSubscriptionsJob(t *testing.T) {
+	resumeAt := time.Now().UTC().Add(-time.Hour)
+	subscriptions := []models.Subscription{
+		{Id: 1, Frequency: models.Hourly, Timezone: "UTC", Paused: true, ResumeAt: &resumeAt},
+		{Id: 2, Frequency: models.Daily, DeliveryTime: models.TimeOfDay{Hour: 8}, Timezone: "Europe/Kyiv", Paused: true, ResumeAt: &resumeAt},
+		{Id: 3, Frequency: models.Alert, Timezone: "UTC", Paused: true, ResumeAt: &resumeAt},
+	}
+	repository := &fakeSubscriptionRepository{subscriptions: subscriptions}
+	job := &ResumeSubscriptionsJob{subscriptionRepository: repository}
+
+	before := time.Now().UTC()
+	job.Run(context.Background())
+
+	if len(repository.resumed) != len(subscriptions) {
+		t.Fatalf("expected %d subscriptions resumed, got %d", len(subscriptions), len(repository.resumed))
+	}
+	for _, subscription := range subscriptions {
+		nextReportAt := repository.resumed[subscription.Id]
+		if subscription.Frequency == models.Alert {
+			if nextReportAt != nil {
+				t.Errorf("expected no next report for the alert subscription, got %v", *nextReportAt)
+			}
+			continue
+		}
+
+		// Reports missed while paused are not sent at once.
+		expected, _ := subscription.NextReportTime(before)
+		if nextReportAt == nil || !nextReportAt.Equal(expected) {
+			t.Errorf("expected subscription %d to resume at %v, got %v", subscription.Id, expected, nextReportAt)
+		}
+	}
+}
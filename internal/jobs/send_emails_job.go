@@ -0,0 +1,315 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+// emailBatchSize is how many emails are claimed at once,
+// a run claims batches until the outbox has no due emails left.
+const emailBatchSize = 100
+
+// emailSendLease is how long claimed emails are left to the worker that
+// claimed them. It is longer than a batch takes, when it ends without
+// a result the worker stopped and the emails are sent again.
+const emailSendLease = 10 * time.Minute
+
+// errEmailNotNeeded cancels an email, for example a confirmation
+// email of an address that was confirmed in the meantime.
+var errEmailNotNeeded = errors.New("email is not needed anymore")
+
+type weatherReportPayload struct {
+	Reports []services.CityReport `json:"reports"`
+}
+
+type weatherAlertPayload struct {
+	Subscription models.Subscription       `json:"subscription"`
+	WeatherData  services.WeatherData      `json:"weather_data"`
+	Alerts       []services.TriggeredAlert `json:"alerts"`
+}
+
+type SendEmailsJob struct {
+	emailService           services.EmailService
+	authService            services.AuthService
+	emailOutboxRepository  repositories.EmailOutboxRepository
+	subscribersRepository  repositories.SubscribersRepository
+	subscriptionRepository repositories.SubscriptionRepository
+	loginLinksRepository   repositories.LoginLinksRepository
+	maxAttempts            int
+	sendConcurrency        int
+}
+
+func NewSendEmailsJob(
+	emailService services.EmailService,
+	authService services.AuthService,
+	database database.Database,
+	maxAttempts int,
+	sendConcurrency int,
+) *SendEmailsJob {
+	return &SendEmailsJob{
+		emailService:           emailService,
+		authService:            authService,
+		emailOutboxRepository:  repositories.NewEmailOutboxRepository(database),
+		subscribersRepository:  repositories.NewSubscribersRepository(database),
+		subscriptionRepository: repositories.NewSubscriptionRepository(database),
+		loginLinksRepository:   repositories.NewLoginLinksRepository(database),
+		maxAttempts:            maxAttempts,
+		sendConcurrency:        sendConcurrency,
+	}
+}
+
+type emailDelivery struct {
+	err  error
+	done bool
+}
+
+// emailCounts are the results of one run for one email type.
+type emailCounts struct {
+	sent      int
+	failed    int
+	cancelled int
+	left      int
+}
+
+// Run sends the emails of the outbox that are due, up to sendConcurrency at
+// a time, until none are left or ctx is cancelled. Emails are claimed first
+// and sent without holding a transaction, the result of every email is
+// recorded on its own. Failed emails are retried with an exponential backoff,
+// emails that run out of attempts are kept with the last error. Emails that
+// were not sent when ctx is cancelled are left for the next run.
+func (job *SendEmailsJob) Run(ctx context.Context) {
+	started := time.Now()
+	counts := make(map[models.EmailType]*emailCounts)
+	for ctx.Err() == nil {
+		claimed, err := job.sendBatch(ctx, counts)
+		if err != nil {
+			log.Printf("send emails job failed to claim emails: %v", err)
+			break
+		}
+		if claimed < emailBatchSize {
+			break
+		}
+	}
+
+	if len(counts) == 0 {
+		return
+	}
+	logEmailCounts(counts, time.Since(started))
+}
+
+// sendBatch claims one batch of due emails, sends them and adds
+// the results to counts. It returns how many emails were claimed.
+func (job *SendEmailsJob) sendBatch(ctx context.Context, counts map[models.EmailType]*emailCounts) (int, error) {
+	now := time.Now().UTC()
+	emails, err := job.emailOutboxRepository.ClaimEmailsToSendContext(
+		ctx,
+		now,
+		now.Add(emailSendLease),
+		emailBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	deliveries := make([]emailDelivery, len(emails))
+	runConcurrently(ctx, len(emails), job.sendConcurrency, func(i int) {
+		send, err := job.prepare(ctx, emails[i])
+		if err != nil {
+			deliveries[i].err = err
+			// Lookups cut short by cancellation do not count as attempts.
+			deliveries[i].done = ctx.Err() == nil
+			return
+		}
+
+		deliveries[i].err = send()
+		deliveries[i].done = true
+	})
+
+	// Sent emails are recorded even when the job is being stopped,
+	// otherwise they would be sent again.
+	updateCtx := context.WithoutCancel(ctx)
+	for i, email := range emails {
+		delivery := deliveries[i]
+		typeCounts, ok := counts[email.Type]
+		if !ok {
+			typeCounts = &emailCounts{}
+			counts[email.Type] = typeCounts
+		}
+
+		now := time.Now().UTC()
+		email.Status = models.PendingEmail
+		switch {
+		case !delivery.done:
+			email.Attempts--
+			email.NextTryAfter = now
+			typeCounts.left++
+		case errors.Is(delivery.err, errEmailNotNeeded):
+			email.Status = models.CancelledEmail
+			typeCounts.cancelled++
+		case delivery.err != nil:
+			email.LastError = delivery.err.Error()
+			if email.Attempts >= job.maxAttempts {
+				log.Printf("giving up on %s email %d: %v", email.Type, email.Id, delivery.err)
+				email.Status = models.FailedEmail
+			} else {
+				delay := time.Duration(math.Pow(2, float64(email.Attempts))) * time.Minute
+				email.NextTryAfter = now.Add(delay)
+			}
+			typeCounts.failed++
+		default:
+			email.Status = models.SentEmail
+			email.SentAt = &now
+			typeCounts.sent++
+		}
+
+		err = job.emailOutboxRepository.UpdateClaimedEmailContext(updateCtx, email)
+		if err != nil {
+			log.Printf("failed to record the result of %s email %d: %v", email.Type, email.Id, err)
+		}
+	}
+
+	return len(emails), nil
+}
+
+// logEmailCounts logs the summary of a run, in total and by email type.
+func logEmailCounts(counts map[models.EmailType]*emailCounts, took time.Duration) {
+	var total emailCounts
+	byType := make([]string, 0, len(counts))
+	for _, emailType := range slices.Sorted(maps.Keys(counts)) {
+		typeCounts := counts[emailType]
+		total.sent += typeCounts.sent
+		total.failed += typeCounts.failed
+		total.cancelled += typeCounts.cancelled
+		total.left += typeCounts.left
+		byType = append(byType, fmt.Sprintf(
+			"%s: %d sent, %d failed",
+			emailType,
+			typeCounts.sent,
+			typeCounts.failed,
+		))
+	}
+
+	log.Printf(
+		"send emails job sent %d emails, %d failed, %d cancelled, %d left for the next run, took %s (%s)",
+		total.sent,
+		total.failed,
+		total.cancelled,
+		total.left,
+		took.Round(time.Millisecond),
+		strings.Join(byType, "; "),
+	)
+}
+
+// prepare looks up what the email needs and returns the function that sends it.
+func (job *SendEmailsJob) prepare(ctx context.Context, email models.OutboxEmail) (func() error, error) {
+	switch email.Type {
+	case models.ConfirmationEmail:
+		var payload models.ConfirmationEmailPayload
+		err := json.Unmarshal(email.Payload, &payload)
+		if err != nil {
+			return nil, err
+		}
+		return job.prepareConfirmationEmail(ctx, payload)
+	case models.LoginEmail:
+		var payload models.LoginEmailPayload
+		err := json.Unmarshal(email.Payload, &payload)
+		if err != nil {
+			return nil, err
+		}
+		return job.prepareLoginEmail(ctx, payload)
+	case models.WeatherReportEmail:
+		var payload weatherReportPayload
+		err := json.Unmarshal(email.Payload, &payload)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return job.emailService.SendWeatherReport(email.ToAddress, payload.Reports)
+		}, nil
+	case models.WeatherAlertEmail:
+		var payload weatherAlertPayload
+		err := json.Unmarshal(email.Payload, &payload)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return job.emailService.SendWeatherAlert(
+				email.ToAddress,
+				payload.Subscription.City,
+				payload.Subscription.Id,
+				payload.Subscription.Units,
+				payload.Subscription.TimeLocation(),
+				payload.WeatherData,
+				payload.Alerts,
+			)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown email type %q", email.Type)
+	}
+}
+
+// prepareConfirmationEmail lists the subscriptions the subscriber has now,
+// including the ones added after the email was queued.
+func (job *SendEmailsJob) prepareConfirmationEmail(
+	ctx context.Context,
+	payload models.ConfirmationEmailPayload,
+) (func() error, error) {
+	subscriber, err := job.subscribersRepository.GetSubscriberByTokenContext(ctx, payload.Token)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The address could be confirmed with a link sent before, or deleted
+	// because the confirmation expired, then there is nothing to send.
+	expired := subscriber.ConfirmationExpiresAt != nil && !time.Now().UTC().Before(*subscriber.ConfirmationExpiresAt)
+	if err != nil || subscriber.Confirmed || expired {
+		return nil, errEmailNotNeeded
+	}
+
+	subscriptions, err := job.subscriptionRepository.GetSubscriptionsBySubscriberContext(ctx, subscriber.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return job.emailService.SendConfirmationEmail(subscriber, subscriptions)
+	}, nil
+}
+
+func (job *SendEmailsJob) prepareLoginEmail(
+	ctx context.Context,
+	payload models.LoginEmailPayload,
+) (func() error, error) {
+	loginLink, err := job.loginLinksRepository.GetLoginLinkContext(ctx, payload.LoginLinkId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errEmailNotNeeded
+		}
+		return nil, err
+	}
+	if loginLink.UsedAt != nil || !time.Now().UTC().Before(loginLink.ExpiresAt) {
+		return nil, errEmailNotNeeded
+	}
+
+	return func() error {
+		return job.emailService.SendLoginEmail(
+			loginLink.Email,
+			job.authService.LoginToken(loginLink.Id, loginLink.ExpiresAt),
+			loginLink.ExpiresAt,
+		)
+	}, nil
+}
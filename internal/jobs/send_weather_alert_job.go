@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/database"
+	"github.com/kievzenit/genesis-case/internal/database/repositories"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+// precipitationLookahead is how far ahead precipitation alerts look,
+// "rain expected" is about the next few hours, not the whole day.
+const precipitationLookahead = 3 * time.Hour
+
+type SendWeatherAlertJob struct {
+	weatherService         services.WeatherService
+	subscriptionRepository repositories.SubscriptionRepository
+	alertRulesRepository   repositories.AlertRulesRepository
+	emailOutboxRepository  repositories.EmailOutboxRepository
+	cooldown               time.Duration
+	fetchConcurrency       int
+}
+
+func NewSendWeatherAlertJob(
+	weatherService services.WeatherService,
+	database database.Database,
+	cooldown time.Duration,
+	fetchConcurrency int,
+) *SendWeatherAlertJob {
+	return &SendWeatherAlertJob{
+		weatherService:         weatherService,
+		subscriptionRepository: repositories.NewSubscriptionRepository(database),
+		alertRulesRepository:   repositories.NewAlertRulesRepository(database),
+		emailOutboxRepository:  repositories.NewEmailOutboxRepository(database),
+		cooldown:               cooldown,
+		fetchConcurrency:       fetchConcurrency,
+	}
+}
+
+// errNoAlerts is returned for subscriptions whose rules did not fire.
+var errNoAlerts = errors.New("no alerts")
+
+type alertResult struct {
+	err  error
+	done bool
+}
+
+// Run queues alerts for subscriptions whose rules fire and that did not get
+// one within the cooldown. Weather is fetched by up to fetchConcurrency
+// workers, subscriptions of the same city share one lookup. When ctx is
+// cancelled the remaining subscriptions are checked by the next run.
+func (j *SendWeatherAlertJob) Run(ctx context.Context) {
+	started := time.Now()
+	now := started.UTC()
+
+	subscriptions, err := j.subscriptionRepository.GetAlertSubscriptionsDueContext(ctx, now.Add(-j.cooldown))
+	if err != nil {
+		log.Printf("send weather alert job failed to get subscriptions: %v", err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	lookups := &weatherLookups{weatherService: j.weatherService}
+	results := make([]alertResult, len(subscriptions))
+	runConcurrently(ctx, len(subscriptions), j.fetchConcurrency, func(i int) {
+		err := j.checkAlerts(ctx, lookups, subscriptions[i], now)
+		results[i] = alertResult{err: err, done: true}
+	})
+
+	var queued, failed, quiet int
+	for i, subscription := range subscriptions {
+		result := results[i]
+		switch {
+		case !result.done:
+		case errors.Is(result.err, errNoAlerts):
+			quiet++
+		case result.err != nil:
+			log.Printf("failed to check alerts of subscription %d: %v", subscription.Id, result.err)
+			failed++
+		default:
+			queued++
+		}
+	}
+
+	log.Printf(
+		"send weather alert job queued %d alerts, %d failed, %d without alerts, %d left for the next run, took %s",
+		queued,
+		failed,
+		quiet,
+		len(subscriptions)-queued-failed-quiet,
+		time.Since(started).Round(time.Millisecond),
+	)
+}
+
+// checkAlerts queues an alert when rules of the subscription fire, it returns
+// errNoAlerts when none did.
+func (j *SendWeatherAlertJob) checkAlerts(
+	ctx context.Context,
+	lookups *weatherLookups,
+	subscription models.Subscription,
+	now time.Time,
+) error {
+	rules, err := j.alertRulesRepository.GetAlertRulesBySubscriptionContext(ctx, subscription.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get alert rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return errNoAlerts
+	}
+
+	query := services.SubscriptionQuery(subscription)
+	weather, err := lookups.getCurrentWeather(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to get weather for %s: %w", query, err)
+	}
+
+	values := map[models.AlertMetric]float64{
+		models.TemperatureMetric: subscription.Units.Temperature(weather.Temperature),
+		models.WindSpeedMetric:   subscription.Units.Speed(weather.WindSpeed),
+	}
+	if weather.HasUVIndex {
+		values[models.UVIndexMetric] = weather.UVIndex
+	}
+	if slices.ContainsFunc(rules, func(rule models.AlertRule) bool {
+		return rule.Metric == models.PrecipitationMetric
+	}) {
+		precipitationChance, err := getPrecipitationChance(ctx, lookups, query, now)
+		if err != nil {
+			return fmt.Errorf("failed to get forecast for %s: %w", query, err)
+		}
+		values[models.PrecipitationMetric] = precipitationChance
+	}
+
+	var alerts []services.TriggeredAlert
+	for _, rule := range rules {
+		value, ok := values[rule.Metric]
+		if !ok {
+			// The provider that served the weather does not report the metric.
+			log.Printf("skipping %s alert rule %d of subscription %d, the value is unavailable", rule.Metric, rule.Id, subscription.Id)
+			continue
+		}
+		if rule.Matches(value) {
+			alerts = append(alerts, services.TriggeredAlert{Rule: rule, Value: value})
+		}
+	}
+	if len(alerts) == 0 {
+		return errNoAlerts
+	}
+
+	email, err := models.NewOutboxEmail(models.WeatherAlertEmail, subscription.Email, weatherAlertPayload{
+		Subscription: subscription,
+		WeatherData: services.WeatherData{
+			City:        subscription.City,
+			Temp:        weather.Temperature,
+			Description: weather.Condition,
+		},
+		Alerts: alerts,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The alert is recorded with its email even when the job is being
+	// stopped, otherwise the next run would queue it again.
+	queueCtx := context.WithoutCancel(ctx)
+	err = j.emailOutboxRepository.EnqueueEmailContext(queueCtx, email)
+	if err != nil {
+		return fmt.Errorf("failed to queue weather alert: %w", err)
+	}
+
+	err = j.subscriptionRepository.MarkAlertSentContext(queueCtx, subscription.Id, now)
+	if err != nil {
+		return fmt.Errorf("failed to mark alert sent: %w", err)
+	}
+	return nil
+}
+
+// getPrecipitationChance returns the highest chance of precipitation within
+// precipitationLookahead, falling back to the daily value when the provider
+// returned no hourly entries.
+func getPrecipitationChance(
+	ctx context.Context,
+	lookups *weatherLookups,
+	query services.LocationQuery,
+	now time.Time,
+) (float64, error) {
+	// Two days, so the lookahead still works late in the evening.
+	forecast, err := lookups.getForecast(ctx, query, 2)
+	if err != nil {
+		return 0, err
+	}
+
+	var chance float64
+	var found bool
+	for _, hour := range forecast.Hourly {
+		if hour.Time.Before(now.Truncate(time.Hour)) || hour.Time.After(now.Add(precipitationLookahead)) {
+			continue
+		}
+		chance = max(chance, hour.PrecipitationChance)
+		found = true
+	}
+
+	if !found && len(forecast.Daily) > 0 {
+		chance = forecast.Daily[0].PrecipitationChance
+	}
+	return chance, nil
+}
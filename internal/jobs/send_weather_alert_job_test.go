@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+// alertWeatherService serves fixed weather and counts the lookups.
+type alertWeatherService struct {
+	services.WeatherService
+	weather        services.CurrentWeatherResponse
+	forecast       services.ForecastResponse
+	currentLookups atomic.Int32
+}
+
+func (s *alertWeatherService) GetCurrentWeather(
+	context.Context,
+	services.LocationQuery,
+) (services.CurrentWeatherResponse, error) {
+	s.currentLookups.Add(1)
+	return s.weather, nil
+}
+
+func (s *alertWeatherService) GetForecast(
+	context.Context,
+	services.LocationQuery,
+	int,
+) (services.ForecastResponse, error) {
+	return s.forecast, nil
+}
+
+func alertSubscription(id int, units models.Units) models.Subscription {
+	return models.Subscription{
+		Id:        id,
+		Email:     "user@example.com",
+		City:      "Kyiv",
+		Frequency: models.Alert,
+		Units:     units,
+		Timezone:  "Europe/Kyiv",
+		Confirmed: true,
+	}
+}
+
+func newTestAlertJob(
+	weatherService services.WeatherService,
+	subscriptions []models.Subscription,
+	rules map[int][]models.AlertRule,
+) (*SendWeatherAlertJob, *fakeSubscriptionRepository, *fakeEmailOutboxRepository) {
+	subscriptionRepository := &fakeSubscriptionRepository{subscriptions: subscriptions}
+	emailOutboxRepository := &fakeEmailOutboxRepository{}
+	return &SendWeatherAlertJob{
+		weatherService:         weatherService,
+		subscriptionRepository: subscriptionRepository,
+		alertRulesRepository:   &fakeAlertRulesRepository{rules: rules},
+		emailOutboxRepository:  emailOutboxRepository,
+		cooldown:               6 * time.Hour,
+		fetchConcurrency:       4,
+	}, subscriptionRepository, emailOutboxRepository
+}
+
+func TestSendWeatherAlertJobRules(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name      string
+		units     models.Units
+		weather   services.CurrentWeatherResponse
+		forecast  services.ForecastResponse
+		rule      string
+		wantAlert bool
+		wantValue float64
+	}{
+		{
+			name:      "temperature below the threshold",
+			units:     models.Metric,
+			weather:   services.CurrentWeatherResponse{Temperature: -3},
+			rule:      "temperature:below:0",
+			wantAlert: true,
+			wantValue: -3,
+		},
+		{
+			name:    "temperature above the threshold",
+			units:   models.Metric,
+			weather: services.CurrentWeatherResponse{Temperature: 3},
+			rule:    "temperature:below:0",
+		},
+		{
+			name:      "imperial threshold",
+			units:     models.Imperial,
+			weather:   services.CurrentWeatherResponse{Temperature: -3},
+			rule:      "temperature:below:32",
+			wantAlert: true,
+			wantValue: 26.6,
+		},
+		{
+			name:      "wind speed in mph",
+			units:     models.Imperial,
+			weather:   services.CurrentWeatherResponse{WindSpeed: 80.4672},
+			rule:      "wind_speed:above:40",
+			wantAlert: true,
+			wantValue: 50,
+		},
+		{
+			name:      "uv index reported",
+			units:     models.Metric,
+			weather:   services.CurrentWeatherResponse{UVIndex: 8, HasUVIndex: true},
+			rule:      "uv_index:above:7",
+			wantAlert: true,
+			wantValue: 8,
+		},
+		{
+			// A zero UV index from a provider without UV must not fire "below" rules.
+			name:    "uv index not reported",
+			units:   models.Metric,
+			weather: services.CurrentWeatherResponse{},
+			rule:    "uv_index:below:1",
+		},
+		{
+			name:  "precipitation within the lookahead",
+			units: models.Metric,
+			forecast: services.ForecastResponse{Hourly: []services.HourlyForecast{
+				{Time: now.Truncate(time.Hour), PrecipitationChance: 20},
+				{Time: now.Truncate(time.Hour).Add(2 * time.Hour), PrecipitationChance: 80},
+				{Time: now.Add(6 * time.Hour), PrecipitationChance: 100},
+			}},
+			rule:      "precipitation:above:60",
+			wantAlert: true,
+			wantValue: 80,
+		},
+		{
+			name:  "precipitation after the lookahead",
+			units: models.Metric,
+			forecast: services.ForecastResponse{Hourly: []services.HourlyForecast{
+				{Time: now.Truncate(time.Hour), PrecipitationChance: 20},
+				{Time: now.Add(6 * time.Hour), PrecipitationChance: 100},
+			}},
+			rule: "precipitation:above:60",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := models.ParseAlertRule(tt.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			weatherService := &alertWeatherService{weather: tt.weather, forecast: tt.forecast}
+			job, subscriptions, outbox := newTestAlertJob(
+				weatherService,
+				[]models.Subscription{alertSubscription(1, tt.units)},
+				map[int][]models.AlertRule{1: {rule}},
+			)
+
+			job.Run(context.Background())
+
+			if !tt.wantAlert {
+				if len(outbox.emails) != 0 || len(subscriptions.alertsSent) != 0 {
+					t.Fatalf("expected no alert, got %d emails", len(outbox.emails))
+				}
+				return
+			}
+
+			if len(outbox.emails) != 1 {
+				t.Fatalf("expected one alert email, got %d", len(outbox.emails))
+			}
+			var payload weatherAlertPayload
+			if err := json.Unmarshal(outbox.emails[0].Payload, &payload); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(payload.Alerts) != 1 || !approx(payload.Alerts[0].Value, tt.wantValue) {
+				t.Errorf("expected one alert with value %v, got %+v", tt.wantValue, payload.Alerts)
+			}
+			if _, ok := subscriptions.alertsSent[1]; !ok {
+				t.Error("expected the alert to be marked sent")
+			}
+		})
+	}
+}
+
+func TestSendWeatherAlertJobCooldown(t *testing.T) {
+	rule, _ := models.ParseAlertRule("temperature:below:0")
+	job, subscriptions, _ := newTestAlertJob(
+		&alertWeatherService{weather: services.CurrentWeatherResponse{Temperature: -3}},
+		[]models.Subscription{alertSubscription(1, models.Metric)},
+		map[int][]models.AlertRule{1: {rule}},
+	)
+
+	before := time.Now().UTC()
+	job.Run(context.Background())
+	after := time.Now().UTC()
+
+	// Subscriptions alerted within the cooldown are not due.
+	if subscriptions.dueSince.Before(before.Add(-job.cooldown)) || subscriptions.dueSince.After(after.Add(-job.cooldown)) {
+		t.Errorf("expected subscriptions alerted before now minus the cooldown, got %v", subscriptions.dueSince)
+	}
+	sentAt := subscriptions.alertsSent[1]
+	if sentAt.Before(before) || sentAt.After(after) {
+		t.Errorf("expected the alert marked sent during the run, got %v", sentAt)
+	}
+}
+
+func TestSendWeatherAlertJobNotMarkedWhenQueueFails(t *testing.T) {
+	rule, _ := models.ParseAlertRule("temperature:below:0")
+	job, subscriptions, outbox := newTestAlertJob(
+		&alertWeatherService{weather: services.CurrentWeatherResponse{Temperature: -3}},
+		[]models.Subscription{alertSubscription(1, models.Metric)},
+		map[int][]models.AlertRule{1: {rule}},
+	)
+	outbox.err = errors.New("database unavailable")
+
+	job.Run(context.Background())
+
+	// The next run alerts again instead of waiting for the cooldown.
+	if len(subscriptions.alertsSent) != 0 {
+		t.Error("expected the alert not to be marked sent")
+	}
+}
+
+func TestSendWeatherAlertJobSharesLookups(t *testing.T) {
+	rule, _ := models.ParseAlertRule("temperature:below:0")
+	imperialRule, _ := models.ParseAlertRule("temperature:below:32")
+	weatherService := &alertWeatherService{weather: services.CurrentWeatherResponse{Temperature: -3}}
+	job, _, outbox := newTestAlertJob(
+		weatherService,
+		[]models.Subscription{
+			alertSubscription(1, models.Metric),
+			alertSubscription(2, models.Metric),
+			alertSubscription(3, models.Imperial),
+		},
+		map[int][]models.AlertRule{1: {rule}, 2: {rule}, 3: {imperialRule}},
+	)
+
+	job.Run(context.Background())
+
+	if lookups := weatherService.currentLookups.Load(); lookups != 1 {
+		t.Errorf("expected one lookup for the city, got %d", lookups)
+	}
+	if len(outbox.emails) != 3 {
+		t.Errorf("expected one alert per subscription, got %d", len(outbox.emails))
+	}
+}
+
+func TestSendWeatherAlertJobStopsWhenCancelled(t *testing.T) {
+	rule, _ := models.ParseAlertRule("temperature:below:0")
+	weatherService := &alertWeatherService{weather: services.CurrentWeatherResponse{Temperature: -3}}
+	job, _, outbox := newTestAlertJob(
+		weatherService,
+		[]models.Subscription{alertSubscription(1, models.Metric)},
+		map[int][]models.AlertRule{1: {rule}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job.Run(ctx)
+
+	if weatherService.currentLookups.Load() != 0 || len(outbox.emails) != 0 {
+		t.Error("expected no work after the job was cancelled")
+	}
+}
+
+func approx(a, b float64) bool {
+	return a-b < 0.01 && b-a < 0.01
+}
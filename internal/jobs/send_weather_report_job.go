@@ -2,6 +2,10 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
 
 	"github.com/kievzenit/genesis-case/internal/database"
 	"github.com/kievzenit/genesis-case/internal/database/repositories"
@@ -11,57 +15,296 @@ import (
 
 type SendWeatherReportJob struct {
 	weatherService         services.WeatherService
-	emailService           services.EmailService
 	subscriptionRepository repositories.SubscriptionRepository
+	emailOutboxRepository  repositories.EmailOutboxRepository
+	fetchConcurrency       int
 }
 
 func NewSendWeatherReportJob(
 	weatherService services.WeatherService,
-	emailService services.EmailService,
 	database database.Database,
+	fetchConcurrency int,
 ) *SendWeatherReportJob {
 	return &SendWeatherReportJob{
 		weatherService:         weatherService,
-		emailService:           emailService,
 		subscriptionRepository: repositories.NewSubscriptionRepository(database),
+		emailOutboxRepository:  repositories.NewEmailOutboxRepository(database),
+		fetchConcurrency:       fetchConcurrency,
 	}
 }
 
-func (j *SendWeatherReportJob) Run(frequency models.Frequency) {
-	ctx := context.Background()
+// reportRetryDelay is how long a report that could not be prepared or
+// queued waits before it is retried, unless its next report comes sooner.
+const reportRetryDelay = 5 * time.Minute
 
-	subscriptions, err := j.subscriptionRepository.GetConfirmedSubscriptionsByFrequencyContext(
-		ctx,
-		frequency,
-	)
+// errReportSkipped is returned for reports that are not due after all,
+// for example because they fall into quiet hours.
+var errReportSkipped = errors.New("report skipped")
+
+type reportResult struct {
+	report services.CityReport
+	err    error
+	done   bool
+}
+
+// weatherLookups coalesces the lookups of one run, so subscriptions
+// of the same city share one lookup, also when it fails.
+type weatherLookups struct {
+	weatherService services.WeatherService
+	current        coalescer[services.CurrentWeatherResponse]
+	forecast       coalescer[services.ForecastResponse]
+}
+
+func (l *weatherLookups) getCurrentWeather(
+	ctx context.Context,
+	query services.LocationQuery,
+) (services.CurrentWeatherResponse, error) {
+	return l.current.do(query.String(), func() (services.CurrentWeatherResponse, error) {
+		return l.weatherService.GetCurrentWeather(ctx, query)
+	})
+}
+
+func (l *weatherLookups) getForecast(
+	ctx context.Context,
+	query services.LocationQuery,
+	days int,
+) (services.ForecastResponse, error) {
+	return l.forecast.do(fmt.Sprintf("%s:%d", query, days), func() (services.ForecastResponse, error) {
+		return l.weatherService.GetForecast(ctx, query, days)
+	})
+}
+
+// Run queues reports for subscriptions that are due and schedules their next ones.
+// Reports due for several cities of one subscriber are sent as a single email.
+// A report is only scheduled past this period once it is queued, failed ones
+// are retried after reportRetryDelay.
+// Weather is fetched by up to fetchConcurrency workers, when ctx is cancelled
+// the remaining subscriptions are left due for the next run.
+// It is expected to run every minute.
+func (j *SendWeatherReportJob) Run(ctx context.Context) {
+	started := time.Now()
+	now := started.UTC()
+
+	subscriptions, err := j.subscriptionRepository.GetSubscriptionsDueForReportContext(ctx, now)
 	if err != nil {
+		log.Printf("send weather report job failed to get subscriptions: %v", err)
+		return
+	}
+	if len(subscriptions) == 0 {
 		return
 	}
 
-	weathers := make(map[string]services.CurrentWeatherResponse)
-	for _, subscription := range subscriptions {
-		weather, ok := weathers[subscription.City]
-		if !ok {
-			weather, err = j.weatherService.GetCurrentWeatherForCity(subscription.City)
-			if err != nil {
-				continue
-			}
-			weathers[subscription.City] = weather
+	lookups := &weatherLookups{weatherService: j.weatherService}
+	results := make([]reportResult, len(subscriptions))
+	runConcurrently(ctx, len(subscriptions), j.fetchConcurrency, func(i int) {
+		report, err := j.prepareReport(ctx, lookups, subscriptions[i], now)
+		results[i] = reportResult{report: report, err: err, done: true}
+	})
+
+	// Prepared reports are queued and scheduled even when the job is being stopped.
+	queueCtx := context.WithoutCancel(ctx)
+
+	var queued, failed, skipped, emailCount int
+	var subscriberIds []int
+	reports := make(map[int][]services.CityReport)
+	emails := make(map[int]string)
+	for i, subscription := range subscriptions {
+		result := results[i]
+		switch {
+		case !result.done:
+			continue
+		case errors.Is(result.err, errReportSkipped):
+			j.scheduleNextReport(queueCtx, subscription, now, false)
+			skipped++
+			continue
+		case result.err != nil:
+			log.Printf("failed to prepare report for subscription %d: %v", subscription.Id, result.err)
+			j.scheduleNextReport(queueCtx, subscription, now, true)
+			failed++
+			continue
 		}
 
-		err = j.emailService.SendWeatherReport(
-			subscription.Email,
-			subscription.City,
-			subscription.Token,
-			subscription.Frequency,
-			services.WeatherData{
-				Temp:        weather.Temperature,
-				Humidity:    weather.Humidity,
-				Description: weather.Condition,
-			},
+		if _, ok := reports[subscription.SubscriberId]; !ok {
+			subscriberIds = append(subscriberIds, subscription.SubscriberId)
+			emails[subscription.SubscriberId] = subscription.Email
+		}
+		reports[subscription.SubscriberId] = append(reports[subscription.SubscriberId], result.report)
+	}
+
+	for _, subscriberId := range subscriberIds {
+		email, err := models.NewOutboxEmail(
+			models.WeatherReportEmail,
+			emails[subscriberId],
+			weatherReportPayload{Reports: reports[subscriberId]},
 		)
+		if err == nil {
+			err = j.emailOutboxRepository.EnqueueEmailContext(queueCtx, email)
+		}
+		for _, report := range reports[subscriberId] {
+			j.scheduleNextReport(queueCtx, report.Subscription, now, err != nil)
+		}
 		if err != nil {
+			log.Printf("failed to queue weather report for subscriber %d: %v", subscriberId, err)
+			failed += len(reports[subscriberId])
+			continue
+		}
+
+		queued += len(reports[subscriberId])
+		emailCount++
+	}
+
+	log.Printf(
+		"send weather report job queued %d reports in %d emails, %d failed, %d skipped, %d left for the next run, took %s",
+		queued,
+		emailCount,
+		failed,
+		skipped,
+		len(subscriptions)-queued-failed-skipped,
+		time.Since(started).Round(time.Millisecond),
+	)
+}
+
+// scheduleNextReport sets the next report of the subscription after now,
+// or a retry of this one when retry is set.
+func (j *SendWeatherReportJob) scheduleNextReport(
+	ctx context.Context,
+	subscription models.Subscription,
+	now time.Time,
+	retry bool,
+) {
+	nextReportAt, err := subscription.NextReportTime(now)
+	if err != nil {
+		log.Printf("failed to schedule next report of subscription %d: %v", subscription.Id, err)
+		return
+	}
+	if retryAt := now.Add(reportRetryDelay); retry && retryAt.Before(nextReportAt) {
+		nextReportAt = retryAt
+	}
+
+	err = j.subscriptionRepository.SetNextReportAtContext(ctx, subscription.Id, nextReportAt)
+	if err != nil {
+		log.Printf("failed to schedule next report of subscription %d: %v", subscription.Id, err)
+	}
+}
+
+// prepareReport collects the weather for the report of the subscription.
+// It returns errReportSkipped when it should not be sent.
+func (j *SendWeatherReportJob) prepareReport(
+	ctx context.Context,
+	lookups *weatherLookups,
+	subscription models.Subscription,
+	now time.Time,
+) (services.CityReport, error) {
+	ctx = services.WithReportFrequency(ctx, subscription.Frequency)
+
+	// Reports scheduled before the quiet hours were set, or delayed
+	// into them, are skipped.
+	loc := subscription.TimeLocation()
+	if subscription.QuietHours != nil && subscription.QuietHours.Contains(now.In(loc)) {
+		return services.CityReport{}, errReportSkipped
+	}
+
+	query := services.SubscriptionQuery(subscription)
+	weather, err := lookups.getCurrentWeather(ctx, query)
+	if err != nil {
+		return services.CityReport{}, fmt.Errorf("failed to get weather for %s: %w", query, err)
+	}
+
+	var outlook *services.DailyForecast
+	if subscription.Frequency != models.Hourly {
+		outlook = getTodayOutlook(ctx, lookups, query)
+	}
+
+	var overnight *services.DailyForecast
+	if subscription.OvernightSummary && subscription.QuietHours != nil && subscription.NextReportAt != nil {
+		dueAt := subscription.NextReportAt.In(loc)
+		if subscription.QuietHours.EndsAt(dueAt) {
+			overnight = getOvernightSummary(ctx, lookups, query, subscription.QuietHours.WindowEndingAt(dueAt), dueAt)
+		}
+	}
+
+	return services.CityReport{
+		Subscription: subscription,
+		WeatherData: services.WeatherData{
+			City:          subscription.City,
+			Temp:          weather.Temperature,
+			FeelsLike:     weather.FeelsLike,
+			Humidity:      weather.Humidity,
+			WindSpeed:     weather.WindSpeed,
+			WindDirection: weather.WindDirection,
+			Pressure:      weather.Pressure,
+			Visibility:    weather.Visibility,
+			UVIndex:       weather.UVIndex,
+			CloudCover:    weather.CloudCover,
+			Description:   weather.Condition,
+			IconURL:       weather.IconURL,
+			Outlook:       outlook,
+			Overnight:     overnight,
+		},
+	}, nil
+}
+
+// getTodayOutlook returns nil when the forecast is unavailable,
+// the report is still worth sending without it.
+func getTodayOutlook(
+	ctx context.Context,
+	lookups *weatherLookups,
+	query services.LocationQuery,
+) *services.DailyForecast {
+	forecast, err := lookups.getForecast(ctx, query, 1)
+	if err != nil {
+		log.Printf("failed to get forecast for %s: %v", query, err)
+		return nil
+	}
+
+	if len(forecast.Daily) == 0 {
+		return nil
+	}
+	return &forecast.Daily[0]
+}
+
+// getOvernightSummary aggregates the hourly forecast within the quiet hours.
+// Providers only return hours from the start of their current day, so the
+// summary may cover the part of the window after midnight only. It returns
+// nil when no hours are available.
+func getOvernightSummary(
+	ctx context.Context,
+	lookups *weatherLookups,
+	query services.LocationQuery,
+	start time.Time,
+	end time.Time,
+) *services.DailyForecast {
+	forecast, err := lookups.getForecast(ctx, query, 1)
+	if err != nil {
+		log.Printf("failed to get forecast for %s: %v", query, err)
+		return nil
+	}
+
+	var summary *services.DailyForecast
+	conditions := make(map[string]int)
+	for _, hour := range forecast.Hourly {
+		if hour.Time.Before(start) || !hour.Time.Before(end) {
 			continue
 		}
+
+		if summary == nil {
+			summary = &services.DailyForecast{
+				Date:           start,
+				MinTemperature: hour.Temperature,
+				MaxTemperature: hour.Temperature,
+			}
+		}
+		summary.MinTemperature = min(summary.MinTemperature, hour.Temperature)
+		summary.MaxTemperature = max(summary.MaxTemperature, hour.Temperature)
+		summary.PrecipitationChance = max(summary.PrecipitationChance, hour.PrecipitationChance)
+		summary.MaxWindSpeed = max(summary.MaxWindSpeed, hour.WindSpeed)
+		summary.UVIndex = max(summary.UVIndex, hour.UVIndex)
+
+		// The most frequent condition describes the night.
+		conditions[hour.Condition]++
+		if conditions[hour.Condition] > conditions[summary.Condition] {
+			summary.Condition = hour.Condition
+		}
 	}
+	return summary
 }
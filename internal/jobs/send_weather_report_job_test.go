@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/services"
+)
+
+// forecastWeatherService serves a fixed forecast.
+type forecastWeatherService struct {
+	services.WeatherService
+	forecast services.ForecastResponse
+	err      error
+}
+
+func (s *forecastWeatherService) GetForecast(
+	context.Context,
+	services.LocationQuery,
+	int,
+) (services.ForecastResponse, error) {
+	return s.forecast, s.err
+}
+
+func hourlyForecast(from time.Time, hours int) []services.HourlyForecast {
+	forecast := make([]services.HourlyForecast, 0, hours)
+	for i := range hours {
+		condition := "Clear"
+		if i%3 == 0 {
+			condition = "Cloudy"
+		}
+		forecast = append(forecast, services.HourlyForecast{
+			Time:                from.Add(time.Duration(i) * time.Hour),
+			Temperature:         float64(i),
+			PrecipitationChance: float64(i * 2),
+			WindSpeed:           float64(20 - i),
+			Condition:           condition,
+		})
+	}
+	return forecast
+}
+
+func TestGetOvernightSummary(t *testing.T) {
+	day := time.Date(2026, time.June, 2, 0, 0, 0, 0, time.UTC)
+	overnight := models.QuietHours{Start: models.TimeOfDay{Hour: 22}, End: models.TimeOfDay{Hour: 7}}
+	offTheHour := models.QuietHours{
+		Start: models.TimeOfDay{Hour: 1, Minute: 30},
+		End:   models.TimeOfDay{Hour: 5, Minute: 45},
+	}
+
+	tests := []struct {
+		name              string
+		quiet             models.QuietHours
+		end               time.Time
+		expected          *services.DailyForecast
+		expectedCondition string
+	}{
+		{
+			// Hours before midnight are not in the forecast of the day.
+			name:  "window spanning midnight",
+			quiet: overnight,
+			end:   day.Add(7 * time.Hour),
+			expected: &services.DailyForecast{
+				MinTemperature:      0,
+				MaxTemperature:      6,
+				PrecipitationChance: 12,
+				MaxWindSpeed:        20,
+			},
+			expectedCondition: "Clear",
+		},
+		{
+			name:  "window ending off the hour",
+			quiet: offTheHour,
+			end:   day.Add(5*time.Hour + 45*time.Minute),
+			expected: &services.DailyForecast{
+				MinTemperature:      2,
+				MaxTemperature:      5,
+				PrecipitationChance: 10,
+				MaxWindSpeed:        18,
+			},
+			expectedCondition: "Clear",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := &weatherLookups{
+				weatherService: &forecastWeatherService{
+					forecast: services.ForecastResponse{Hourly: hourlyForecast(day, 24)},
+				},
+			}
+
+			start := tt.quiet.WindowEndingAt(tt.end)
+			summary := getOvernightSummary(context.Background(), lookups, services.CityQuery("Kyiv"), start, tt.end)
+			if summary == nil {
+				t.Fatal("expected a summary")
+			}
+
+			if summary.MinTemperature != tt.expected.MinTemperature ||
+				summary.MaxTemperature != tt.expected.MaxTemperature ||
+				summary.PrecipitationChance != tt.expected.PrecipitationChance ||
+				summary.MaxWindSpeed != tt.expected.MaxWindSpeed {
+				t.Errorf("expected %+v, got %+v", tt.expected, summary)
+			}
+			if summary.Condition != tt.expectedCondition {
+				t.Errorf("expected condition %q, got %q", tt.expectedCondition, summary.Condition)
+			}
+			if !summary.Date.Equal(start) {
+				t.Errorf("expected the summary dated %v, got %v", start, summary.Date)
+			}
+		})
+	}
+}
+
+func TestGetOvernightSummaryWithoutHours(t *testing.T) {
+	day := time.Date(2026, time.June, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		weather *forecastWeatherService
+	}{
+		{name: "forecast fails", weather: &forecastWeatherService{err: errors.New("provider unavailable")}},
+		{
+			name: "no hours in the window",
+			weather: &forecastWeatherService{
+				forecast: services.ForecastResponse{Hourly: hourlyForecast(day.Add(12*time.Hour), 6)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := &weatherLookups{weatherService: tt.weather}
+			summary := getOvernightSummary(
+				context.Background(),
+				lookups,
+				services.CityQuery("Kyiv"),
+				day.Add(-2*time.Hour),
+				day.Add(7*time.Hour),
+			)
+			if summary != nil {
+				t.Errorf("expected no summary, got %+v", summary)
+			}
+		})
+	}
+}
+
+// currentWeatherService serves fixed current weather, or fails with err.
+type currentWeatherService struct {
+	services.WeatherService
+	weather services.CurrentWeatherResponse
+	err     error
+}
+
+func (s *currentWeatherService) GetCurrentWeather(
+	context.Context,
+	services.LocationQuery,
+) (services.CurrentWeatherResponse, error) {
+	return s.weather, s.err
+}
+
+func (s *currentWeatherService) GetForecast(
+	context.Context,
+	services.LocationQuery,
+	int,
+) (services.ForecastResponse, error) {
+	return services.ForecastResponse{}, errors.New("forecast unavailable")
+}
+
+func TestSendWeatherReportJobScheduling(t *testing.T) {
+	tests := []struct {
+		name       string
+		fetchErr   error
+		queueErr   error
+		wantEmails int
+		wantRetry  bool
+	}{
+		{name: "report queued", wantEmails: 1},
+		{name: "weather fetch fails", fetchErr: errors.New("provider unavailable"), wantRetry: true},
+		{name: "queueing fails", queueErr: errors.New("database unavailable"), wantRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := models.Subscription{
+				Id:           1,
+				SubscriberId: 1,
+				Email:        "user@example.com",
+				City:         "Kyiv",
+				Frequency:    models.Daily,
+				Units:        models.Metric,
+				Timezone:     "UTC",
+				Confirmed:    true,
+			}
+			subscriptions := &fakeSubscriptionRepository{subscriptions: []models.Subscription{subscription}}
+			outbox := &fakeEmailOutboxRepository{err: tt.queueErr}
+			job := &SendWeatherReportJob{
+				weatherService:         &currentWeatherService{err: tt.fetchErr},
+				subscriptionRepository: subscriptions,
+				emailOutboxRepository:  outbox,
+				fetchConcurrency:       4,
+			}
+
+			before := time.Now().UTC()
+			job.Run(context.Background())
+
+			if len(outbox.emails) != tt.wantEmails {
+				t.Errorf("expected %d emails, got %d", tt.wantEmails, len(outbox.emails))
+			}
+
+			nextReportAt, ok := subscriptions.nextReports[subscription.Id]
+			if !ok {
+				t.Fatal("expected the next report to be scheduled")
+			}
+			if tt.wantRetry {
+				// The report of this period is retried instead of dropped.
+				if nextReportAt.Sub(before) > reportRetryDelay+time.Second {
+					t.Errorf("expected a retry within %s, got %v", reportRetryDelay, nextReportAt)
+				}
+				return
+			}
+			expected, _ := subscription.NextReportTime(before)
+			if !nextReportAt.Equal(expected) {
+				t.Errorf("expected the next report at %v, got %v", expected, nextReportAt)
+			}
+		})
+	}
+}
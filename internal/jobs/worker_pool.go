@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// runConcurrently calls fn for every index below n, with at most concurrency
+// calls at a time. Indexes that were not started when ctx is cancelled are
+// skipped, calls that already started are waited for.
+func runConcurrently(ctx context.Context, n int, concurrency int, fn func(i int)) {
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range max(min(concurrency, n), 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := range n {
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+
+	wg.Wait()
+}
+
+// errLoadPanicked is returned by coalescer.do when the load panicked.
+var errLoadPanicked = errors.New("weather lookup panicked")
+
+// coalescer remembers the result of one call per key, callers asking for
+// a key that is being loaded wait for that call instead of making their own.
+type coalescer[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall[V]
+}
+
+type coalescedCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func (c *coalescer[V]) do(key string, load func() (V, error)) (value V, err error) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[string]*coalescedCall[V])
+	}
+	call, ok := c.calls[key]
+	if ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+
+	call = &coalescedCall[V]{done: make(chan struct{}), err: errLoadPanicked}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	// A panicking load becomes an error for the caller and the waiters, and
+	// its key is forgotten so that the next caller loads it again.
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("%w: %v", errLoadPanicked, r)
+			err = call.err
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+		}
+		close(call.done)
+	}()
+
+	call.value, call.err = load()
+	return call.value, call.err
+}
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCoalescerSharesCalls(t *testing.T) {
+	var c coalescer[int]
+	loads := 0
+	for range 3 {
+		value, err := c.do("kyiv", func() (int, error) {
+			loads++
+			return 1, nil
+		})
+		if err != nil || value != 1 {
+			t.Fatalf("expected 1, got %v, %v", value, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected one load, got %d", loads)
+	}
+}
+
+func TestCoalescerPanicReleasesWaiters(t *testing.T) {
+	var c coalescer[int]
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	loaderErr := make(chan error)
+	go func() {
+		_, err := c.do("kyiv", func() (int, error) {
+			close(started)
+			<-release
+			panic("provider client bug")
+		})
+		loaderErr <- err
+	}()
+	<-started
+
+	waiterErr := make(chan error)
+	go func() {
+		_, err := c.do("kyiv", func() (int, error) { return 1, nil })
+		waiterErr <- err
+	}()
+
+	// Give the waiter time to join the panicking call.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for _, errs := range []chan error{loaderErr, waiterErr} {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, errLoadPanicked) {
+				t.Errorf("expected %v, got %v", errLoadPanicked, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("caller blocked after the load panicked")
+		}
+	}
+
+	value, err := c.do("kyiv", func() (int, error) { return 2, nil })
+	if err != nil || value != 2 {
+		t.Errorf("expected a new load after the panic, got %v, %v", value, err)
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type AlertMetric string
+
+const (
+	TemperatureMetric   AlertMetric = "temperature"
+	PrecipitationMetric AlertMetric = "precipitation"
+	WindSpeedMetric     AlertMetric = "wind_speed"
+	UVIndexMetric       AlertMetric = "uv_index"
+)
+
+func (m AlertMetric) IsValid() bool {
+	switch m {
+	case TemperatureMetric, PrecipitationMetric, WindSpeedMetric, UVIndexMetric:
+		return true
+	default:
+		return false
+	}
+}
+
+type AlertOperator string
+
+const (
+	Above AlertOperator = "above"
+	Below AlertOperator = "below"
+)
+
+func (o AlertOperator) IsValid() bool {
+	switch o {
+	case Above, Below:
+		return true
+	default:
+		return false
+	}
+}
+
+// AlertRule fires when the metric crosses the threshold. Thresholds are
+// in the units of the subscription, precipitation is a chance in percent.
+type AlertRule struct {
+	Id             int
+	SubscriptionId int
+	Metric         AlertMetric
+	Operator       AlertOperator
+	Threshold      float64
+}
+
+func (r AlertRule) IsValid() bool {
+	return r.Metric.IsValid() && r.Operator.IsValid()
+}
+
+func (r AlertRule) Matches(value float64) bool {
+	switch r.Operator {
+	case Above:
+		return value > r.Threshold
+	case Below:
+		return value < r.Threshold
+	default:
+		return false
+	}
+}
+
+// ConvertUnits returns the rule with the threshold converted from one units
+// to the other, rounded to two decimals. Precipitation and UV index have no units.
+func (r AlertRule) ConvertUnits(from Units, to Units) AlertRule {
+	if from == to {
+		return r
+	}
+
+	switch r.Metric {
+	case TemperatureMetric:
+		r.Threshold = to.Temperature(from.toMetricTemperature(r.Threshold))
+	case WindSpeedMetric:
+		r.Threshold = to.Speed(from.toMetricSpeed(r.Threshold))
+	default:
+		return r
+	}
+	r.Threshold = math.Round(r.Threshold*100) / 100
+	return r
+}
+
+// ParseAlertRule parses the "metric:operator:threshold" form,
+// for example "temperature:below:0".
+func ParseAlertRule(rule string) (AlertRule, error) {
+	parts := strings.Split(rule, ":")
+	if len(parts) != 3 {
+		return AlertRule{}, fmt.Errorf("malformed alert rule %q", rule)
+	}
+
+	threshold, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("malformed alert rule threshold %q: %w", rule, err)
+	}
+
+	alertRule := AlertRule{
+		Metric:    AlertMetric(parts[0]),
+		Operator:  AlertOperator(parts[1]),
+		Threshold: threshold,
+	}
+	if !alertRule.IsValid() {
+		return AlertRule{}, fmt.Errorf("unknown alert rule metric or operator %q", rule)
+	}
+	return alertRule, nil
+}
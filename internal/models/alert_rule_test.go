@@ -0,0 +1,92 @@
+package models
+
+import "testing"
+
+func TestParseAlertRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    AlertRule
+		wantErr bool
+	}{
+		{rule: "temperature:below:0", want: AlertRule{Metric: TemperatureMetric, Operator: Below, Threshold: 0}},
+		{rule: "precipitation:above:60", want: AlertRule{Metric: PrecipitationMetric, Operator: Above, Threshold: 60}},
+		{rule: "wind_speed:above:40.5", want: AlertRule{Metric: WindSpeedMetric, Operator: Above, Threshold: 40.5}},
+		{rule: "uv_index:above:7", want: AlertRule{Metric: UVIndexMetric, Operator: Above, Threshold: 7}},
+		{rule: "temperature:below:-10", want: AlertRule{Metric: TemperatureMetric, Operator: Below, Threshold: -10}},
+		{rule: "temperature:below", wantErr: true},
+		{rule: "temperature:below:0:1", wantErr: true},
+		{rule: "temperature:below:cold", wantErr: true},
+		{rule: "humidity:above:80", wantErr: true},
+		{rule: "temperature:equals:0", wantErr: true},
+		{rule: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseAlertRule(tt.rule)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAlertRuleMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  AlertRule
+		value float64
+		want  bool
+	}{
+		{name: "above", rule: AlertRule{Operator: Above, Threshold: 30}, value: 31, want: true},
+		{name: "not above", rule: AlertRule{Operator: Above, Threshold: 30}, value: 29, want: false},
+		{name: "above at the threshold", rule: AlertRule{Operator: Above, Threshold: 30}, value: 30, want: false},
+		{name: "below", rule: AlertRule{Operator: Below, Threshold: 0}, value: -0.5, want: true},
+		{name: "not below", rule: AlertRule{Operator: Below, Threshold: 0}, value: 1, want: false},
+		{name: "below at the threshold", rule: AlertRule{Operator: Below, Threshold: 0}, value: 0, want: false},
+		{name: "unknown operator", rule: AlertRule{Operator: "equals", Threshold: 0}, value: 0, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.value); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAlertRuleConvertUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		rule AlertRule
+		from Units
+		to   Units
+		want float64
+	}{
+		{name: "freezing to fahrenheit", rule: AlertRule{Metric: TemperatureMetric, Threshold: 0}, from: Metric, to: Imperial, want: 32},
+		{name: "freezing to celsius", rule: AlertRule{Metric: TemperatureMetric, Threshold: 32}, from: Imperial, to: Metric, want: 0},
+		{name: "wind to mph", rule: AlertRule{Metric: WindSpeedMetric, Threshold: 40}, from: Metric, to: Imperial, want: 24.85},
+		{name: "wind to km/h", rule: AlertRule{Metric: WindSpeedMetric, Threshold: 25}, from: Imperial, to: Metric, want: 40.23},
+		{name: "precipitation unchanged", rule: AlertRule{Metric: PrecipitationMetric, Threshold: 60}, from: Metric, to: Imperial, want: 60},
+		{name: "uv index unchanged", rule: AlertRule{Metric: UVIndexMetric, Threshold: 7}, from: Imperial, to: Metric, want: 7},
+		{name: "same units", rule: AlertRule{Metric: TemperatureMetric, Threshold: 21.5}, from: Metric, to: Metric, want: 21.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.ConvertUnits(tt.from, tt.to).Threshold; got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,11 +5,17 @@ type Frequency string
 const (
 	Hourly Frequency = "hourly"
 	Daily  Frequency = "daily"
+	Weekly Frequency = "weekly"
+	// Custom subscriptions are scheduled by a cron expression.
+	Custom Frequency = "custom"
+	// Alert subscriptions have no schedule, they are notified
+	// only when one of their alert rules matches.
+	Alert Frequency = "alert"
 )
 
 func (f Frequency) IsValid() bool {
 	switch f {
-	case Hourly, Daily:
+	case Hourly, Daily, Weekly, Custom, Alert:
 		return true
 	default:
 		return false
@@ -0,0 +1,13 @@
+package models
+
+// Location is a place resolved through a weather provider's geocoding API.
+type Location struct {
+	Name      string
+	Region    string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	// Timezone is an IANA timezone name, empty when the provider
+	// does not report it with search results.
+	Timezone string
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginLink is a single use link that signs the subscriber in,
+// it is delivered through the email outbox.
+type LoginLink struct {
+	Id           int
+	SubscriberId int
+	// Email is the address of the subscriber.
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EmailType string
+
+const (
+	ConfirmationEmail  EmailType = "confirmation"
+	LoginEmail         EmailType = "login"
+	WeatherReportEmail EmailType = "weather_report"
+	WeatherAlertEmail  EmailType = "weather_alert"
+)
+
+type EmailStatus string
+
+const (
+	PendingEmail EmailStatus = "pending"
+	// SendingEmail is claimed by a worker until NextTryAfter. Emails of
+	// a worker that stopped without recording the result are tried again
+	// after that.
+	SendingEmail EmailStatus = "sending"
+	SentEmail    EmailStatus = "sent"
+	// FailedEmail ran out of attempts, LastError tells why.
+	FailedEmail EmailStatus = "failed"
+	// CancelledEmail was not needed anymore when it was its turn,
+	// for example the address was confirmed with an earlier email.
+	CancelledEmail EmailStatus = "cancelled"
+)
+
+// OutboxEmail is an email waiting to be sent, or the record of one.
+// Payload is the JSON encoded payload of its type.
+type OutboxEmail struct {
+	Id           int
+	Type         EmailType
+	ToAddress    string
+	Payload      json.RawMessage
+	Status       EmailStatus
+	Attempts     int
+	LastError    string
+	NextTryAfter time.Time
+	CreatedAt    time.Time
+	SentAt       *time.Time
+}
+
+// ConfirmationEmailPayload references the subscriber by its token, the email
+// lists the subscriptions the subscriber has when it is sent.
+type ConfirmationEmailPayload struct {
+	Token uuid.UUID `json:"token"`
+}
+
+type LoginEmailPayload struct {
+	LoginLinkId int `json:"login_link_id"`
+}
+
+// NewOutboxEmail returns a pending email that is sent as soon as possible.
+func NewOutboxEmail(emailType EmailType, toAddress string, payload any) (OutboxEmail, error) {
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEmail{}, err
+	}
+
+	return OutboxEmail{
+		Type:         emailType,
+		ToAddress:    toAddress,
+		Payload:      encodedPayload,
+		Status:       PendingEmail,
+		NextTryAfter: time.Now().UTC(),
+	}, nil
+}
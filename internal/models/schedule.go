@@ -0,0 +1,206 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrInvalidTimeOfDay      = errors.New("invalid time of day, expected HH:MM")
+	ErrInvalidWeekday        = errors.New("invalid weekday")
+	ErrInvalidCronExpression = errors.New("invalid cron expression")
+	ErrUnscheduledFrequency  = errors.New("frequency has no report schedule")
+	ErrInvalidQuietHours     = errors.New("quiet hours must start and end at different times")
+)
+
+// TimeOfDay is a wall clock time in the timezone reports are scheduled in.
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// DefaultDeliveryTime and DefaultDeliveryWeekday are used for daily and
+// weekly reports when the subscriber did not choose a time or a day.
+var DefaultDeliveryTime = TimeOfDay{Hour: 12}
+
+const DefaultDeliveryWeekday = time.Monday
+
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return TimeOfDay{}, ErrInvalidTimeOfDay
+	}
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+func (t TimeOfDay) minutes() int {
+	return t.Hour*60 + t.Minute
+}
+
+// on returns t on the given day. Times skipped by a DST spring forward
+// are moved forward by the length of the gap, as cron does.
+func (t TimeOfDay) on(year int, month time.Month, day int, loc *time.Location) time.Time {
+	date := time.Date(year, month, day, t.Hour, t.Minute, 0, 0, loc)
+	actual := TimeOfDay{Hour: date.Hour(), Minute: date.Minute()}.minutes()
+	if actual != t.minutes() {
+		gap := (t.minutes() - actual + 24*60) % (24 * 60)
+		date = date.Add(time.Duration(gap) * time.Minute)
+	}
+	return date
+}
+
+// QuietHours is a daily window in which no reports are sent, it may span
+// midnight, for example from 22:00 to 07:00. End is exclusive.
+type QuietHours struct {
+	Start TimeOfDay
+	End   TimeOfDay
+}
+
+func (q QuietHours) IsValid() bool {
+	return q.Start != q.End
+}
+
+// Contains reports whether t falls inside the window, in t's location.
+func (q QuietHours) Contains(t time.Time) bool {
+	minutes := TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}.minutes()
+	if q.Start.minutes() < q.End.minutes() {
+		return minutes >= q.Start.minutes() && minutes < q.End.minutes()
+	}
+	return minutes >= q.Start.minutes() || minutes < q.End.minutes()
+}
+
+// EndsAt reports whether a window ends exactly at t.
+func (q QuietHours) EndsAt(t time.Time) bool {
+	return t.Hour() == q.End.Hour && t.Minute() == q.End.Minute
+}
+
+// WindowEndingAt returns the start of the window that ends at end.
+func (q QuietHours) WindowEndingAt(end time.Time) time.Time {
+	year, month, day := end.Date()
+	start := time.Date(year, month, day, q.Start.Hour, q.Start.Minute, 0, 0, end.Location())
+	if !start.Before(end) {
+		start = time.Date(year, month, day-1, q.Start.Hour, q.Start.Minute, 0, 0, end.Location())
+	}
+	return start
+}
+
+// nextEnd returns the first end of the window at or after t.
+func (q QuietHours) nextEnd(t time.Time) time.Time {
+	year, month, day := t.Date()
+	end := time.Date(year, month, day, q.End.Hour, q.End.Minute, 0, 0, t.Location())
+	if end.Before(t) {
+		end = time.Date(year, month, day+1, q.End.Hour, q.End.Minute, 0, 0, t.Location())
+	}
+	return end
+}
+
+func ParseWeekday(s string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(s, weekday.String()) {
+			return weekday, nil
+		}
+	}
+	return 0, ErrInvalidWeekday
+}
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// ParseCronExpression accepts standard five field expressions only. The minute
+// field must be a single value, so reports are sent at most once an hour.
+func ParseCronExpression(expression string) (cron.Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, ErrInvalidCronExpression
+	}
+	if _, err := strconv.Atoi(fields[0]); err != nil {
+		return nil, ErrInvalidCronExpression
+	}
+
+	schedule, err := cronParser.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCronExpression, err)
+	}
+	return schedule, nil
+}
+
+// NextReportTime returns the first report time of the subscription strictly
+// after the given time, with the schedule evaluated in the subscription's
+// timezone. Hourly reports are sent at the top of every hour outside quiet
+// hours, the overnight summary is sent right when the quiet hours end.
+func (s Subscription) NextReportTime(after time.Time) (time.Time, error) {
+	loc := s.TimeLocation()
+	local := after.In(loc)
+	year, month, day := local.Date()
+
+	var next time.Time
+	switch s.Frequency {
+	case Hourly:
+		// Stepping in absolute time keeps the repeated hour of a DST
+		// fall back, time.Date would resolve both to the first one.
+		hourStart := local.Add(-time.Duration(local.Minute())*time.Minute -
+			time.Duration(local.Second())*time.Second -
+			time.Duration(local.Nanosecond()))
+		next = hourStart.Add(time.Hour)
+		if s.QuietHours != nil && s.QuietHours.Contains(next) {
+			next = s.QuietHours.nextEnd(next)
+			if !s.OvernightSummary && next.Minute() != 0 {
+				next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, loc)
+			}
+		}
+	case Daily:
+		next = s.DeliveryTime.on(year, month, day, loc)
+		if !next.After(local) {
+			next = s.DeliveryTime.on(year, month, day+1, loc)
+		}
+	case Weekly:
+		days := (int(s.Weekday) - int(local.Weekday()) + 7) % 7
+		next = s.DeliveryTime.on(year, month, day+days, loc)
+		if !next.After(local) {
+			next = s.DeliveryTime.on(year, month, day+days+7, loc)
+		}
+	case Custom:
+		schedule, err := ParseCronExpression(s.CronExpression)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// The parser accepts dates that never happen, like February 30,
+		// Next reports them with the zero time.
+		next = schedule.Next(local)
+		if next.IsZero() {
+			return time.Time{}, ErrInvalidCronExpression
+		}
+	default:
+		return time.Time{}, ErrUnscheduledFrequency
+	}
+
+	return next.UTC(), nil
+}
+
+// DescribeSchedule renders the schedule for humans,
+// for example "weekly on Monday at 07:30 (Europe/Kyiv)".
+func (s Subscription) DescribeSchedule() string {
+	switch s.Frequency {
+	case Daily:
+		return fmt.Sprintf("daily at %s (%s)", s.DeliveryTime, s.TimeLocation())
+	case Weekly:
+		return fmt.Sprintf("weekly on %s at %s (%s)", s.Weekday, s.DeliveryTime, s.TimeLocation())
+	case Custom:
+		return fmt.Sprintf("custom %s (%s)", s.CronExpression, s.TimeLocation())
+	case Hourly:
+		if s.QuietHours != nil {
+			return fmt.Sprintf("hourly, except %s-%s (%s)", s.QuietHours.Start, s.QuietHours.End, s.TimeLocation())
+		}
+		return string(s.Frequency)
+	default:
+		return string(s.Frequency)
+	}
+}
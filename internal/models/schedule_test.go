@@ -0,0 +1,418 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
+
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNextReportTime(t *testing.T) {
+	// New York switches to EDT at 2026-03-08 02:00 EST (07:00 UTC)
+	// and back to EST at 2026-11-01 02:00 EDT (06:00 UTC).
+	newYork := "America/New_York"
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		after        time.Time
+		expected     time.Time
+	}{
+		{
+			name:         "hourly at the top of the next hour",
+			subscription: Subscription{Frequency: Hourly, Timezone: "Europe/Kyiv"},
+			after:        utc(2026, time.June, 1, 10, 15),
+			expected:     utc(2026, time.June, 1, 11, 0),
+		},
+		{
+			name:         "hourly right at the top of an hour",
+			subscription: Subscription{Frequency: Hourly, Timezone: "Europe/Kyiv"},
+			after:        utc(2026, time.June, 1, 10, 0),
+			expected:     utc(2026, time.June, 1, 11, 0),
+		},
+		{
+			name:         "hourly in a half hour offset timezone",
+			subscription: Subscription{Frequency: Hourly, Timezone: "Asia/Kolkata"},
+			after:        utc(2026, time.June, 1, 10, 15),
+			expected:     utc(2026, time.June, 1, 10, 30),
+		},
+		{
+			name:         "hourly over the skipped hour of spring forward",
+			subscription: Subscription{Frequency: Hourly, Timezone: newYork},
+			after:        utc(2026, time.March, 8, 6, 30), // 01:30 EST
+			expected:     utc(2026, time.March, 8, 7, 0),  // 03:00 EDT
+		},
+		{
+			name:         "hourly into the repeated hour of fall back",
+			subscription: Subscription{Frequency: Hourly, Timezone: newYork},
+			after:        utc(2026, time.November, 1, 5, 30), // 01:30 EDT
+			expected:     utc(2026, time.November, 1, 6, 0),  // 01:00 EST
+		},
+		{
+			name:         "hourly out of the repeated hour of fall back",
+			subscription: Subscription{Frequency: Hourly, Timezone: newYork},
+			after:        utc(2026, time.November, 1, 6, 30), // 01:30 EST
+			expected:     utc(2026, time.November, 1, 7, 0),  // 02:00 EST
+		},
+		{
+			name:         "daily later today",
+			subscription: Subscription{Frequency: Daily, Timezone: "Europe/Kyiv", DeliveryTime: TimeOfDay{Hour: 7, Minute: 30}},
+			after:        utc(2026, time.June, 1, 2, 0),  // 05:00 EEST
+			expected:     utc(2026, time.June, 1, 4, 30), // 07:30 EEST
+		},
+		{
+			name:         "daily at the delivery time moves to tomorrow",
+			subscription: Subscription{Frequency: Daily, Timezone: "Europe/Kyiv", DeliveryTime: TimeOfDay{Hour: 7, Minute: 30}},
+			after:        utc(2026, time.June, 1, 4, 30),
+			expected:     utc(2026, time.June, 2, 4, 30),
+		},
+		{
+			name:         "daily over the month end",
+			subscription: Subscription{Frequency: Daily, Timezone: "UTC", DeliveryTime: TimeOfDay{Hour: 9}},
+			after:        utc(2026, time.February, 28, 10, 0),
+			expected:     utc(2026, time.March, 1, 9, 0),
+		},
+		{
+			name:         "daily on the spring forward day",
+			subscription: Subscription{Frequency: Daily, Timezone: newYork, DeliveryTime: TimeOfDay{Hour: 8}},
+			after:        utc(2026, time.March, 7, 14, 0), // 09:00 EST
+			expected:     utc(2026, time.March, 8, 12, 0), // 08:00 EDT
+		},
+		{
+			name:         "daily in the skipped hour of spring forward",
+			subscription: Subscription{Frequency: Daily, Timezone: newYork, DeliveryTime: TimeOfDay{Hour: 2, Minute: 30}},
+			after:        utc(2026, time.March, 8, 5, 0),  // 00:00 EST
+			expected:     utc(2026, time.March, 8, 7, 30), // 03:30 EDT
+		},
+		{
+			name:         "daily on the fall back day",
+			subscription: Subscription{Frequency: Daily, Timezone: newYork, DeliveryTime: TimeOfDay{Hour: 8}},
+			after:        utc(2026, time.October, 31, 13, 0), // 09:00 EDT
+			expected:     utc(2026, time.November, 1, 13, 0), // 08:00 EST
+		},
+		{
+			name:         "daily in the repeated hour of fall back is sent once",
+			subscription: Subscription{Frequency: Daily, Timezone: newYork, DeliveryTime: TimeOfDay{Hour: 1, Minute: 30}},
+			after:        utc(2026, time.November, 1, 5, 30), // 01:30 EDT
+			expected:     utc(2026, time.November, 2, 6, 30), // 01:30 EST the next day
+		},
+		{
+			name: "weekly later this week",
+			subscription: Subscription{
+				Frequency:    Weekly,
+				Timezone:     "UTC",
+				Weekday:      time.Friday,
+				DeliveryTime: TimeOfDay{Hour: 18},
+			},
+			after:    utc(2026, time.June, 1, 12, 0), // Monday
+			expected: utc(2026, time.June, 5, 18, 0),
+		},
+		{
+			name: "weekly on the day after the delivery time",
+			subscription: Subscription{
+				Frequency:    Weekly,
+				Timezone:     "UTC",
+				Weekday:      time.Monday,
+				DeliveryTime: TimeOfDay{Hour: 9},
+			},
+			after:    utc(2026, time.June, 1, 12, 0),
+			expected: utc(2026, time.June, 8, 9, 0),
+		},
+		{
+			name: "weekly in the subscriber's timezone",
+			subscription: Subscription{
+				Frequency:    Weekly,
+				Timezone:     "Pacific/Auckland",
+				Weekday:      time.Monday,
+				DeliveryTime: TimeOfDay{Hour: 7},
+			},
+			after:    utc(2026, time.June, 1, 12, 0), // Tuesday 00:00 NZST
+			expected: utc(2026, time.June, 7, 19, 0), // Monday 07:00 NZST
+		},
+		{
+			name:         "custom on weekdays",
+			subscription: Subscription{Frequency: Custom, Timezone: "Europe/Kyiv", CronExpression: "30 7 * * 1-5"},
+			after:        utc(2026, time.June, 5, 10, 0), // Friday 13:00 EEST
+			expected:     utc(2026, time.June, 8, 4, 30), // Monday 07:30 EEST
+		},
+		{
+			name:         "custom on the last day of long months",
+			subscription: Subscription{Frequency: Custom, Timezone: "UTC", CronExpression: "0 9 31 * *"},
+			after:        utc(2026, time.April, 15, 0, 0),
+			expected:     utc(2026, time.May, 31, 9, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.subscription.NextReportTime(tt.after)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("expected the time in UTC, got %v", got.Location())
+			}
+		})
+	}
+}
+
+func TestNextReportTimeErrors(t *testing.T) {
+	after := utc(2026, time.June, 1, 12, 0)
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		expected     error
+	}{
+		{
+			name:         "alerts have no schedule",
+			subscription: Subscription{Frequency: Alert},
+			expected:     ErrUnscheduledFrequency,
+		},
+		{
+			name:         "cron that never fires",
+			subscription: Subscription{Frequency: Custom, Timezone: "UTC", CronExpression: "0 9 30 2 *"},
+			expected:     ErrInvalidCronExpression,
+		},
+		{
+			name:         "malformed cron",
+			subscription: Subscription{Frequency: Custom, Timezone: "UTC", CronExpression: "every day"},
+			expected:     ErrInvalidCronExpression,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.subscription.NextReportTime(after)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestNextReportTimeUsesSubscriptionTimezone(t *testing.T) {
+	kyiv := mustLoadLocation(t, "Europe/Kyiv")
+	subscription := Subscription{Frequency: Daily, Timezone: "Europe/Kyiv", DeliveryTime: TimeOfDay{Hour: 12}}
+
+	got, err := subscription.NextReportTime(utc(2026, time.June, 1, 0, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	local := got.In(kyiv)
+	if local.Hour() != 12 || local.Minute() != 0 || local.Day() != 1 {
+		t.Errorf("expected 12:00 on June 1 in Kyiv, got %v", local)
+	}
+}
+
+func TestParseCronExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		valid      bool
+	}{
+		{expression: "30 7 * * 1-5", valid: true},
+		{expression: "0 9 31 * *", valid: true},
+		{expression: "0 */2 * * *", valid: true},
+		{expression: "* * * * *", valid: false},
+		{expression: "*/15 * * * *", valid: false},
+		{expression: "0-30 * * * *", valid: false},
+		{expression: "0 7 * *", valid: false},
+		{expression: "0 0 7 * * *", valid: false},
+		{expression: "60 7 * * *", valid: false},
+		{expression: "0 25 * * *", valid: false},
+		{expression: "@daily", valid: false},
+		{expression: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := ParseCronExpression(tt.expression)
+			if tt.valid && err != nil {
+				t.Errorf("expected a valid expression, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidCronExpression) {
+				t.Errorf("expected %v, got %v", ErrInvalidCronExpression, err)
+			}
+		})
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := QuietHours{Start: TimeOfDay{Hour: 22}, End: TimeOfDay{Hour: 7}}
+	workday := QuietHours{Start: TimeOfDay{Hour: 9}, End: TimeOfDay{Hour: 17}}
+
+	tests := []struct {
+		name     string
+		quiet    QuietHours
+		hour     int
+		minute   int
+		expected bool
+	}{
+		{name: "overnight before the start", quiet: overnight, hour: 21, minute: 59, expected: false},
+		{name: "overnight at the start", quiet: overnight, hour: 22, expected: true},
+		{name: "overnight at midnight", quiet: overnight, hour: 0, expected: true},
+		{name: "overnight before the end", quiet: overnight, hour: 6, minute: 59, expected: true},
+		{name: "overnight at the end", quiet: overnight, hour: 7, expected: false},
+		{name: "overnight at noon", quiet: overnight, hour: 12, expected: false},
+		{name: "workday before the start", quiet: workday, hour: 8, minute: 59, expected: false},
+		{name: "workday at the start", quiet: workday, hour: 9, expected: true},
+		{name: "workday at noon", quiet: workday, hour: 12, expected: true},
+		{name: "workday at the end", quiet: workday, hour: 17, expected: false},
+		{name: "workday at midnight", quiet: workday, hour: 0, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := time.Date(2026, time.June, 1, tt.hour, tt.minute, 0, 0, time.UTC)
+			if got := tt.quiet.Contains(at); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestQuietHoursWindowEndingAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		quiet    QuietHours
+		end      time.Time
+		expected time.Time
+	}{
+		{
+			name:     "window spanning midnight starts the day before",
+			quiet:    QuietHours{Start: TimeOfDay{Hour: 22}, End: TimeOfDay{Hour: 7}},
+			end:      utc(2026, time.June, 1, 7, 0),
+			expected: utc(2026, time.May, 31, 22, 0),
+		},
+		{
+			name:     "window within a day starts the same day",
+			quiet:    QuietHours{Start: TimeOfDay{Hour: 9}, End: TimeOfDay{Hour: 17}},
+			end:      utc(2026, time.June, 1, 17, 0),
+			expected: utc(2026, time.June, 1, 9, 0),
+		},
+		{
+			name:     "window ending at the start of a month",
+			quiet:    QuietHours{Start: TimeOfDay{Hour: 23, Minute: 30}, End: TimeOfDay{Hour: 6, Minute: 45}},
+			end:      utc(2026, time.March, 1, 6, 45),
+			expected: utc(2026, time.February, 28, 23, 30),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.quiet.EndsAt(tt.end) {
+				t.Fatalf("expected the window to end at %v", tt.end)
+			}
+			if got := tt.quiet.WindowEndingAt(tt.end); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNextReportTimeWithQuietHours(t *testing.T) {
+	overnight := &QuietHours{Start: TimeOfDay{Hour: 22}, End: TimeOfDay{Hour: 7}}
+	workday := &QuietHours{Start: TimeOfDay{Hour: 9}, End: TimeOfDay{Hour: 17}}
+	offTheHour := &QuietHours{Start: TimeOfDay{Hour: 22, Minute: 30}, End: TimeOfDay{Hour: 6, Minute: 45}}
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		after        time.Time
+		expected     time.Time
+	}{
+		{
+			name:         "outside the window",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: overnight},
+			after:        utc(2026, time.June, 1, 20, 10),
+			expected:     utc(2026, time.June, 1, 21, 0),
+		},
+		{
+			name:         "last report before the window",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: overnight},
+			after:        utc(2026, time.June, 1, 21, 0),
+			expected:     utc(2026, time.June, 2, 7, 0),
+		},
+		{
+			name:         "first report after the window",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: overnight},
+			after:        utc(2026, time.June, 2, 3, 0),
+			expected:     utc(2026, time.June, 2, 7, 0),
+		},
+		{
+			name:         "reports resume after the window",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: overnight},
+			after:        utc(2026, time.June, 2, 7, 0),
+			expected:     utc(2026, time.June, 2, 8, 0),
+		},
+		{
+			name:         "window within a day",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: workday},
+			after:        utc(2026, time.June, 1, 8, 30),
+			expected:     utc(2026, time.June, 1, 17, 0),
+		},
+		{
+			name:         "window in the subscriber's timezone",
+			subscription: Subscription{Frequency: Hourly, Timezone: "Europe/Kyiv", QuietHours: overnight},
+			after:        utc(2026, time.June, 1, 18, 30), // 21:30 EEST
+			expected:     utc(2026, time.June, 2, 4, 0),   // 07:00 EEST
+		},
+		{
+			name:         "window ending off the hour waits for the next hour",
+			subscription: Subscription{Frequency: Hourly, Timezone: "UTC", QuietHours: offTheHour},
+			after:        utc(2026, time.June, 1, 22, 0),
+			expected:     utc(2026, time.June, 2, 7, 0),
+		},
+		{
+			name: "overnight summary right when the window ends off the hour",
+			subscription: Subscription{
+				Frequency:        Hourly,
+				Timezone:         "UTC",
+				QuietHours:       offTheHour,
+				OvernightSummary: true,
+			},
+			after:    utc(2026, time.June, 1, 22, 0),
+			expected: utc(2026, time.June, 2, 6, 45),
+		},
+		{
+			name: "top of the hour after an overnight summary",
+			subscription: Subscription{
+				Frequency:        Hourly,
+				Timezone:         "UTC",
+				QuietHours:       offTheHour,
+				OvernightSummary: true,
+			},
+			after:    utc(2026, time.June, 2, 6, 45),
+			expected: utc(2026, time.June, 2, 7, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.subscription.NextReportTime(tt.after)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
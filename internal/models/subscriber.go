@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscriber owns all subscriptions of one email address,
+// the address is confirmed once for all of them.
+type Subscriber struct {
+	Id        int
+	Email     string
+	Token     uuid.UUID
+	Confirmed bool
+	// ConfirmationExpiresAt is nil for confirmed subscribers.
+	ConfirmationExpiresAt *time.Time
+}
+
+// NormalizeEmail returns the form addresses are stored in,
+// so that subscribers are found regardless of letter case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
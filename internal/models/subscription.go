@@ -1,12 +1,64 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type Subscription struct {
-	Id        int
-	Token     uuid.UUID
+	Id           int
+	SubscriberId int
+	// Confirmed and Email belong to the subscriber.
 	Confirmed bool
 	Email     string
 	City      string
+	// Location is nil for subscriptions created before cities were resolved.
+	Location  *Location
 	Frequency Frequency
+	Units     Units
+	// Timezone is an IANA timezone name, schedules and email
+	// timestamps use it.
+	Timezone string
+	// DeliveryTime is used by daily and weekly subscriptions, Weekday by weekly
+	// ones and CronExpression by custom ones.
+	DeliveryTime   TimeOfDay
+	Weekday        time.Weekday
+	CronExpression string
+	// QuietHours are only supported by hourly subscriptions, OvernightSummary
+	// asks for a report when they end.
+	QuietHours       *QuietHours
+	OvernightSummary bool
+	// NextReportAt is nil for alert subscriptions.
+	NextReportAt *time.Time
+	// Paused subscriptions get no emails, they are resumed automatically
+	// at ResumeAt unless it is nil.
+	Paused   bool
+	ResumeAt *time.Time
+}
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// LoadTimezone loads an IANA timezone, unlike time.LoadLocation
+// it does not accept the server's "Local" timezone.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTimezone, err)
+	}
+	return loc, nil
+}
+
+// TimeLocation returns the timezone of the subscription,
+// falling back to UTC when it is unknown.
+func (s Subscription) TimeLocation() *time.Location {
+	loc, err := LoadTimezone(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
@@ -0,0 +1,92 @@
+package models
+
+type Units string
+
+const (
+	Metric   Units = "metric"
+	Imperial Units = "imperial"
+)
+
+func (u Units) IsValid() bool {
+	switch u {
+	case Metric, Imperial:
+		return true
+	default:
+		return false
+	}
+}
+
+// Weather data is always fetched in metric units, the methods below convert
+// metric values into u. Values are returned unchanged for metric units.
+
+func (u Units) Temperature(celsius float64) float64 {
+	if u == Imperial {
+		return celsius*9/5 + 32
+	}
+	return celsius
+}
+
+func (u Units) Speed(kph float64) float64 {
+	if u == Imperial {
+		return kph / 1.609344
+	}
+	return kph
+}
+
+func (u Units) Pressure(hectopascals float64) float64 {
+	if u == Imperial {
+		return hectopascals / 33.8638866667
+	}
+	return hectopascals
+}
+
+func (u Units) Distance(kilometers float64) float64 {
+	if u == Imperial {
+		return kilometers / 1.609344
+	}
+	return kilometers
+}
+
+// toMetricTemperature and toMetricSpeed convert values in u back to metric ones.
+
+func (u Units) toMetricTemperature(temperature float64) float64 {
+	if u == Imperial {
+		return (temperature - 32) * 5 / 9
+	}
+	return temperature
+}
+
+func (u Units) toMetricSpeed(speed float64) float64 {
+	if u == Imperial {
+		return speed * 1.609344
+	}
+	return speed
+}
+
+func (u Units) TemperatureSymbol() string {
+	if u == Imperial {
+		return "°F"
+	}
+	return "°C"
+}
+
+func (u Units) SpeedSymbol() string {
+	if u == Imperial {
+		return "mph"
+	}
+	return "km/h"
+}
+
+func (u Units) PressureSymbol() string {
+	if u == Imperial {
+		return "inHg"
+	}
+	return "hPa"
+}
+
+func (u Units) DistanceSymbol() string {
+	if u == Imperial {
+		return "mi"
+	}
+	return "km"
+}
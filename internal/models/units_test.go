@@ -0,0 +1,83 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestUnitsConversions(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    Units
+		convert  func(Units, float64) float64
+		metric   float64
+		expected float64
+	}{
+		{name: "metric temperature", units: Metric, convert: Units.Temperature, metric: 21.5, expected: 21.5},
+		{name: "imperial freezing point", units: Imperial, convert: Units.Temperature, metric: 0, expected: 32},
+		{name: "imperial boiling point", units: Imperial, convert: Units.Temperature, metric: 100, expected: 212},
+		{name: "imperial negative temperature", units: Imperial, convert: Units.Temperature, metric: -40, expected: -40},
+		{name: "metric speed", units: Metric, convert: Units.Speed, metric: 36, expected: 36},
+		{name: "imperial speed", units: Imperial, convert: Units.Speed, metric: 100, expected: 62.14},
+		{name: "metric pressure", units: Metric, convert: Units.Pressure, metric: 1013.25, expected: 1013.25},
+		{name: "imperial pressure", units: Imperial, convert: Units.Pressure, metric: 1013.25, expected: 29.92},
+		{name: "metric distance", units: Metric, convert: Units.Distance, metric: 10, expected: 10},
+		{name: "imperial distance", units: Imperial, convert: Units.Distance, metric: 1.609344, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.convert(tt.units, tt.metric)
+			if !almostEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnitsSymbols(t *testing.T) {
+	tests := []struct {
+		units       Units
+		temperature string
+		speed       string
+		pressure    string
+		distance    string
+	}{
+		{units: Metric, temperature: "°C", speed: "km/h", pressure: "hPa", distance: "km"},
+		{units: Imperial, temperature: "°F", speed: "mph", pressure: "inHg", distance: "mi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.units), func(t *testing.T) {
+			if got := tt.units.TemperatureSymbol(); got != tt.temperature {
+				t.Errorf("expected temperature symbol %q, got %q", tt.temperature, got)
+			}
+			if got := tt.units.SpeedSymbol(); got != tt.speed {
+				t.Errorf("expected speed symbol %q, got %q", tt.speed, got)
+			}
+			if got := tt.units.PressureSymbol(); got != tt.pressure {
+				t.Errorf("expected pressure symbol %q, got %q", tt.pressure, got)
+			}
+			if got := tt.units.DistanceSymbol(); got != tt.distance {
+				t.Errorf("expected distance symbol %q, got %q", tt.distance, got)
+			}
+		})
+	}
+}
+
+func TestUnitsIsValid(t *testing.T) {
+	for _, units := range []Units{Metric, Imperial} {
+		if !units.IsValid() {
+			t.Errorf("expected %q to be valid", units)
+		}
+	}
+	for _, units := range []Units{"", "kelvin", "Metric"} {
+		if units.IsValid() {
+			t.Errorf("expected %q to be invalid", units)
+		}
+	}
+}
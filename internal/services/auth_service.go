@@ -0,0 +1,198 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// AuthService signs sessions and the links sent in emails. Tokens have the form
+// "subject.expiry.signature", the signature covers the purpose of the token,
+// so for example an unsubscribe link cannot be used to manage the subscription.
+type AuthService interface {
+	LoginLinkTTL() time.Duration
+	SessionTTL() time.Duration
+	LoginToken(linkId int, expiresAt time.Time) string
+	// ParseLoginToken returns the id of the login link, it does not check
+	// whether the link was already used.
+	ParseLoginToken(token string) (int, error)
+	SessionToken(subscriberId int, expiresAt time.Time) string
+	ParseSessionToken(token string) (int, error)
+	// ConfirmationToken signs the token of the subscriber, so rotating
+	// it invalidates confirmation links that were sent before.
+	ConfirmationToken(subscriberToken uuid.UUID, expiresAt time.Time) string
+	ParseConfirmationToken(token string) (uuid.UUID, error)
+	// ManageToken and UnsubscribeToken are valid for the email link TTL.
+	ManageToken(subscriptionId int) string
+	ParseManageToken(token string) (int, error)
+	// UnsubscribeToken may cover several subscriptions, so one link
+	// unsubscribes from every city of a report.
+	UnsubscribeToken(subscriptionIds ...int) string
+	ParseUnsubscribeToken(token string) ([]int, error)
+}
+
+const (
+	loginTokenPurpose        = "login"
+	sessionTokenPurpose      = "session"
+	confirmationTokenPurpose = "confirm"
+	manageTokenPurpose       = "manage"
+	unsubscribeTokenPurpose  = "unsubscribe"
+)
+
+func NewAuthService(cfg *config.AuthConfig) (AuthService, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("auth secret is empty")
+	}
+
+	return &authService{
+		secret:       []byte(cfg.Secret),
+		loginLinkTTL: time.Duration(cfg.LoginLinkTTL) * time.Minute,
+		sessionTTL:   time.Duration(cfg.SessionTTL) * time.Minute,
+		emailLinkTTL: time.Duration(cfg.EmailLinkTTL) * time.Minute,
+	}, nil
+}
+
+type authService struct {
+	secret       []byte
+	loginLinkTTL time.Duration
+	sessionTTL   time.Duration
+	emailLinkTTL time.Duration
+}
+
+func (s *authService) LoginLinkTTL() time.Duration {
+	return s.loginLinkTTL
+}
+
+func (s *authService) SessionTTL() time.Duration {
+	return s.sessionTTL
+}
+
+func (s *authService) LoginToken(linkId int, expiresAt time.Time) string {
+	return s.sign(loginTokenPurpose, strconv.Itoa(linkId), expiresAt)
+}
+
+func (s *authService) ParseLoginToken(token string) (int, error) {
+	return s.parseId(loginTokenPurpose, token)
+}
+
+func (s *authService) SessionToken(subscriberId int, expiresAt time.Time) string {
+	return s.sign(sessionTokenPurpose, strconv.Itoa(subscriberId), expiresAt)
+}
+
+func (s *authService) ParseSessionToken(token string) (int, error) {
+	return s.parseId(sessionTokenPurpose, token)
+}
+
+func (s *authService) ConfirmationToken(subscriberToken uuid.UUID, expiresAt time.Time) string {
+	return s.sign(confirmationTokenPurpose, subscriberToken.String(), expiresAt)
+}
+
+func (s *authService) ParseConfirmationToken(token string) (uuid.UUID, error) {
+	subject, err := s.parse(confirmationTokenPurpose, token)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	subscriberToken, err := uuid.Parse(subject)
+	if err != nil {
+		return uuid.UUID{}, ErrInvalidToken
+	}
+	return subscriberToken, nil
+}
+
+func (s *authService) ManageToken(subscriptionId int) string {
+	return s.sign(manageTokenPurpose, strconv.Itoa(subscriptionId), time.Now().Add(s.emailLinkTTL))
+}
+
+func (s *authService) ParseManageToken(token string) (int, error) {
+	return s.parseId(manageTokenPurpose, token)
+}
+
+func (s *authService) UnsubscribeToken(subscriptionIds ...int) string {
+	ids := make([]string, 0, len(subscriptionIds))
+	for _, subscriptionId := range subscriptionIds {
+		ids = append(ids, strconv.Itoa(subscriptionId))
+	}
+	return s.sign(unsubscribeTokenPurpose, strings.Join(ids, "-"), time.Now().Add(s.emailLinkTTL))
+}
+
+func (s *authService) ParseUnsubscribeToken(token string) ([]int, error) {
+	subject, err := s.parse(unsubscribeTokenPurpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptionIds []int
+	for _, idPart := range strings.Split(subject, "-") {
+		id, err := strconv.Atoi(idPart)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		subscriptionIds = append(subscriptionIds, id)
+	}
+	return subscriptionIds, nil
+}
+
+func (s *authService) sign(purpose string, subject string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s.%d", subject, expiresAt.Unix())
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.signature(purpose, payload))
+}
+
+func (s *authService) parseId(purpose string, token string) (int, error) {
+	subject, err := s.parse(purpose, token)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+// parse returns the subject of the token.
+func (s *authService) parse(purpose string, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal(signature, s.signature(purpose, payload)) {
+		return "", ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if time.Now().Unix() >= expiresAt {
+		return "", ErrTokenExpired
+	}
+
+	return parts[0], nil
+}
+
+func (s *authService) signature(purpose string, payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(purpose + ":" + payload))
+	return mac.Sum(nil)
+}
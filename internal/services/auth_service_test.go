@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+func newTestAuthService(t *testing.T, secret string) *authService {
+	t.Helper()
+
+	service, err := NewAuthService(&config.AuthConfig{
+		Secret:       secret,
+		LoginLinkTTL: 15,
+		SessionTTL:   60,
+		EmailLinkTTL: 60,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return service.(*authService)
+}
+
+func TestAuthServiceRoundTrip(t *testing.T) {
+	s := newTestAuthService(t, "secret")
+	expiresAt := time.Now().Add(time.Hour)
+
+	loginId, err := s.ParseLoginToken(s.LoginToken(7, expiresAt))
+	if err != nil || loginId != 7 {
+		t.Errorf("expected login link 7, got %v, %v", loginId, err)
+	}
+
+	subscriberId, err := s.ParseSessionToken(s.SessionToken(8, expiresAt))
+	if err != nil || subscriberId != 8 {
+		t.Errorf("expected subscriber 8, got %v, %v", subscriberId, err)
+	}
+
+	subscriberToken := uuid.New()
+	confirmed, err := s.ParseConfirmationToken(s.ConfirmationToken(subscriberToken, expiresAt))
+	if err != nil || confirmed != subscriberToken {
+		t.Errorf("expected %v, got %v, %v", subscriberToken, confirmed, err)
+	}
+
+	subscriptionId, err := s.ParseManageToken(s.ManageToken(9))
+	if err != nil || subscriptionId != 9 {
+		t.Errorf("expected subscription 9, got %v, %v", subscriptionId, err)
+	}
+
+	subscriptionIds, err := s.ParseUnsubscribeToken(s.UnsubscribeToken(1, 2, 3))
+	if err != nil || !slices.Equal(subscriptionIds, []int{1, 2, 3}) {
+		t.Errorf("expected subscriptions [1 2 3], got %v, %v", subscriptionIds, err)
+	}
+}
+
+func TestAuthServiceRejectsTokens(t *testing.T) {
+	s := newTestAuthService(t, "secret")
+	expiresAt := time.Now().Add(time.Hour)
+	unsubscribeToken := s.UnsubscribeToken(9)
+	manageToken := s.ManageToken(9)
+	parts := strings.Split(manageToken, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		parse func(token string) error
+		want  error
+	}{
+		{
+			name:  "unsubscribe token used to manage",
+			token: unsubscribeToken,
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "unsubscribe token used to confirm",
+			token: unsubscribeToken,
+			parse: func(token string) error { _, err := s.ParseConfirmationToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "manage token used as a session",
+			token: manageToken,
+			parse: func(token string) error { _, err := s.ParseSessionToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "expired",
+			token: s.LoginToken(7, time.Now().Add(-time.Minute)),
+			parse: func(token string) error { _, err := s.ParseLoginToken(token); return err },
+			want:  ErrTokenExpired,
+		},
+		{
+			name:  "tampered subject",
+			token: "10." + parts[1] + "." + parts[2],
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "tampered expiry",
+			token: parts[0] + ".9999999999." + parts[2],
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "tampered signature",
+			token: parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")),
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "signature not base64",
+			token: parts[0] + "." + parts[1] + ".not base64!",
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "too few parts",
+			token: parts[0] + "." + parts[1],
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "too many parts",
+			token: manageToken + ".extra",
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "empty",
+			token: "",
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			// The signature is valid, so only the expiry check can reject it.
+			name: "non-numeric expiry",
+			token: "9.tomorrow." + base64.RawURLEncoding.EncodeToString(
+				s.signature(manageTokenPurpose, "9.tomorrow"),
+			),
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "non-numeric subject",
+			token: s.sign(manageTokenPurpose, "nine", expiresAt),
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+		{
+			name:  "signed with another secret",
+			token: newTestAuthService(t, "other secret").ManageToken(9),
+			parse: func(token string) error { _, err := s.ParseManageToken(token); return err },
+			want:  ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.parse(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestNewAuthServiceRequiresSecret(t *testing.T) {
+	if _, err := NewAuthService(&config.AuthConfig{}); err == nil {
+		t.Fatal("expected an error for the empty secret")
+	}
+}
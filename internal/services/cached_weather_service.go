@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/cache"
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+type reportFrequencyContextKey struct{}
+
+// WithReportFrequency marks lookups made with the returned context as part of
+// a report of the given frequency, so the cache can apply the frequency's TTL.
+func WithReportFrequency(ctx context.Context, frequency models.Frequency) context.Context {
+	return context.WithValue(ctx, reportFrequencyContextKey{}, frequency)
+}
+
+type cachedWeatherService struct {
+	weatherService WeatherService
+	current        *cache.Cache[CurrentWeatherResponse]
+	forecast       *cache.Cache[ForecastResponse]
+	locations      *cache.Cache[[]models.Location]
+	timezones      *cache.Cache[string]
+	defaultTTL     time.Duration
+	searchTTL      time.Duration
+	frequencyTTLs  map[models.Frequency]time.Duration
+}
+
+// NewCachedWeatherService wraps weatherService with caches shared by the API
+// and the report jobs. Unknown cities are cached too, for NotFoundTTL.
+func NewCachedWeatherService(
+	weatherService WeatherService,
+	cfg *config.WeatherCacheConfig,
+) WeatherService {
+	notFoundTTL := time.Duration(cfg.NotFoundTTL) * time.Second
+	errorTTL := func(err error) time.Duration {
+		if errors.Is(err, ErrCityNotFound) {
+			return notFoundTTL
+		}
+		return 0
+	}
+
+	return &cachedWeatherService{
+		weatherService: weatherService,
+		current:        cache.New[CurrentWeatherResponse](cfg.Size, errorTTL),
+		forecast:       cache.New[ForecastResponse](cfg.Size, errorTTL),
+		locations:      cache.New[[]models.Location](cfg.Size, nil),
+		timezones:      cache.New[string](cfg.Size, nil),
+		defaultTTL:     time.Duration(cfg.DefaultTTL) * time.Second,
+		searchTTL:      time.Duration(cfg.SearchTTL) * time.Second,
+		frequencyTTLs: map[models.Frequency]time.Duration{
+			models.Hourly: time.Duration(cfg.HourlyTTL) * time.Second,
+			models.Daily:  time.Duration(cfg.DailyTTL) * time.Second,
+			models.Weekly: time.Duration(cfg.DailyTTL) * time.Second,
+			models.Custom: time.Duration(cfg.DailyTTL) * time.Second,
+		},
+	}
+}
+
+func (cws *cachedWeatherService) GetCurrentWeather(
+	ctx context.Context,
+	query LocationQuery,
+) (CurrentWeatherResponse, error) {
+	return cws.current.Load(cacheKey(query.String()), cws.ttl(ctx), func() (CurrentWeatherResponse, error) {
+		// The result is shared with other callers, so it must not be cut short
+		// when the caller that happened to start the lookup goes away.
+		return cws.weatherService.GetCurrentWeather(context.WithoutCancel(ctx), query)
+	})
+}
+
+func (cws *cachedWeatherService) GetForecast(
+	ctx context.Context,
+	query LocationQuery,
+	days int,
+) (ForecastResponse, error) {
+	key := fmt.Sprintf("%s:%d", cacheKey(query.String()), days)
+	return cws.forecast.Load(key, cws.ttl(ctx), func() (ForecastResponse, error) {
+		return cws.weatherService.GetForecast(context.WithoutCancel(ctx), query, days)
+	})
+}
+
+// SearchLocations results change rarely, so they are kept for searchTTL
+// regardless of the caller. Empty results are cached like any other.
+func (cws *cachedWeatherService) SearchLocations(ctx context.Context, text string) ([]models.Location, error) {
+	return cws.locations.Load(cacheKey(text), cws.searchTTL, func() ([]models.Location, error) {
+		return cws.weatherService.SearchLocations(context.WithoutCancel(ctx), text)
+	})
+}
+
+// GetTimezone results are kept for searchTTL, like the locations they belong to.
+func (cws *cachedWeatherService) GetTimezone(ctx context.Context, query LocationQuery) (string, error) {
+	return cws.timezones.Load(cacheKey(query.String()), cws.searchTTL, func() (string, error) {
+		return cws.weatherService.GetTimezone(context.WithoutCancel(ctx), query)
+	})
+}
+
+func (cws *cachedWeatherService) ttl(ctx context.Context) time.Duration {
+	frequency, ok := ctx.Value(reportFrequencyContextKey{}).(models.Frequency)
+	if !ok {
+		return cws.defaultTTL
+	}
+
+	ttl, ok := cws.frequencyTTLs[frequency]
+	if !ok {
+		return cws.defaultTTL
+	}
+	return ttl
+}
+
+func cacheKey(text string) string {
+	return strings.ToLower(strings.TrimSpace(text))
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// countingWeatherService fails every current weather lookup with err.
+type countingWeatherService struct {
+	err   error
+	calls int
+}
+
+func (s *countingWeatherService) GetCurrentWeather(context.Context, LocationQuery) (CurrentWeatherResponse, error) {
+	s.calls++
+	return CurrentWeatherResponse{}, s.err
+}
+
+func (s *countingWeatherService) GetForecast(context.Context, LocationQuery, int) (ForecastResponse, error) {
+	return ForecastResponse{}, s.err
+}
+
+func (s *countingWeatherService) SearchLocations(context.Context, string) ([]models.Location, error) {
+	return nil, s.err
+}
+
+func (s *countingWeatherService) GetTimezone(context.Context, LocationQuery) (string, error) {
+	return "", s.err
+}
+
+func TestCachedWeatherServiceErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{name: "unknown cities are cached", err: fmt.Errorf("city Atlantis: %w", ErrCityNotFound), wantCalls: 1},
+		{name: "unavailable providers are not cached", err: ErrWeatherProviderUnavailable, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &countingWeatherService{err: tt.err}
+			cws := NewCachedWeatherService(upstream, &config.WeatherCacheConfig{
+				Size:        10,
+				DefaultTTL:  300,
+				NotFoundTTL: 3600,
+			})
+
+			for range 3 {
+				_, err := cws.GetCurrentWeather(context.Background(), CityQuery("Atlantis"))
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+			}
+
+			if upstream.calls != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, upstream.calls)
+			}
+		})
+	}
+}
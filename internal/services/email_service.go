@@ -1,168 +1,440 @@
 package services
 
 import (
-	"bytes"
 	// "crypto/tls"
+	"errors"
 	"fmt"
-	"html/template"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/kievzenit/genesis-case/internal/config"
 	"github.com/kievzenit/genesis-case/internal/models"
 	"github.com/kievzenit/genesis-case/internal/utils"
-	"gopkg.in/gomail.v2"
 )
 
 type WeatherData struct {
-	City        string
-	Temp        float64
-	Humidity    float64
-	Description string
+	City          string
+	Temp          float64
+	FeelsLike     float64
+	Humidity      float64
+	WindSpeed     float64
+	WindDirection string
+	Pressure      float64
+	Visibility    float64
+	UVIndex       float64
+	CloudCover    float64
+	Description   string
+	IconURL       string
+	// Outlook is today's forecast, it is rendered only when set.
+	Outlook *DailyForecast
+	// Overnight summarises the quiet hours, it is rendered only when set.
+	Overnight *DailyForecast
+}
+
+// CityReport is the section of a weather report about one subscription.
+type CityReport struct {
+	Subscription models.Subscription
+	WeatherData  WeatherData
+}
+
+type weatherReportSection struct {
+	Frequency       string
+	City            string
+	FullDate        string
+	Time            string
+	Description     string
+	IconURL         string
+	Temperature     string
+	FeelsLike       string
+	Humidity        string
+	WindSpeed       string
+	WindDirection   string
+	Pressure        string
+	Visibility      string
+	UVIndex         string
+	CloudCover      string
+	Outlook         *weatherReportOutlook
+	Overnight       *weatherReportOutlook
+	TemperatureUnit string
+	SpeedUnit       string
+	PressureUnit    string
+	DistanceUnit    string
+	ManageLink      string
+	PauseLink       string
+	UnsubscribeLink string
+}
+
+type weatherReportOutlook struct {
+	Description         string
+	MinTemperature      string
+	MaxTemperature      string
+	PrecipitationChance string
+	MaxWindSpeed        string
+	UVIndex             string
+}
+
+// TriggeredAlert is an alert rule that matched, Value is the observed value
+// in the units of the subscription.
+type TriggeredAlert struct {
+	Rule  models.AlertRule
+	Value float64
 }
 
 type EmailService interface {
+	// SendConfirmationEmail asks to confirm the subscriber's address,
+	// listing all of its subscriptions.
 	SendConfirmationEmail(
-		email string,
-		city string,
-		frequency models.Frequency,
-		token uuid.UUID,
+		subscriber models.Subscriber,
+		subscriptions []models.Subscription,
 	) error
-	SendWeatherReport(
+	// SendWeatherReport sends one email with a section per report.
+	SendWeatherReport(email string, reports []CityReport) error
+	SendWeatherAlert(
 		email string,
 		city string,
-		token uuid.UUID,
-		frequency models.Frequency,
+		subscriptionId int,
+		units models.Units,
+		timezone *time.Location,
 		weatherData WeatherData,
+		alerts []TriggeredAlert,
 	) error
+	SendLoginEmail(email string, token string, expiresAt time.Time) error
 }
 
-func NewEmailService(baseURL string, cfg *config.EmailServiceConfig) EmailService {
-	dialer := gomail.NewDialer(
-		cfg.Host,
-		cfg.Port,
-		cfg.Username,
-		cfg.Password,
-	)
-	dialer.SSL = cfg.SSL
-
+// NewEmailService builds the links of emails from baseURL,
+// which includes the scheme, e.g. https://weather.example.com.
+func NewEmailService(
+	baseURL string,
+	cfg *config.EmailServiceConfig,
+	mailer Mailer,
+	templates EmailTemplates,
+	authService AuthService,
+) EmailService {
 	return &emailService{
-		from:    cfg.From,
-		baseURL: baseURL,
-		dialer:  dialer,
+		from:        cfg.From,
+		baseURL:     baseURL,
+		mailer:      mailer,
+		templates:   templates,
+		authService: authService,
 	}
 }
 
 type emailService struct {
-	from    string
-	baseURL string
-	dialer  *gomail.Dialer
+	from        string
+	baseURL     string
+	mailer      Mailer
+	templates   EmailTemplates
+	authService AuthService
 }
 
-func convertFrequencyToReportPeriod(frequency models.Frequency) string {
-	switch frequency {
-	case models.Daily:
-		return "24 hours"
-	case models.Hourly:
-		return "1 hour"
-	default:
-		panic("unknown frequency")
+var emailTemplateFuncs = map[string]any{
+	"UpperFirstLetter": utils.UpperFirstLetter,
+}
+
+var errNoConfirmationExpiry = errors.New("subscriber has no confirmation expiry")
+
+// manageLink, pauseLink and unsubscribeLink are signed for one subscription,
+// unsubscribe links cannot be used to manage it.
+func (e *emailService) manageLink(subscriptionId int) string {
+	return fmt.Sprintf("%s/subscriptions/%s/manage", e.baseURL, e.authService.ManageToken(subscriptionId))
+}
+
+func (e *emailService) pauseLink(subscriptionId int) string {
+	return fmt.Sprintf("%s/pause/%s?days=7", e.baseURL, e.authService.ManageToken(subscriptionId))
+}
+
+func (e *emailService) unsubscribeLink(subscriptionIds ...int) string {
+	return fmt.Sprintf("%s/unsubscribe/%s", e.baseURL, e.authService.UnsubscribeToken(subscriptionIds...))
+}
+
+// setListUnsubscribeHeaders lets mail clients show their own unsubscribe
+// button, with one-click unsubscribe as described in RFC 8058.
+func setListUnsubscribeHeaders(msg *Email, unsubscribeLink string) {
+	msg.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeLink + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 	}
 }
 
+func convertForecastToReportOutlook(units models.Units, forecast *DailyForecast) *weatherReportOutlook {
+	if forecast == nil {
+		return nil
+	}
+
+	return &weatherReportOutlook{
+		Description:         forecast.Condition,
+		MinTemperature:      fmt.Sprintf("%.1f", units.Temperature(forecast.MinTemperature)),
+		MaxTemperature:      fmt.Sprintf("%.1f", units.Temperature(forecast.MaxTemperature)),
+		PrecipitationChance: fmt.Sprintf("%.0f", forecast.PrecipitationChance),
+		MaxWindSpeed:        fmt.Sprintf("%.1f", units.Speed(forecast.MaxWindSpeed)),
+		UVIndex:             fmt.Sprintf("%.1f", forecast.UVIndex),
+	}
+}
+
+// formatPressure keeps two decimals for inHg, whole hPa are precise enough.
+func formatPressure(units models.Units, hectopascals float64) string {
+	if units == models.Imperial {
+		return fmt.Sprintf("%.2f", units.Pressure(hectopascals))
+	}
+	return fmt.Sprintf("%.0f", units.Pressure(hectopascals))
+}
+
+type confirmationEmailSubscription struct {
+	City     string
+	Schedule string
+}
+
 func (e *emailService) SendConfirmationEmail(
-	email string,
-	city string,
-	frequency models.Frequency,
-	token uuid.UUID,
+	subscriber models.Subscriber,
+	subscriptions []models.Subscription,
 ) error {
-	msg := gomail.NewMessage()
+	if subscriber.ConfirmationExpiresAt == nil {
+		return errNoConfirmationExpiry
+	}
+	token := e.authService.ConfirmationToken(subscriber.Token, *subscriber.ConfirmationExpiresAt)
 
-	msg.SetHeader("From", e.from)
-	msg.SetHeader("To", email)
-	msg.SetHeader("Subject", "Weather subscription confirmation")
+	msg := Email{
+		From:    e.from,
+		To:      subscriber.Email,
+		Subject: "Weather subscription confirmation",
+	}
 
-	emailBodyTemplate, err := template.ParseFiles("./templates/email/subscription_confirmation_email.html")
-	if err != nil {
-		return err
+	timezone := time.UTC
+	confirmationSubscriptions := make([]confirmationEmailSubscription, 0, len(subscriptions))
+	for i, subscription := range subscriptions {
+		if i == 0 {
+			timezone = subscription.TimeLocation()
+		}
+
+		schedule := subscription.DescribeSchedule()
+		if subscription.Frequency == models.Alert {
+			schedule = "weather alerts"
+		}
+		confirmationSubscriptions = append(confirmationSubscriptions, confirmationEmailSubscription{
+			City:     subscription.City,
+			Schedule: schedule,
+		})
 	}
 
-	var emailBodyBuf bytes.Buffer
-	err = emailBodyTemplate.Execute(&emailBodyBuf, struct {
+	data := struct {
 		CustomerEmail    string
-		City             string
-		Frequency        string
+		Subscriptions    []confirmationEmailSubscription
 		Date             string
-		ReportPeriod     string
 		ConfirmationLink string
 	}{
-		CustomerEmail:    email,
-		City:             city,
-		Frequency:        string(frequency),
-		Date:             time.Now().Format("January 2, 2006"),
-		ReportPeriod:     convertFrequencyToReportPeriod(frequency),
-		ConfirmationLink: fmt.Sprintf("http://%s/confirm/%s", e.baseURL, token.String()),
-	})
+		CustomerEmail:    subscriber.Email,
+		Subscriptions:    confirmationSubscriptions,
+		Date:             time.Now().In(timezone).Format("January 2, 2006"),
+		ConfirmationLink: fmt.Sprintf("%s/confirm/%s", e.baseURL, token),
+	}
+
+	var err error
+	msg.HTMLBody, msg.TextBody, err = e.templates.Render(confirmationEmailTemplate, data)
 	if err != nil {
 		return err
 	}
 
-	msg.SetBody("text/html", emailBodyBuf.String())
+	return e.mailer.Send(msg)
+}
+
+func (e *emailService) SendWeatherReport(email string, reports []CityReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
 
-	return e.dialer.DialAndSend(msg)
+	msg := Email{}
+
+	cities := make([]string, 0, len(reports))
+	subscriptionIds := make([]int, 0, len(reports))
+	for _, report := range reports {
+		cities = append(cities, report.WeatherData.City)
+		subscriptionIds = append(subscriptionIds, report.Subscription.Id)
+	}
+
+	msg.From = e.from
+	msg.To = email
+	msg.Subject = fmt.Sprintf("Weather report for %s", joinCities(cities))
+	// The headers unsubscribe from every city of the report,
+	// the links in the sections from one city only.
+	setListUnsubscribeHeaders(&msg, e.unsubscribeLink(subscriptionIds...))
+
+	// The heading names the frequency only when all sections share it.
+	frequency := string(reports[0].Subscription.Frequency)
+	sections := make([]weatherReportSection, 0, len(reports))
+	for _, report := range reports {
+		if string(report.Subscription.Frequency) != frequency {
+			frequency = ""
+		}
+		sections = append(sections, e.newWeatherReportSection(report))
+	}
+
+	data := struct {
+		Frequency     string
+		Date          string
+		Sections      []weatherReportSection
+		CustomerEmail string
+	}{
+		Frequency:     frequency,
+		Date:          time.Now().In(reports[0].Subscription.TimeLocation()).Format("January 2, 2006"),
+		Sections:      sections,
+		CustomerEmail: email,
+	}
+
+	var err error
+	msg.HTMLBody, msg.TextBody, err = e.templates.Render(weatherReportEmailTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	return e.mailer.Send(msg)
 }
 
-func (e *emailService) SendWeatherReport(
+func (e *emailService) newWeatherReportSection(report CityReport) weatherReportSection {
+	subscription := report.Subscription
+	weatherData := report.WeatherData
+	units := subscription.Units
+	now := time.Now().In(subscription.TimeLocation())
+
+	return weatherReportSection{
+		Frequency:       string(subscription.Frequency),
+		City:            weatherData.City,
+		FullDate:        now.Format("Monday, January 2, 2006"),
+		Time:            now.Format("15:04 MST"),
+		Description:     weatherData.Description,
+		IconURL:         weatherData.IconURL,
+		Temperature:     fmt.Sprintf("%.2f", units.Temperature(weatherData.Temp)),
+		FeelsLike:       fmt.Sprintf("%.1f", units.Temperature(weatherData.FeelsLike)),
+		Humidity:        fmt.Sprintf("%.2f", weatherData.Humidity),
+		WindSpeed:       fmt.Sprintf("%.1f", units.Speed(weatherData.WindSpeed)),
+		WindDirection:   weatherData.WindDirection,
+		Pressure:        formatPressure(units, weatherData.Pressure),
+		Visibility:      fmt.Sprintf("%.1f", units.Distance(weatherData.Visibility)),
+		UVIndex:         fmt.Sprintf("%.1f", weatherData.UVIndex),
+		CloudCover:      fmt.Sprintf("%.0f", weatherData.CloudCover),
+		Outlook:         convertForecastToReportOutlook(units, weatherData.Outlook),
+		Overnight:       convertForecastToReportOutlook(units, weatherData.Overnight),
+		TemperatureUnit: units.TemperatureSymbol(),
+		SpeedUnit:       units.SpeedSymbol(),
+		PressureUnit:    units.PressureSymbol(),
+		DistanceUnit:    units.DistanceSymbol(),
+		ManageLink:      e.manageLink(subscription.Id),
+		PauseLink:       e.pauseLink(subscription.Id),
+		UnsubscribeLink: e.unsubscribeLink(subscription.Id),
+	}
+}
+
+// joinCities renders city names as "Kyiv, Lviv and Odesa".
+func joinCities(cities []string) string {
+	if len(cities) == 1 {
+		return cities[0]
+	}
+	return strings.Join(cities[:len(cities)-1], ", ") + " and " + cities[len(cities)-1]
+}
+
+func (e *emailService) SendWeatherAlert(
 	email string,
 	city string,
-	token uuid.UUID,
-	frequency models.Frequency,
+	subscriptionId int,
+	units models.Units,
+	timezone *time.Location,
 	weatherData WeatherData,
+	alerts []TriggeredAlert,
 ) error {
-	msg := gomail.NewMessage()
-
-	msg.SetHeader("From", e.from)
-	msg.SetHeader("To", email)
-	msg.SetHeader("Subject", fmt.Sprintf("Weather report for %s", city))
+	msg := Email{
+		From:    e.from,
+		To:      email,
+		Subject: fmt.Sprintf("Weather alert for %s", city),
+	}
+	setListUnsubscribeHeaders(&msg, e.unsubscribeLink(subscriptionId))
 
-	emailBodyTemplate, err := template.New("weather_report_email.html").
-		Funcs(template.FuncMap{
-			"UpperFirstLetter": utils.UpperFirstLetter,
-		}).
-		ParseFiles("./templates/email/weather_report_email.html")
-	if err != nil {
-		return err
+	alertDescriptions := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		alertDescriptions = append(alertDescriptions, describeTriggeredAlert(units, alert))
 	}
 
-	var emailBodyBuf bytes.Buffer
-	err = emailBodyTemplate.Execute(&emailBodyBuf, struct {
-		Frequency       string
-		Date            string
+	now := time.Now().In(timezone)
+
+	data := struct {
 		City            string
 		FullDate        string
 		Time            string
 		Description     string
 		Temperature     string
-		Humidity        string
+		TemperatureUnit string
+		Alerts          []string
+		ManageLink      string
 		UnsubscribeLink string
 		CustomerEmail   string
 	}{
-		Frequency:       string(frequency),
-		Date:            time.Now().Format("January 2, 2006"),
 		City:            weatherData.City,
-		FullDate:        time.Now().Format("Monday, January 2, 2006"),
-		Time:            time.Now().Format("15:04"),
+		FullDate:        now.Format("Monday, January 2, 2006"),
+		Time:            now.Format("15:04 MST"),
 		Description:     weatherData.Description,
-		Temperature:     fmt.Sprintf("%.2f", weatherData.Temp),
-		Humidity:        fmt.Sprintf("%.2f", weatherData.Humidity),
-		UnsubscribeLink: fmt.Sprintf("http://%s/unsubscribe/%s", e.baseURL, token.String()),
+		Temperature:     fmt.Sprintf("%.1f", units.Temperature(weatherData.Temp)),
+		TemperatureUnit: units.TemperatureSymbol(),
+		Alerts:          alertDescriptions,
+		ManageLink:      e.manageLink(subscriptionId),
+		UnsubscribeLink: e.unsubscribeLink(subscriptionId),
 		CustomerEmail:   email,
-	})
+	}
+
+	var err error
+	msg.HTMLBody, msg.TextBody, err = e.templates.Render(weatherAlertEmailTemplate, data)
 	if err != nil {
 		return err
 	}
 
-	msg.SetBody("text/html", emailBodyBuf.String())
+	return e.mailer.Send(msg)
+}
+
+// describeTriggeredAlert renders an alert as, for example,
+// "Temperature is -3.0°C, below your 0.0°C threshold".
+func describeTriggeredAlert(units models.Units, alert TriggeredAlert) string {
+	var name, unit string
+	switch alert.Rule.Metric {
+	case models.TemperatureMetric:
+		name, unit = "Temperature", units.TemperatureSymbol()
+	case models.PrecipitationMetric:
+		name, unit = "Chance of precipitation", "%"
+	case models.WindSpeedMetric:
+		name, unit = "Wind speed", " "+units.SpeedSymbol()
+	case models.UVIndexMetric:
+		name, unit = "UV index", ""
+	}
+
+	return fmt.Sprintf(
+		"%s is %.1f%s, %s your %.1f%s threshold",
+		name,
+		alert.Value,
+		unit,
+		alert.Rule.Operator,
+		alert.Rule.Threshold,
+		unit,
+	)
+}
+
+func (e *emailService) SendLoginEmail(email string, token string, expiresAt time.Time) error {
+	msg := Email{
+		From:    e.from,
+		To:      email,
+		Subject: "Sign in to your weather subscriptions",
+	}
+
+	data := struct {
+		CustomerEmail string
+		LoginLink     string
+		ExpiresIn     int
+	}{
+		CustomerEmail: email,
+		LoginLink:     fmt.Sprintf("%s/auth/login/%s", e.baseURL, token),
+		ExpiresIn:     int(time.Until(expiresAt).Round(time.Minute).Minutes()),
+	}
+
+	var err error
+	msg.HTMLBody, msg.TextBody, err = e.templates.Render(loginEmailTemplate, data)
+	if err != nil {
+		return err
+	}
 
-	return e.dialer.DialAndSend(msg)
+	return e.mailer.Send(msg)
 }
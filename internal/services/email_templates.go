@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/templates"
+)
+
+const (
+	confirmationEmailTemplate  = "subscription_confirmation_email"
+	weatherReportEmailTemplate = "weather_report_email"
+	weatherAlertEmailTemplate  = "weather_alert_email"
+	loginEmailTemplate         = "login_email"
+)
+
+var emailTemplateNames = []string{
+	confirmationEmailTemplate,
+	weatherReportEmailTemplate,
+	weatherAlertEmailTemplate,
+	loginEmailTemplate,
+}
+
+// EmailTemplates renders the HTML and plain text bodies of emails. Every
+// email has an HTML template and an optional text one, emails without
+// a text template get the text of their HTML body.
+type EmailTemplates interface {
+	Render(name string, data any) (htmlBody string, textBody string, err error)
+	// ReloadChanged parses the templates again when a file of the override
+	// directory changed. Templates with errors are logged and not used,
+	// the previous ones are kept.
+	ReloadChanged()
+}
+
+// NewEmailTemplates parses the templates embedded into the binary, the
+// ones found in the override directory replace them. It fails on the
+// first template that does not parse, so broken templates are noticed
+// at startup instead of on the first send.
+func NewEmailTemplates(cfg *config.EmailServiceConfig) (EmailTemplates, error) {
+	t := &emailTemplates{
+		overrideDirectory: cfg.TemplatesDirectory,
+	}
+
+	parsed, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	t.templates = parsed
+	t.overrideState = t.readOverrideState()
+
+	return t, nil
+}
+
+type emailTemplates struct {
+	overrideDirectory string
+
+	mu        sync.RWMutex
+	templates map[string]emailTemplate
+	// overrideState tells the override files apart between reloads.
+	overrideState string
+}
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	// text is nil for emails without a text template.
+	text *texttemplate.Template
+}
+
+func (t *emailTemplates) Render(name string, data any) (string, string, error) {
+	t.mu.RLock()
+	tmpl, ok := t.templates[name]
+	t.mu.RUnlock()
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template %q", name)
+	}
+
+	var htmlBody strings.Builder
+	err := tmpl.html.Execute(&htmlBody, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	if tmpl.text == nil {
+		return htmlBody.String(), htmlToText(htmlBody.String()), nil
+	}
+
+	var textBody strings.Builder
+	err = tmpl.text.Execute(&textBody, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return htmlBody.String(), textBody.String(), nil
+}
+
+func (t *emailTemplates) ReloadChanged() {
+	state := t.readOverrideState()
+	if state == t.overrideState {
+		return
+	}
+	t.overrideState = state
+
+	parsed, err := t.parse()
+	if err != nil {
+		log.Printf("failed to reload email templates: %v", err)
+		return
+	}
+
+	t.mu.Lock()
+	t.templates = parsed
+	t.mu.Unlock()
+	log.Println("email templates reloaded")
+}
+
+func (t *emailTemplates) parse() (map[string]emailTemplate, error) {
+	parsed := make(map[string]emailTemplate, len(emailTemplateNames))
+	for _, name := range emailTemplateNames {
+		tmpl, err := t.parseTemplate(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+	return parsed, nil
+}
+
+// parseTemplate takes both files of an email from the override directory when
+// it has the HTML one. The embedded text template is not used with an overridden
+// HTML one, since it would not match it.
+func (t *emailTemplates) parseTemplate(name string) (emailTemplate, error) {
+	var source fs.FS = templates.FS
+	directory := "email"
+	if t.overrideDirectory != "" {
+		_, err := os.Stat(filepath.Join(t.overrideDirectory, name+".html"))
+		if err == nil {
+			source = os.DirFS(t.overrideDirectory)
+			directory = "."
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return emailTemplate{}, err
+		}
+	}
+
+	htmlTemplate, err := htmltemplate.New(name+".html").
+		Funcs(emailTemplateFuncs).
+		ParseFS(source, path.Join(directory, name+".html"))
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	textPath := path.Join(directory, name+".txt")
+	_, err = fs.Stat(source, textPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return emailTemplate{html: htmlTemplate}, nil
+	}
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	textTemplate, err := texttemplate.New(name+".txt").
+		Funcs(emailTemplateFuncs).
+		ParseFS(source, textPath)
+	if err != nil {
+		return emailTemplate{}, err
+	}
+
+	return emailTemplate{html: htmlTemplate, text: textTemplate}, nil
+}
+
+// readOverrideState describes the template files of the override directory
+// by their size and modification time.
+func (t *emailTemplates) readOverrideState() string {
+	if t.overrideDirectory == "" {
+		return ""
+	}
+
+	var state strings.Builder
+	for _, name := range emailTemplateNames {
+		for _, file := range []string{name + ".html", name + ".txt"} {
+			info, err := os.Stat(filepath.Join(t.overrideDirectory, file))
+			if err != nil {
+				fmt.Fprintf(&state, "%s:missing;", file)
+				continue
+			}
+			fmt.Fprintf(&state, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return state.String()
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/templates"
+)
+
+var update = flag.Bool("update", false, "update the golden files of email templates")
+
+// emailTemplateCases hold the data the email service renders every template
+// with, fixed so the output does not depend on the time or on signed tokens.
+var emailTemplateCases = []struct {
+	name string
+	data any
+}{
+	{
+		name: confirmationEmailTemplate,
+		data: struct {
+			CustomerEmail    string
+			Subscriptions    []confirmationEmailSubscription
+			Date             string
+			ConfirmationLink string
+		}{
+			CustomerEmail: "user@example.com",
+			Subscriptions: []confirmationEmailSubscription{
+				{City: "Kyiv", Schedule: "daily at 08:00"},
+				{City: "Lviv", Schedule: "weather alerts"},
+			},
+			Date:             "March 9, 2026",
+			ConfirmationLink: "https://weather.example.com/confirm/confirmation-token",
+		},
+	},
+	{
+		name: weatherReportEmailTemplate,
+		data: struct {
+			Frequency     string
+			Date          string
+			Sections      []weatherReportSection
+			CustomerEmail string
+		}{
+			Date: "March 9, 2026",
+			Sections: []weatherReportSection{
+				{
+					Frequency:     "daily",
+					City:          "Kyiv",
+					FullDate:      "Monday, March 9, 2026",
+					Time:          "08:00 EET",
+					Description:   "Partly cloudy",
+					IconURL:       "https://weather.example.com/icons/partly-cloudy.png",
+					Temperature:   "4.50",
+					FeelsLike:     "1.2",
+					Humidity:      "81.00",
+					WindSpeed:     "14.4",
+					WindDirection: "NW",
+					Pressure:      "1016",
+					Visibility:    "10.0",
+					UVIndex:       "1.0",
+					CloudCover:    "40",
+					Outlook: &weatherReportOutlook{
+						Description:         "Light rain",
+						MinTemperature:      "1.0",
+						MaxTemperature:      "7.5",
+						PrecipitationChance: "70",
+						MaxWindSpeed:        "21.6",
+						UVIndex:             "2.0",
+					},
+					Overnight: &weatherReportOutlook{
+						Description:         "Clear",
+						MinTemperature:      "-2.0",
+						MaxTemperature:      "3.0",
+						PrecipitationChance: "5",
+						MaxWindSpeed:        "10.8",
+						UVIndex:             "0.0",
+					},
+					TemperatureUnit: "°C",
+					SpeedUnit:       "km/h",
+					PressureUnit:    "hPa",
+					DistanceUnit:    "km",
+					ManageLink:      "https://weather.example.com/subscriptions/kyiv-token/manage",
+					PauseLink:       "https://weather.example.com/pause/kyiv-token?days=7",
+					UnsubscribeLink: "https://weather.example.com/unsubscribe/kyiv-token",
+				},
+				{
+					Frequency:       "hourly",
+					City:            "Lviv",
+					FullDate:        "Monday, March 9, 2026",
+					Time:            "08:00 EET",
+					Description:     "Snow",
+					Temperature:     "30.20",
+					FeelsLike:       "24.8",
+					Humidity:        "93.00",
+					WindSpeed:       "6.2",
+					WindDirection:   "E",
+					Pressure:        "29.88",
+					Visibility:      "2.5",
+					UVIndex:         "0.0",
+					CloudCover:      "100",
+					TemperatureUnit: "°F",
+					SpeedUnit:       "mph",
+					PressureUnit:    "inHg",
+					DistanceUnit:    "mi",
+					ManageLink:      "https://weather.example.com/subscriptions/lviv-token/manage",
+					PauseLink:       "https://weather.example.com/pause/lviv-token?days=7",
+					UnsubscribeLink: "https://weather.example.com/unsubscribe/lviv-token",
+				},
+			},
+			CustomerEmail: "user@example.com",
+		},
+	},
+	{
+		name: weatherAlertEmailTemplate,
+		data: struct {
+			City            string
+			FullDate        string
+			Time            string
+			Description     string
+			Temperature     string
+			TemperatureUnit string
+			Alerts          []string
+			ManageLink      string
+			UnsubscribeLink string
+			CustomerEmail   string
+		}{
+			City:            "Odesa",
+			FullDate:        "Monday, March 9, 2026",
+			Time:            "14:30 EET",
+			Description:     "Thunderstorm",
+			Temperature:     "-3.0",
+			TemperatureUnit: "°C",
+			Alerts: []string{
+				"Temperature is -3.0°C, below your 0.0°C threshold",
+				"Wind speed is 62.0 km/h, above your 50.0 km/h threshold",
+			},
+			ManageLink:      "https://weather.example.com/subscriptions/odesa-token/manage",
+			UnsubscribeLink: "https://weather.example.com/unsubscribe/odesa-token",
+			CustomerEmail:   "user@example.com",
+		},
+	},
+	{
+		name: loginEmailTemplate,
+		data: struct {
+			CustomerEmail string
+			LoginLink     string
+			ExpiresIn     int
+		}{
+			CustomerEmail: "user@example.com",
+			LoginLink:     "https://weather.example.com/auth/login/login-token",
+			ExpiresIn:     15,
+		},
+	},
+}
+
+func TestEmailTemplatesRender(t *testing.T) {
+	emailTemplates, err := NewEmailTemplates(&config.EmailServiceConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range emailTemplateCases {
+		t.Run(tt.name, func(t *testing.T) {
+			htmlBody, textBody, err := emailTemplates.Render(tt.name, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertGolden(t, tt.name+".html.golden", htmlBody)
+			assertGolden(t, tt.name+".txt.golden", textBody)
+		})
+	}
+}
+
+// An overridden HTML template without a text one gets the text of its HTML body.
+func TestEmailTemplatesRenderTextFromHTML(t *testing.T) {
+	html, err := templates.FS.ReadFile("email/" + loginEmailTemplate + ".html")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	directory := t.TempDir()
+	err = os.WriteFile(filepath.Join(directory, loginEmailTemplate+".html"), html, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	emailTemplates, err := NewEmailTemplates(&config.EmailServiceConfig{TemplatesDirectory: directory})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range emailTemplateCases {
+		if tt.name != loginEmailTemplate {
+			continue
+		}
+
+		htmlBody, textBody, err := emailTemplates.Render(tt.name, tt.data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertGolden(t, tt.name+".html.golden", htmlBody)
+		assertGolden(t, tt.name+"_from_html.txt.golden", textBody)
+	}
+}
+
+// assertGolden compares got with the file in testdata,
+// go test -update writes got into the file instead.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		err := os.MkdirAll("testdata", 0o755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(got), 0o644)
+		}
+		if err != nil {
+			t.Fatalf("failed to update %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s, run go test -update to create it: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match, run go test -update after checking the change:\n%s", path, got)
+	}
+}
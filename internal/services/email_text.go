@@ -0,0 +1,42 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlHiddenElementsRegexp = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	htmlLinkRegexp           = regexp.MustCompile(`(?is)<a\b[^>]*\bhref="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlListItemRegexp       = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	htmlLineBreakRegexp      = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|ul|ol|tr|table)>`)
+	htmlTagRegexp            = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinesRegexp         = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText keeps the text of an HTML email, links become "text (url)"
+// and block elements end a line.
+func htmlToText(body string) string {
+	body = htmlHiddenElementsRegexp.ReplaceAllString(body, "")
+	body = htmlLinkRegexp.ReplaceAllStringFunc(body, func(link string) string {
+		match := htmlLinkRegexp.FindStringSubmatch(link)
+		url, text := match[1], strings.TrimSpace(htmlTagRegexp.ReplaceAllString(match[2], ""))
+		if text == "" || text == url {
+			return url
+		}
+		return text + " (" + url + ")"
+	})
+	body = htmlListItemRegexp.ReplaceAllString(body, "\n- ")
+	body = htmlLineBreakRegexp.ReplaceAllString(body, "\n")
+	body = htmlTagRegexp.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	body = blankLinesRegexp.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	return strings.TrimSpace(body) + "\n"
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+const fileTransportName = "file"
+
+// fileMailer writes every email as an .eml file into a directory,
+// mail clients open them as they would have been received.
+type fileMailer struct {
+	directory string
+}
+
+func newFileMailer(cfg *config.EmailServiceConfig) (Mailer, error) {
+	err := os.MkdirAll(cfg.FileDirectory, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("%s email transport: %w", fileTransportName, err)
+	}
+
+	return &fileMailer{directory: cfg.FileDirectory}, nil
+}
+
+func (m *fileMailer) Send(email Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+	file, err := os.Create(filepath.Join(m.directory, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = email.gomailMessage().WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+func TestFileMailerSend(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "emails")
+	mailer, err := newFileMailer(&config.EmailServiceConfig{FileDirectory: directory})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	email := testEmail()
+	if err := mailer.Send(email); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v, %v", files, err)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatalf("failed to parse the .eml file: %v", err)
+	}
+	if msg.Header.Get("To") != email.To || msg.Header.Get("Subject") != email.Subject {
+		t.Errorf("unexpected headers: %v", msg.Header)
+	}
+	if msg.Header.Get("List-Unsubscribe") != email.Headers["List-Unsubscribe"] {
+		t.Errorf("expected the List-Unsubscribe header, got %q", msg.Header.Get("List-Unsubscribe"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative email, got %q, %v", mediaType, err)
+	}
+
+	bodies := make(map[string]string)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read a MIME part: %v", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read a MIME part: %v", err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[partType] = strings.TrimSpace(string(body))
+	}
+
+	if bodies["text/plain"] != email.TextBody {
+		t.Errorf("expected the text part %q, got %q", email.TextBody, bodies["text/plain"])
+	}
+	if bodies["text/html"] != email.HTMLBody {
+		t.Errorf("expected the HTML part %q, got %q", email.HTMLBody, bodies["text/html"])
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+const httpTransportName = "http"
+
+const httpMailerTimeout = 10 * time.Second
+
+// httpMailer posts emails as JSON to an email API, the body follows
+// the shape most providers accept, Resend's for example, so a provider
+// or a local stub can be used without a dedicated client.
+type httpMailer struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newHTTPMailer(cfg *config.EmailServiceConfig) (Mailer, error) {
+	if cfg.HttpURL == "" {
+		return nil, fmt.Errorf("%s email transport requires a url", httpTransportName)
+	}
+
+	return &httpMailer{
+		url:        cfg.HttpURL,
+		apiKey:     cfg.HttpApiKey,
+		httpClient: &http.Client{Timeout: httpMailerTimeout},
+	}, nil
+}
+
+type httpMailerRequest struct {
+	From    string            `json:"from"`
+	To      []string          `json:"to"`
+	Subject string            `json:"subject"`
+	HTML    string            `json:"html"`
+	Text    string            `json:"text,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (m *httpMailer) Send(email Email) error {
+	body, err := json.Marshal(httpMailerRequest{
+		From:    email.From,
+		To:      []string{email.To},
+		Subject: email.Subject,
+		HTML:    email.HTMLBody,
+		Text:    email.TextBody,
+		Headers: email.Headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The start of the body usually tells why the email was rejected.
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s email transport: unexpected status %d: %s", httpTransportName, resp.StatusCode, message)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+func testEmail() Email {
+	return Email{
+		From:     "weather@example.com",
+		To:       "user@example.com",
+		Subject:  "Weather report for Kyiv",
+		Headers:  map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe/token>"},
+		HTMLBody: "<p>Sunny, 21 degrees</p>",
+		TextBody: "Sunny, 21 degrees",
+	}
+}
+
+func TestHTTPMailerSend(t *testing.T) {
+	var request httpMailerRequest
+	var authorization, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode the request: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	mailer, err := newHTTPMailer(&config.EmailServiceConfig{HttpURL: server.URL, HttpApiKey: "api-key"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	email := testEmail()
+	if err := mailer.Send(email); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if authorization != "Bearer api-key" {
+		t.Errorf("expected the api key as bearer token, got %q", authorization)
+	}
+	if contentType != "application/json" {
+		t.Errorf("expected a JSON request, got %q", contentType)
+	}
+	if request.From != email.From || !slices.Equal(request.To, []string{email.To}) || request.Subject != email.Subject {
+		t.Errorf("unexpected addresses or subject: %+v", request)
+	}
+	if request.HTML != email.HTMLBody || request.Text != email.TextBody {
+		t.Errorf("unexpected bodies: %+v", request)
+	}
+	if !maps.Equal(request.Headers, email.Headers) {
+		t.Errorf("expected headers %v, got %v", email.Headers, request.Headers)
+	}
+}
+
+func TestHTTPMailerSendWithoutApiKey(t *testing.T) {
+	authorization := "not called"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	mailer, err := newHTTPMailer(&config.EmailServiceConfig{HttpURL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mailer.Send(testEmail()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if authorization != "" {
+		t.Errorf("expected no Authorization header, got %q", authorization)
+	}
+}
+
+func TestHTTPMailerSendErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "rejected email", status: http.StatusUnprocessableEntity, body: "invalid from address", wantErr: "unexpected status 422: invalid from address"},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: "unexpected status 500"},
+		{name: "other non-2xx status", status: http.StatusNotModified, wantErr: "unexpected status 304"},
+		{name: "long body is cut", status: http.StatusBadRequest, body: strings.Repeat("x", 1024), wantErr: strings.Repeat("x", 512)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			mailer, err := newHTTPMailer(&config.EmailServiceConfig{HttpURL: server.URL})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = mailer.Send(testEmail())
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %q", tt.wantErr, err)
+			}
+			if strings.Contains(err.Error(), strings.Repeat("x", 513)) {
+				t.Error("expected the response body to be cut")
+			}
+		})
+	}
+}
+
+func TestNewHTTPMailerRequiresURL(t *testing.T) {
+	_, err := newHTTPMailer(&config.EmailServiceConfig{})
+	if err == nil {
+		t.Fatal("expected an error without a url")
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"strconv"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// LocationQuery identifies a place for weather lookups, either by a free
+// form city name or by coordinates of an already resolved location.
+type LocationQuery struct {
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+func CityQuery(city string) LocationQuery {
+	return LocationQuery{City: city}
+}
+
+func LocationCoordinatesQuery(location models.Location) LocationQuery {
+	return LocationQuery{
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+	}
+}
+
+// SubscriptionQuery prefers the resolved coordinates of a subscription and
+// falls back to its city name for subscriptions that were never resolved.
+func SubscriptionQuery(subscription models.Subscription) LocationQuery {
+	if subscription.Location == nil {
+		return CityQuery(subscription.City)
+	}
+	return LocationCoordinatesQuery(*subscription.Location)
+}
+
+func (q LocationQuery) HasCoordinates() bool {
+	return q.City == ""
+}
+
+// String returns the city name or "lat,lon", which is the format
+// most providers accept as a free form location.
+func (q LocationQuery) String() string {
+	if !q.HasCoordinates() {
+		return q.City
+	}
+	return q.LatitudeString() + "," + q.LongitudeString()
+}
+
+func (q LocationQuery) LatitudeString() string {
+	return strconv.FormatFloat(q.Latitude, 'f', -1, 64)
+}
+
+func (q LocationQuery) LongitudeString() string {
+	return strconv.FormatFloat(q.Longitude, 'f', -1, 64)
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"log"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+)
+
+const logTransportName = "log"
+
+// logMailer only logs emails, with their plain text body when
+// they have one, it is meant for development.
+type logMailer struct{}
+
+func newLogMailer(cfg *config.EmailServiceConfig) (Mailer, error) {
+	return &logMailer{}, nil
+}
+
+func (m *logMailer) Send(email Email) error {
+	body := email.TextBody
+	if body == "" {
+		body = email.HTMLBody
+	}
+	log.Printf("email from %s to %s: %s\n%s", email.From, email.To, email.Subject, body)
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"gopkg.in/gomail.v2"
+)
+
+// Email is a rendered message, mailers convert it
+// to the format of their transport.
+type Email struct {
+	From    string
+	To      string
+	Subject string
+	// Headers are additional headers, like List-Unsubscribe.
+	Headers  map[string]string
+	HTMLBody string
+	// TextBody is the plain text alternative of HTMLBody.
+	TextBody string
+}
+
+// Mailer delivers emails over one transport.
+type Mailer interface {
+	Send(email Email) error
+}
+
+// MailerFactory builds a mailer from the email service config.
+type MailerFactory func(cfg *config.EmailServiceConfig) (Mailer, error)
+
+var mailerFactories = map[string]MailerFactory{
+	smtpTransportName: newSMTPMailer,
+	httpTransportName: newHTTPMailer,
+	fileTransportName: newFileMailer,
+	logTransportName:  newLogMailer,
+}
+
+// RegisterMailer makes a transport available by name for WAPP_EMAIL_TRANSPORT.
+func RegisterMailer(name string, factory MailerFactory) {
+	mailerFactories[name] = factory
+}
+
+// NewMailer builds the mailer of the configured transport.
+func NewMailer(cfg *config.EmailServiceConfig) (Mailer, error) {
+	factory, ok := mailerFactories[cfg.Transport]
+	if !ok {
+		names := make([]string, 0, len(mailerFactories))
+		for registered := range mailerFactories {
+			names = append(names, registered)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown email transport %q, available transports: %v", cfg.Transport, names)
+	}
+
+	return factory(cfg)
+}
+
+func (email Email) gomailMessage() *gomail.Message {
+	msg := gomail.NewMessage()
+
+	msg.SetHeader("From", email.From)
+	msg.SetHeader("To", email.To)
+	msg.SetHeader("Subject", email.Subject)
+	for name, value := range email.Headers {
+		msg.SetHeader(name, value)
+	}
+
+	// Clients show the last alternative they support, so HTML goes last.
+	if email.TextBody != "" {
+		msg.SetBody("text/plain", email.TextBody)
+		msg.AddAlternative("text/html", email.HTMLBody)
+	} else {
+		msg.SetBody("text/html", email.HTMLBody)
+	}
+
+	return msg
+}
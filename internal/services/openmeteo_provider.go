@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+const openMeteoProviderName = "openmeteo"
+
+const openMeteoSearchLimit = 5
+
+const (
+	openMeteoGeocodingURL = "https://geocoding-api.open-meteo.com/v1/search"
+	openMeteoForecastURL  = "https://api.open-meteo.com/v1/forecast"
+)
+
+// openMeteoProvider does not need an api key, but it only accepts
+// coordinates, so city lookups are resolved through the geocoding API first.
+type openMeteoProvider struct {
+	httpClient *http.Client
+}
+
+func newOpenMeteoProvider(
+	_ *config.WeatherServiceConfig,
+	httpClient *http.Client,
+) (WeatherProvider, error) {
+	return &openMeteoProvider{
+		httpClient: httpClient,
+	}, nil
+}
+
+type openMeteoGeocodingResponse struct {
+	Results []openMeteoGeocodingResult `json:"results"`
+}
+
+type openMeteoGeocodingResult struct {
+	Name      string  `json:"name"`
+	Admin1    string  `json:"admin1"`
+	Country   string  `json:"country"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Timezone  string  `json:"timezone"`
+}
+
+type openMeteoTimezoneResponse struct {
+	Timezone string `json:"timezone"`
+}
+
+type openMeteoCurrentResponse struct {
+	Current openMeteoCurrent `json:"current"`
+}
+
+type openMeteoCurrent struct {
+	Temperature         float64 `json:"temperature_2m"`
+	ApparentTemperature float64 `json:"apparent_temperature"`
+	Humidity            float64 `json:"relative_humidity_2m"`
+	WindSpeed           float64 `json:"wind_speed_10m"`
+	WindDirection       float64 `json:"wind_direction_10m"`
+	Pressure            float64 `json:"pressure_msl"`
+	Visibility          float64 `json:"visibility"`
+	UVIndex             float64 `json:"uv_index"`
+	CloudCover          float64 `json:"cloud_cover"`
+	WeatherCode         int     `json:"weather_code"`
+}
+
+// openMeteoForecastResponse days are local days of the location,
+// their times are the unix times of local midnight.
+type openMeteoForecastResponse struct {
+	UTCOffsetSeconds int64           `json:"utc_offset_seconds"`
+	Daily            openMeteoDaily  `json:"daily"`
+	Hourly           openMeteoHourly `json:"hourly"`
+}
+
+type openMeteoDaily struct {
+	Time                     []int64   `json:"time"`
+	TemperatureMin           []float64 `json:"temperature_2m_min"`
+	TemperatureMax           []float64 `json:"temperature_2m_max"`
+	PrecipitationProbability []float64 `json:"precipitation_probability_max"`
+	WindSpeedMax             []float64 `json:"wind_speed_10m_max"`
+	UVIndexMax               []float64 `json:"uv_index_max"`
+	WeatherCode              []int     `json:"weather_code"`
+}
+
+type openMeteoHourly struct {
+	Time                     []int64   `json:"time"`
+	Temperature              []float64 `json:"temperature_2m"`
+	PrecipitationProbability []float64 `json:"precipitation_probability"`
+	WindSpeed                []float64 `json:"wind_speed_10m"`
+	UVIndex                  []float64 `json:"uv_index"`
+	WeatherCode              []int     `json:"weather_code"`
+}
+
+type openMeteoErrorResponse struct {
+	Reason string `json:"reason"`
+}
+
+func (p *openMeteoProvider) Name() string {
+	return openMeteoProviderName
+}
+
+func (p *openMeteoProvider) MaxForecastDays() int {
+	return 16
+}
+
+func (p *openMeteoProvider) GetCurrentWeather(
+	ctx context.Context,
+	locationQuery LocationQuery,
+) (CurrentWeatherResponse, error) {
+	locationQuery, err := p.withCoordinates(ctx, locationQuery)
+	if err != nil {
+		return CurrentWeatherResponse{}, err
+	}
+
+	query := url.Values{}
+	query.Set("latitude", locationQuery.LatitudeString())
+	query.Set("longitude", locationQuery.LongitudeString())
+	query.Set("current", "temperature_2m,apparent_temperature,relative_humidity_2m,wind_speed_10m,"+
+		"wind_direction_10m,pressure_msl,visibility,uv_index,cloud_cover,weather_code")
+
+	var apiResponse openMeteoCurrentResponse
+	if err := p.get(ctx, openMeteoForecastURL+"?"+query.Encode(), &apiResponse); err != nil {
+		return CurrentWeatherResponse{}, err
+	}
+
+	// Open-Meteo does not serve condition icons, so IconURL stays empty.
+	current := apiResponse.Current
+	return CurrentWeatherResponse{
+		Temperature:   current.Temperature,
+		FeelsLike:     current.ApparentTemperature,
+		Humidity:      current.Humidity,
+		WindSpeed:     current.WindSpeed,
+		WindDegree:    current.WindDirection,
+		WindDirection: windDirectionFromDegree(current.WindDirection),
+		Pressure:      current.Pressure,
+		Visibility:    current.Visibility / 1000,
+		UVIndex:       current.UVIndex,
+		HasUVIndex:    true,
+		CloudCover:    current.CloudCover,
+		Condition:     openMeteoWeatherCodeDescription(current.WeatherCode),
+		ConditionCode: current.WeatherCode,
+	}, nil
+}
+
+func (p *openMeteoProvider) GetForecast(
+	ctx context.Context,
+	locationQuery LocationQuery,
+	days int,
+) (ForecastResponse, error) {
+	locationQuery, err := p.withCoordinates(ctx, locationQuery)
+	if err != nil {
+		return ForecastResponse{}, err
+	}
+
+	query := url.Values{}
+	query.Set("latitude", locationQuery.LatitudeString())
+	query.Set("longitude", locationQuery.LongitudeString())
+	query.Set("daily", "temperature_2m_min,temperature_2m_max,precipitation_probability_max,"+
+		"wind_speed_10m_max,uv_index_max,weather_code")
+	query.Set("hourly", "temperature_2m,precipitation_probability,wind_speed_10m,uv_index,weather_code")
+	query.Set("forecast_days", strconv.Itoa(days))
+	query.Set("timeformat", "unixtime")
+	// Days are split at local midnight, UTC days would mix two local days
+	// into the outlook of a report.
+	query.Set("timezone", "auto")
+
+	var apiResponse openMeteoForecastResponse
+	if err := p.get(ctx, openMeteoForecastURL+"?"+query.Encode(), &apiResponse); err != nil {
+		return ForecastResponse{}, err
+	}
+
+	daily := apiResponse.Daily
+	hourly := apiResponse.Hourly
+	if !sameLengths(len(daily.Time), len(daily.TemperatureMin), len(daily.TemperatureMax),
+		len(daily.PrecipitationProbability), len(daily.WindSpeedMax), len(daily.UVIndexMax),
+		len(daily.WeatherCode)) ||
+		!sameLengths(len(hourly.Time), len(hourly.Temperature), len(hourly.PrecipitationProbability),
+			len(hourly.WindSpeed), len(hourly.UVIndex), len(hourly.WeatherCode)) {
+		return ForecastResponse{}, fmt.Errorf("open-meteo returned inconsistent forecast data")
+	}
+
+	var forecast ForecastResponse
+	for i := range daily.Time {
+		forecast.Daily = append(forecast.Daily, DailyForecast{
+			// The date is the local date at UTC midnight, as with the other providers.
+			Date:                time.Unix(daily.Time[i]+apiResponse.UTCOffsetSeconds, 0).UTC(),
+			MinTemperature:      daily.TemperatureMin[i],
+			MaxTemperature:      daily.TemperatureMax[i],
+			PrecipitationChance: daily.PrecipitationProbability[i],
+			MaxWindSpeed:        daily.WindSpeedMax[i],
+			UVIndex:             daily.UVIndexMax[i],
+			Condition:           openMeteoWeatherCodeDescription(daily.WeatherCode[i]),
+		})
+	}
+	for i := range hourly.Time {
+		forecast.Hourly = append(forecast.Hourly, HourlyForecast{
+			Time:                time.Unix(hourly.Time[i], 0).UTC(),
+			Temperature:         hourly.Temperature[i],
+			PrecipitationChance: hourly.PrecipitationProbability[i],
+			WindSpeed:           hourly.WindSpeed[i],
+			UVIndex:             hourly.UVIndex[i],
+			Condition:           openMeteoWeatherCodeDescription(hourly.WeatherCode[i]),
+		})
+	}
+
+	return forecast, nil
+}
+
+func (p *openMeteoProvider) SearchLocations(ctx context.Context, text string) ([]models.Location, error) {
+	return p.searchLocations(ctx, text, openMeteoSearchLimit)
+}
+
+// GetTimezone takes the timezone from the geocoding API for city queries, for
+// coordinates the forecast API resolves it when asked for timezone=auto.
+func (p *openMeteoProvider) GetTimezone(ctx context.Context, locationQuery LocationQuery) (string, error) {
+	if !locationQuery.HasCoordinates() {
+		locations, err := p.searchLocations(ctx, locationQuery.City, 1)
+		if err != nil {
+			return "", err
+		}
+		if len(locations) == 0 {
+			return "", fmt.Errorf("location %s not found: %w", locationQuery.City, ErrCityNotFound)
+		}
+		return locations[0].Timezone, nil
+	}
+
+	query := url.Values{}
+	query.Set("latitude", locationQuery.LatitudeString())
+	query.Set("longitude", locationQuery.LongitudeString())
+	query.Set("timezone", "auto")
+	query.Set("forecast_days", "1")
+
+	var apiResponse openMeteoTimezoneResponse
+	if err := p.get(ctx, openMeteoForecastURL+"?"+query.Encode(), &apiResponse); err != nil {
+		return "", err
+	}
+	return apiResponse.Timezone, nil
+}
+
+// withCoordinates geocodes city queries, coordinate queries are returned as is.
+func (p *openMeteoProvider) withCoordinates(
+	ctx context.Context,
+	locationQuery LocationQuery,
+) (LocationQuery, error) {
+	if locationQuery.HasCoordinates() {
+		return locationQuery, nil
+	}
+
+	locations, err := p.searchLocations(ctx, locationQuery.City, 1)
+	if err != nil {
+		return LocationQuery{}, err
+	}
+
+	if len(locations) == 0 {
+		return LocationQuery{}, fmt.Errorf("location %s not found: %w", locationQuery.City, ErrCityNotFound)
+	}
+
+	return LocationCoordinatesQuery(locations[0]), nil
+}
+
+func (p *openMeteoProvider) searchLocations(
+	ctx context.Context,
+	text string,
+	count int,
+) ([]models.Location, error) {
+	query := url.Values{}
+	query.Set("name", text)
+	query.Set("count", strconv.Itoa(count))
+
+	var apiResponse openMeteoGeocodingResponse
+	if err := p.get(ctx, openMeteoGeocodingURL+"?"+query.Encode(), &apiResponse); err != nil {
+		return nil, err
+	}
+
+	locations := make([]models.Location, 0, len(apiResponse.Results))
+	for _, result := range apiResponse.Results {
+		locations = append(locations, models.Location{
+			Name:      result.Name,
+			Region:    result.Admin1,
+			Country:   result.Country,
+			Latitude:  result.Latitude,
+			Longitude: result.Longitude,
+			Timezone:  result.Timezone,
+		})
+	}
+	return locations, nil
+}
+
+func (p *openMeteoProvider) get(ctx context.Context, url string, out any) error {
+	resp, err := doWeatherProviderRequest(ctx, p.httpClient, openMeteoProviderName, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse openMeteoErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+			return fmt.Errorf("failed to decode error response: %w", err)
+		}
+
+		return fmt.Errorf("open-meteo API error: %s", errorResponse.Reason)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode weather response: %w", err)
+	}
+
+	return nil
+}
+
+func sameLengths(lengths ...int) bool {
+	for _, length := range lengths {
+		if length != lengths[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// openMeteoWeatherCodeDescription maps WMO weather interpretation codes
+// used by Open-Meteo to human readable descriptions.
+func openMeteoWeatherCodeDescription(code int) string {
+	switch code {
+	case 0:
+		return "Clear sky"
+	case 1:
+		return "Mainly clear"
+	case 2:
+		return "Partly cloudy"
+	case 3:
+		return "Overcast"
+	case 45, 48:
+		return "Fog"
+	case 51, 53, 55:
+		return "Drizzle"
+	case 56, 57:
+		return "Freezing drizzle"
+	case 61:
+		return "Light rain"
+	case 63:
+		return "Moderate rain"
+	case 65:
+		return "Heavy rain"
+	case 66, 67:
+		return "Freezing rain"
+	case 71:
+		return "Light snow"
+	case 73:
+		return "Moderate snow"
+	case 75:
+		return "Heavy snow"
+	case 77:
+		return "Snow grains"
+	case 80, 81, 82:
+		return "Rain showers"
+	case 85, 86:
+		return "Snow showers"
+	case 95:
+		return "Thunderstorm"
+	case 96, 99:
+		return "Thunderstorm with hail"
+	default:
+		return "Unknown"
+	}
+}
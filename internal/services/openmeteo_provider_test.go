@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// redirectTransport sends every request to the test server,
+// keeping the path and query of the provider URL.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOpenMeteoForecastUsesLocalDays(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		// Local midnight of March 9 in Kyiv (UTC+2) is 22:00 UTC on March 8.
+		w.Write([]byte(`{
+			"utc_offset_seconds": 7200,
+			"daily": {
+				"time": [1773007200],
+				"temperature_2m_min": [1],
+				"temperature_2m_max": [7],
+				"precipitation_probability_max": [70],
+				"wind_speed_10m_max": [20],
+				"uv_index_max": [2],
+				"weather_code": [61]
+			},
+			"hourly": {
+				"time": [1773007200],
+				"temperature_2m": [2],
+				"precipitation_probability": [10],
+				"wind_speed_10m": [5],
+				"uv_index": [0],
+				"weather_code": [0]
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	target, _ := url.Parse(server.URL)
+	provider := &openMeteoProvider{httpClient: &http.Client{Transport: redirectTransport{target: target}}}
+
+	forecast, err := provider.GetForecast(context.Background(), LocationCoordinatesQuery(models.Location{Latitude: 50.45, Longitude: 30.52}), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if query.Get("timezone") != "auto" {
+		t.Errorf("expected timezone=auto, got %q", query.Get("timezone"))
+	}
+	want := time.Date(2026, time.March, 9, 0, 0, 0, 0, time.UTC)
+	if len(forecast.Daily) != 1 || !forecast.Daily[0].Date.Equal(want) {
+		t.Fatalf("expected the local date %v, got %+v", want, forecast.Daily)
+	}
+	if !forecast.Hourly[0].Time.Equal(time.Unix(1773007200, 0)) {
+		t.Errorf("expected hourly times to stay absolute, got %v", forecast.Hourly[0].Time)
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+	"github.com/kievzenit/genesis-case/internal/utils"
+)
+
+const openWeatherMapProviderName = "openweathermap"
+
+const openWeatherMapBaseURL = "https://api.openweathermap.org"
+
+// metersPerSecondToKph converts openweathermap metric wind speeds to km/h,
+// which is what the rest of the service uses.
+const metersPerSecondToKph = 3.6
+
+const openWeatherMapSearchLimit = 5
+
+type openWeatherMapProvider struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newOpenWeatherMapProvider(
+	cfg *config.WeatherServiceConfig,
+	httpClient *http.Client,
+) (WeatherProvider, error) {
+	if cfg.OpenWeatherMapApiKey == "" {
+		return nil, fmt.Errorf("%s provider requires an api key", openWeatherMapProviderName)
+	}
+
+	return &openWeatherMapProvider{
+		apiKey:     cfg.OpenWeatherMapApiKey,
+		httpClient: httpClient,
+	}, nil
+}
+
+type openWeatherMapCurrentResponse struct {
+	Main       openWeatherMapMain        `json:"main"`
+	Wind       openWeatherMapWind        `json:"wind"`
+	Clouds     openWeatherMapClouds      `json:"clouds"`
+	Visibility float64                   `json:"visibility"`
+	Weather    []openWeatherMapCondition `json:"weather"`
+}
+
+type openWeatherMapMain struct {
+	Temp      float64 `json:"temp"`
+	FeelsLike float64 `json:"feels_like"`
+	Pressure  float64 `json:"pressure"`
+	Humidity  float64 `json:"humidity"`
+}
+
+type openWeatherMapWind struct {
+	Speed float64 `json:"speed"`
+	Deg   float64 `json:"deg"`
+}
+
+type openWeatherMapClouds struct {
+	All float64 `json:"all"`
+}
+
+type openWeatherMapCondition struct {
+	Id          int    `json:"id"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+type openWeatherMapGeocodingResult struct {
+	Name    string  `json:"name"`
+	State   string  `json:"state"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+type openWeatherMapOneCallResponse struct {
+	Daily  []openWeatherMapDaily  `json:"daily"`
+	Hourly []openWeatherMapHourly `json:"hourly"`
+}
+
+type openWeatherMapDaily struct {
+	Dt        int64                     `json:"dt"`
+	Temp      openWeatherMapDailyTemp   `json:"temp"`
+	Pop       float64                   `json:"pop"`
+	WindSpeed float64                   `json:"wind_speed"`
+	UVI       float64                   `json:"uvi"`
+	Weather   []openWeatherMapCondition `json:"weather"`
+}
+
+type openWeatherMapDailyTemp struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type openWeatherMapHourly struct {
+	Dt        int64                     `json:"dt"`
+	Temp      float64                   `json:"temp"`
+	Pop       float64                   `json:"pop"`
+	WindSpeed float64                   `json:"wind_speed"`
+	UVI       float64                   `json:"uvi"`
+	Weather   []openWeatherMapCondition `json:"weather"`
+}
+
+type openWeatherMapErrorResponse struct {
+	Message string `json:"message"`
+}
+
+func (p *openWeatherMapProvider) Name() string {
+	return openWeatherMapProviderName
+}
+
+// MaxForecastDays is the number of days of the One Call API.
+func (p *openWeatherMapProvider) MaxForecastDays() int {
+	return 8
+}
+
+func (p *openWeatherMapProvider) GetCurrentWeather(
+	ctx context.Context,
+	locationQuery LocationQuery,
+) (CurrentWeatherResponse, error) {
+	query := url.Values{}
+	if locationQuery.HasCoordinates() {
+		query.Set("lat", locationQuery.LatitudeString())
+		query.Set("lon", locationQuery.LongitudeString())
+	} else {
+		query.Set("q", locationQuery.City)
+	}
+	query.Set("units", "metric")
+
+	var apiResponse openWeatherMapCurrentResponse
+	if err := p.get(ctx, "/data/2.5/weather", query, &apiResponse); err != nil {
+		return CurrentWeatherResponse{}, err
+	}
+
+	// The current weather API does not report the UV index,
+	// it is only available through the One Call API.
+	weather := CurrentWeatherResponse{
+		Temperature:   apiResponse.Main.Temp,
+		FeelsLike:     apiResponse.Main.FeelsLike,
+		Humidity:      apiResponse.Main.Humidity,
+		WindSpeed:     apiResponse.Wind.Speed * metersPerSecondToKph,
+		WindDegree:    apiResponse.Wind.Deg,
+		WindDirection: windDirectionFromDegree(apiResponse.Wind.Deg),
+		Pressure:      apiResponse.Main.Pressure,
+		Visibility:    apiResponse.Visibility / 1000,
+		CloudCover:    apiResponse.Clouds.All,
+		Condition:     openWeatherMapConditionText(apiResponse.Weather),
+	}
+	if len(apiResponse.Weather) > 0 {
+		weather.ConditionCode = apiResponse.Weather[0].Id
+		weather.IconURL = fmt.Sprintf("https://openweathermap.org/img/wn/%s@2x.png", apiResponse.Weather[0].Icon)
+	}
+
+	return weather, nil
+}
+
+// GetForecast uses the One Call API, which only accepts coordinates,
+// so city queries are resolved through the geocoding API first.
+func (p *openWeatherMapProvider) GetForecast(
+	ctx context.Context,
+	locationQuery LocationQuery,
+	days int,
+) (ForecastResponse, error) {
+	if !locationQuery.HasCoordinates() {
+		location, err := p.geocode(ctx, locationQuery.City)
+		if err != nil {
+			return ForecastResponse{}, err
+		}
+		locationQuery = LocationCoordinatesQuery(location)
+	}
+
+	query := url.Values{}
+	query.Set("lat", locationQuery.LatitudeString())
+	query.Set("lon", locationQuery.LongitudeString())
+	query.Set("exclude", "current,minutely,alerts")
+	query.Set("units", "metric")
+
+	var apiResponse openWeatherMapOneCallResponse
+	if err := p.get(ctx, "/data/3.0/onecall", query, &apiResponse); err != nil {
+		return ForecastResponse{}, err
+	}
+
+	var forecast ForecastResponse
+	for i, daily := range apiResponse.Daily {
+		if i == days {
+			break
+		}
+
+		forecast.Daily = append(forecast.Daily, DailyForecast{
+			Date:                time.Unix(daily.Dt, 0).UTC().Truncate(24 * time.Hour),
+			MinTemperature:      daily.Temp.Min,
+			MaxTemperature:      daily.Temp.Max,
+			PrecipitationChance: daily.Pop * 100,
+			MaxWindSpeed:        daily.WindSpeed * metersPerSecondToKph,
+			UVIndex:             daily.UVI,
+			Condition:           openWeatherMapConditionText(daily.Weather),
+		})
+	}
+
+	until := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, days)
+	for _, hourly := range apiResponse.Hourly {
+		hourTime := time.Unix(hourly.Dt, 0).UTC()
+		if !hourTime.Before(until) {
+			break
+		}
+
+		forecast.Hourly = append(forecast.Hourly, HourlyForecast{
+			Time:                hourTime,
+			Temperature:         hourly.Temp,
+			PrecipitationChance: hourly.Pop * 100,
+			WindSpeed:           hourly.WindSpeed * metersPerSecondToKph,
+			UVIndex:             hourly.UVI,
+			Condition:           openWeatherMapConditionText(hourly.Weather),
+		})
+	}
+
+	return forecast, nil
+}
+
+func (p *openWeatherMapProvider) SearchLocations(ctx context.Context, text string) ([]models.Location, error) {
+	return p.searchLocations(ctx, text, openWeatherMapSearchLimit)
+}
+
+func (p *openWeatherMapProvider) geocode(ctx context.Context, city string) (models.Location, error) {
+	locations, err := p.searchLocations(ctx, city, 1)
+	if err != nil {
+		return models.Location{}, err
+	}
+
+	if len(locations) == 0 {
+		return models.Location{}, fmt.Errorf("location %s not found: %w", city, ErrCityNotFound)
+	}
+
+	return locations[0], nil
+}
+
+// GetTimezone is not supported, OpenWeatherMap only reports UTC offsets,
+// so the lookup fails over to the next provider.
+func (p *openWeatherMapProvider) GetTimezone(ctx context.Context, locationQuery LocationQuery) (string, error) {
+	return "", fmt.Errorf("%w: %s does not report timezone names", ErrWeatherProviderUnavailable, openWeatherMapProviderName)
+}
+
+func (p *openWeatherMapProvider) searchLocations(
+	ctx context.Context,
+	text string,
+	limit int,
+) ([]models.Location, error) {
+	query := url.Values{}
+	query.Set("q", text)
+	query.Set("limit", strconv.Itoa(limit))
+
+	var apiResponse []openWeatherMapGeocodingResult
+	if err := p.get(ctx, "/geo/1.0/direct", query, &apiResponse); err != nil {
+		return nil, err
+	}
+
+	locations := make([]models.Location, 0, len(apiResponse))
+	for _, result := range apiResponse {
+		locations = append(locations, models.Location{
+			Name:      result.Name,
+			Region:    result.State,
+			Country:   result.Country,
+			Latitude:  result.Lat,
+			Longitude: result.Lon,
+		})
+	}
+	return locations, nil
+}
+
+func (p *openWeatherMapProvider) get(ctx context.Context, path string, query url.Values, out any) error {
+	query.Set("appid", p.apiKey)
+
+	resp, err := doWeatherProviderRequest(
+		ctx,
+		p.httpClient,
+		openWeatherMapProviderName,
+		openWeatherMapBaseURL+path+"?"+query.Encode(),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("location %s not found: %w", query.Get("q"), ErrCityNotFound)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse openWeatherMapErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+			return fmt.Errorf("failed to decode error response: %w", err)
+		}
+
+		return fmt.Errorf("openweathermap API error: %s", errorResponse.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode weather response: %w", err)
+	}
+
+	return nil
+}
+
+func openWeatherMapConditionText(conditions []openWeatherMapCondition) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return utils.UpperFirstLetter(conditions[0].Description)
+}
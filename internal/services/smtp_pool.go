@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"gopkg.in/gomail.v2"
+)
+
+const smtpTransportName = "smtp"
+
+// smtpPool keeps SMTP connections open between messages, so every message
+// does not pay for its own handshake. At most maxConnections are open at once,
+// senders wait for a free one. A connection is closed after maxMessages
+// messages, and when it was idle for longer than idleTimeout, since servers
+// drop idle connections on their own.
+type smtpPool struct {
+	dialer      smtpDialer
+	idle        chan *smtpConnection
+	slots       chan struct{}
+	maxMessages int
+	idleTimeout time.Duration
+}
+
+// smtpDialer opens SMTP connections, *gomail.Dialer is the real one.
+type smtpDialer interface {
+	Dial() (gomail.SendCloser, error)
+}
+
+type smtpConnection struct {
+	sender   gomail.SendCloser
+	messages int
+	lastUsed time.Time
+}
+
+func newSMTPMailer(cfg *config.EmailServiceConfig) (Mailer, error) {
+	dialer := gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+	dialer.SSL = cfg.SSL
+
+	return newSMTPPool(
+		dialer,
+		cfg.MaxConnections,
+		cfg.MaxMessagesPerConnection,
+		time.Duration(cfg.IdleTimeout)*time.Second,
+	), nil
+}
+
+func newSMTPPool(
+	dialer smtpDialer,
+	maxConnections int,
+	maxMessages int,
+	idleTimeout time.Duration,
+) *smtpPool {
+	maxConnections = max(maxConnections, 1)
+	return &smtpPool{
+		dialer:      dialer,
+		idle:        make(chan *smtpConnection, maxConnections),
+		slots:       make(chan struct{}, maxConnections),
+		maxMessages: maxMessages,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Send sends the email over an idle connection, or a new one when there is none.
+// When a reused connection turns out to be broken the message is sent once
+// more over a new connection. Other failures, like a rejected recipient,
+// are returned as they are, the message may have been delivered already.
+func (p *smtpPool) Send(email Email) error {
+	msg := email.gomailMessage()
+
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	conn, reused, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	err = p.send(conn, msg)
+	if err != nil && reused && isBrokenConnection(err) {
+		conn.sender.Close()
+		conn, err = p.dial()
+		if err != nil {
+			return err
+		}
+		err = p.send(conn, msg)
+	}
+	if err != nil {
+		conn.sender.Close()
+		return err
+	}
+
+	p.put(conn)
+	return nil
+}
+
+// send returns the error of the connection as it is,
+// gomail.Send only keeps its text.
+func (p *smtpPool) send(conn *smtpConnection, msg *gomail.Message) error {
+	var sendErr error
+	err := gomail.Send(gomail.SendFunc(func(from string, to []string, m io.WriterTo) error {
+		sendErr = conn.sender.Send(from, to, m)
+		return sendErr
+	}), msg)
+	if sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// isBrokenConnection reports whether err means the connection was closed,
+// by the server or the network, rather than the message being refused.
+// Timeouts are not retried, they may come after the message was accepted.
+func isBrokenConnection(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+
+	// 421 is how servers announce they are closing the connection.
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code == 421
+}
+
+// Close quits the idle connections. Connections in use are closed
+// by their senders, so it is meant to be called once sending stopped.
+func (p *smtpPool) Close() error {
+	var errs []error
+	for {
+		select {
+		case conn := <-p.idle:
+			if err := conn.sender.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+func (p *smtpPool) get() (*smtpConnection, bool, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			if time.Since(conn.lastUsed) > p.idleTimeout {
+				conn.sender.Close()
+				continue
+			}
+			return conn, true, nil
+		default:
+			conn, err := p.dial()
+			return conn, false, err
+		}
+	}
+}
+
+func (p *smtpPool) dial() (*smtpConnection, error) {
+	sender, err := p.dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return &smtpConnection{sender: sender}, nil
+}
+
+// put returns the connection to the pool, unless it sent maxMessages
+// already. It never blocks, the slots keep the idle connections within
+// the capacity of the pool.
+func (p *smtpPool) put(conn *smtpConnection) {
+	conn.messages++
+	conn.lastUsed = time.Now()
+	if p.maxMessages > 0 && conn.messages >= p.maxMessages {
+		conn.sender.Close()
+		return
+	}
+
+	p.idle <- conn
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// fakeSMTPDialer hands out fakeSMTPSenders, the n-th dialed sender fails
+// its sends with errs[n] when it is set.
+type fakeSMTPDialer struct {
+	mu      sync.Mutex
+	senders []*fakeSMTPSender
+	errs    map[int]error
+	// block, when set, holds every send until it is closed.
+	block chan struct{}
+
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (d *fakeSMTPDialer) Dial() (gomail.SendCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sender := &fakeSMTPSender{dialer: d, err: d.errs[len(d.senders)]}
+	d.senders = append(d.senders, sender)
+	return sender, nil
+}
+
+func (d *fakeSMTPDialer) dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.senders)
+}
+
+type fakeSMTPSender struct {
+	dialer *fakeSMTPDialer
+	err    error
+	sent   atomic.Int32
+	closed atomic.Bool
+}
+
+func (s *fakeSMTPSender) Send(string, []string, io.WriterTo) error {
+	active := s.dialer.active.Add(1)
+	defer s.dialer.active.Add(-1)
+	for {
+		maxActive := s.dialer.maxActive.Load()
+		if active <= maxActive || s.dialer.maxActive.CompareAndSwap(maxActive, active) {
+			break
+		}
+	}
+	if s.dialer.block != nil {
+		<-s.dialer.block
+	}
+
+	if s.err != nil {
+		return s.err
+	}
+	s.sent.Add(1)
+	return nil
+}
+
+func (s *fakeSMTPSender) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestSMTPPoolReusesConnections(t *testing.T) {
+	dialer := &fakeSMTPDialer{}
+	pool := newSMTPPool(dialer, 2, 0, time.Minute)
+
+	for range 3 {
+		if err := pool.Send(testEmail()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if dialer.dials() != 1 {
+		t.Fatalf("expected one connection, got %d", dialer.dials())
+	}
+	if sent := dialer.senders[0].sent.Load(); sent != 3 {
+		t.Errorf("expected 3 emails over the connection, got %d", sent)
+	}
+}
+
+func TestSMTPPoolClosesConnectionsAfterMaxMessages(t *testing.T) {
+	dialer := &fakeSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, 2, time.Minute)
+
+	for range 3 {
+		if err := pool.Send(testEmail()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if dialer.dials() != 2 {
+		t.Fatalf("expected two connections, got %d", dialer.dials())
+	}
+	if !dialer.senders[0].closed.Load() {
+		t.Error("expected the first connection closed after 2 emails")
+	}
+}
+
+func TestSMTPPoolSendErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantErr    bool
+		wantDials  int
+		wantResent bool
+	}{
+		{name: "connection closed by the server", err: io.EOF, wantDials: 2, wantResent: true},
+		{name: "connection reset", err: &netError{}, wantDials: 2, wantResent: true},
+		{name: "server shutting down", err: &textproto.Error{Code: 421, Msg: "closing"}, wantDials: 2, wantResent: true},
+		{name: "recipient rejected", err: &textproto.Error{Code: 550, Msg: "no such user"}, wantErr: true, wantDials: 1},
+		{name: "timeout after data", err: &netError{timeout: true}, wantErr: true, wantDials: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := &fakeSMTPDialer{}
+			pool := newSMTPPool(dialer, 1, 0, time.Minute)
+			if err := pool.Send(testEmail()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The idle connection fails the next email.
+			dialer.senders[0].err = tt.err
+			err := pool.Send(testEmail())
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr && !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+
+			if dialer.dials() != tt.wantDials {
+				t.Fatalf("expected %d connections, got %d", tt.wantDials, dialer.dials())
+			}
+			if !dialer.senders[0].closed.Load() {
+				t.Error("expected the failed connection closed")
+			}
+			if tt.wantResent && dialer.senders[1].sent.Load() != 1 {
+				t.Error("expected the email sent over a new connection")
+			}
+		})
+	}
+}
+
+func TestSMTPPoolLimitsConnections(t *testing.T) {
+	dialer := &fakeSMTPDialer{block: make(chan struct{})}
+	pool := newSMTPPool(dialer, 2, 0, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.Send(testEmail()); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// Give the senders time to take the free connections.
+	time.Sleep(20 * time.Millisecond)
+	close(dialer.block)
+	wg.Wait()
+
+	if maxActive := dialer.maxActive.Load(); maxActive != 2 {
+		t.Errorf("expected 2 emails sent at once, got %d", maxActive)
+	}
+	if dialer.dials() > 2 {
+		t.Errorf("expected at most 2 connections, got %d", dialer.dials())
+	}
+}
+
+func TestSMTPPoolClose(t *testing.T) {
+	dialer := &fakeSMTPDialer{}
+	pool := newSMTPPool(dialer, 1, 0, time.Minute)
+	if err := pool.Send(testEmail()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !dialer.senders[0].closed.Load() {
+		t.Error("expected the idle connection closed")
+	}
+}
+
+// netError is a network failure, like a reset connection or a timeout.
+type netError struct {
+	timeout bool
+}
+
+func (e *netError) Error() string   { return "network error" }
+func (e *netError) Timeout() bool   { return e.timeout }
+func (e *netError) Temporary() bool { return false }
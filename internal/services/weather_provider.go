@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// WeatherProvider is a single upstream weather API.
+type WeatherProvider interface {
+	Name() string
+	GetCurrentWeather(ctx context.Context, query LocationQuery) (CurrentWeatherResponse, error)
+	GetForecast(ctx context.Context, query LocationQuery, days int) (ForecastResponse, error)
+	// MaxForecastDays is the longest forecast the provider returns,
+	// it is not asked for more.
+	MaxForecastDays() int
+	// SearchLocations returns places matching text, best match first.
+	// No matches is not an error.
+	SearchLocations(ctx context.Context, text string) ([]models.Location, error)
+	// GetTimezone returns the IANA timezone name of the location.
+	GetTimezone(ctx context.Context, query LocationQuery) (string, error)
+}
+
+// WeatherProviderFactory builds a provider from the weather service config.
+type WeatherProviderFactory func(
+	cfg *config.WeatherServiceConfig,
+	httpClient *http.Client,
+) (WeatherProvider, error)
+
+var ErrWeatherProviderUnavailable = errors.New("weather provider unavailable")
+
+var weatherProviderFactories = map[string]WeatherProviderFactory{
+	weatherApiProviderName:     newWeatherApiProvider,
+	openWeatherMapProviderName: newOpenWeatherMapProvider,
+	openMeteoProviderName:      newOpenMeteoProvider,
+}
+
+// RegisterWeatherProvider makes a provider available by name for use in
+// the WAPP_WEATHER_PROVIDERS fallback chain.
+func RegisterWeatherProvider(name string, factory WeatherProviderFactory) {
+	weatherProviderFactories[name] = factory
+}
+
+func newWeatherProvider(
+	name string,
+	cfg *config.WeatherServiceConfig,
+	httpClient *http.Client,
+) (WeatherProvider, error) {
+	factory, ok := weatherProviderFactories[name]
+	if !ok {
+		names := make([]string, 0, len(weatherProviderFactories))
+		for registered := range weatherProviderFactories {
+			names = append(names, registered)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown weather provider %q, available providers: %v", name, names)
+	}
+
+	return factory(cfg, httpClient)
+}
+
+// doWeatherProviderRequest performs a GET request against a provider and
+// marks transport failures and 5xx responses as ErrWeatherProviderUnavailable,
+// so the caller can fail over to the next provider.
+func doWeatherProviderRequest(
+	ctx context.Context,
+	httpClient *http.Client,
+	providerName string,
+	url string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to create request: %w", providerName, err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s: %w", providerName, ctx.Err())
+		}
+		return nil, fmt.Errorf("%s: %w: %v", providerName, ErrWeatherProviderUnavailable, err)
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		resp.Body.Close()
+		return nil, fmt.Errorf(
+			"%s: %w: status code %d",
+			providerName,
+			ErrWeatherProviderUnavailable,
+			resp.StatusCode,
+		)
+	}
+
+	return resp, nil
+}
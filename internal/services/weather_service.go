@@ -1,94 +1,236 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
 )
 
 type WeatherService interface {
-	GetCurrentWeatherForCity(city string) (CurrentWeatherResponse, error)
+	GetCurrentWeather(ctx context.Context, query LocationQuery) (CurrentWeatherResponse, error)
+	GetForecast(ctx context.Context, query LocationQuery, days int) (ForecastResponse, error)
+	SearchLocations(ctx context.Context, text string) ([]models.Location, error)
+	GetTimezone(ctx context.Context, query LocationQuery) (string, error)
 }
 
+// weatherService queries providers in the configured order and fails over
+// to the next one when a provider is unavailable.
 type weatherService struct {
-	cfg *config.WeatherServiceConfig
+	providers []WeatherProvider
 }
 
-func NewWeatherService(cfg *config.WeatherServiceConfig) WeatherService {
-	return &weatherService{
-		cfg: cfg,
+func NewWeatherService(cfg *config.WeatherServiceConfig) (WeatherService, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, errors.New("no weather providers configured")
+	}
+
+	httpClient := &http.Client{
+		Timeout: time.Duration(cfg.HttpTimeout) * time.Second,
+	}
+
+	providers := make([]WeatherProvider, 0, len(cfg.Providers))
+	for _, name := range cfg.Providers {
+		provider, err := newWeatherProvider(name, cfg, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
 	}
+
+	return &weatherService{
+		providers: providers,
+	}, nil
 }
 
+// CurrentWeatherResponse uses the same units as ForecastResponse, plus hPa
+// for pressure and km for visibility. ConditionCode is provider specific.
+// HasUVIndex is false when the provider does not report the UV index.
 type CurrentWeatherResponse struct {
-	Temperature float64
-	Humidity    float64
-	Condition   string
+	Temperature   float64
+	FeelsLike     float64
+	Humidity      float64
+	WindSpeed     float64
+	WindDegree    float64
+	WindDirection string
+	Pressure      float64
+	Visibility    float64
+	UVIndex       float64
+	HasUVIndex    bool
+	CloudCover    float64
+	Condition     string
+	ConditionCode int
+	IconURL       string
 }
 
-type currentWeatherApiResponse struct {
-	Current weatherApiResponse `json:"current"`
+// ForecastResponse holds forecast entries starting from today, it has fewer
+// days than asked for when the provider does not forecast that far.
+// Temperatures are in celsius, wind speeds in km/h and chances in percent.
+type ForecastResponse struct {
+	Daily  []DailyForecast
+	Hourly []HourlyForecast
 }
 
-type weatherApiResponse struct {
-	TempCelsius float64                            `json:"temp_c"`
-	Humidity    float64                            `json:"humidity"`
-	Condition   currentWeatherApiResponseCondition `json:"condition"`
+type DailyForecast struct {
+	Date                time.Time
+	MinTemperature      float64
+	MaxTemperature      float64
+	PrecipitationChance float64
+	MaxWindSpeed        float64
+	UVIndex             float64
+	Condition           string
 }
 
-type currentWeatherApiResponseCondition struct {
-	Text string `json:"text"`
+type HourlyForecast struct {
+	Time                time.Time
+	Temperature         float64
+	PrecipitationChance float64
+	WindSpeed           float64
+	UVIndex             float64
+	Condition           string
 }
 
-type weatherApiErrorResponse struct {
-	Error weatherApiInnerErrorResponse `json:"error"`
+// InUnits returns a copy of the response converted from metric to units.
+func (r CurrentWeatherResponse) InUnits(units models.Units) CurrentWeatherResponse {
+	r.Temperature = units.Temperature(r.Temperature)
+	r.FeelsLike = units.Temperature(r.FeelsLike)
+	r.WindSpeed = units.Speed(r.WindSpeed)
+	r.Pressure = units.Pressure(r.Pressure)
+	r.Visibility = units.Distance(r.Visibility)
+	return r
 }
 
-type weatherApiInnerErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// InUnits returns a copy of the forecast converted from metric to units.
+func (r ForecastResponse) InUnits(units models.Units) ForecastResponse {
+	converted := ForecastResponse{
+		Daily:  make([]DailyForecast, 0, len(r.Daily)),
+		Hourly: make([]HourlyForecast, 0, len(r.Hourly)),
+	}
+	for _, day := range r.Daily {
+		converted.Daily = append(converted.Daily, day.InUnits(units))
+	}
+	for _, hour := range r.Hourly {
+		hour.Temperature = units.Temperature(hour.Temperature)
+		hour.WindSpeed = units.Speed(hour.WindSpeed)
+		converted.Hourly = append(converted.Hourly, hour)
+	}
+	return converted
+}
+
+func (d DailyForecast) InUnits(units models.Units) DailyForecast {
+	d.MinTemperature = units.Temperature(d.MinTemperature)
+	d.MaxTemperature = units.Temperature(d.MaxTemperature)
+	d.MaxWindSpeed = units.Speed(d.MaxWindSpeed)
+	return d
+}
+
+// windDirectionFromDegree converts a wind degree to a 16-point compass direction.
+func windDirectionFromDegree(degree float64) string {
+	directions := []string{
+		"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+		"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+	}
+	index := int(math.Round(math.Mod(degree, 360)/22.5)) % len(directions)
+	if index < 0 {
+		index += len(directions)
+	}
+	return directions[index]
 }
 
+// MaxForecastDays is the longest forecast the service asks for,
+// providers that return fewer days are asked for as many as they have.
+const MaxForecastDays = 7
+
 var ErrCityNotFound = errors.New("city not found")
 
-const cityNotFoundApiErrorCode = 1006
+func (ws *weatherService) GetCurrentWeather(
+	ctx context.Context,
+	query LocationQuery,
+) (CurrentWeatherResponse, error) {
+	return withFailover(ws.providers, func(provider WeatherProvider) (CurrentWeatherResponse, error) {
+		return provider.GetCurrentWeather(ctx, query)
+	})
+}
 
-func (ws *weatherService) GetCurrentWeatherForCity(city string) (CurrentWeatherResponse, error) {
-	httpClient := &http.Client{
-		Timeout: time.Duration(ws.cfg.HttpTimeout) * time.Second,
+func (ws *weatherService) GetForecast(
+	ctx context.Context,
+	query LocationQuery,
+	days int,
+) (ForecastResponse, error) {
+	if days < 1 || days > MaxForecastDays {
+		return ForecastResponse{}, fmt.Errorf("forecast days must be between 1 and %d", MaxForecastDays)
 	}
 
-	url := fmt.Sprintf("http://api.weatherapi.com/v1/current.json?key=%s&q=%s", ws.cfg.ApiKey, city)
-	resp, err := httpClient.Get(url)
+	return withFailover(ws.providers, func(provider WeatherProvider) (ForecastResponse, error) {
+		return provider.GetForecast(ctx, query, min(days, provider.MaxForecastDays()))
+	})
+}
+
+func (ws *weatherService) SearchLocations(ctx context.Context, text string) ([]models.Location, error) {
+	return withFailover(ws.providers, func(provider WeatherProvider) ([]models.Location, error) {
+		return provider.SearchLocations(ctx, text)
+	})
+}
+
+func (ws *weatherService) GetTimezone(ctx context.Context, query LocationQuery) (string, error) {
+	return withFailover(ws.providers, func(provider WeatherProvider) (string, error) {
+		return provider.GetTimezone(ctx, query)
+	})
+}
+
+// ResolveLocation returns the best match for a user supplied city name,
+// or ErrCityNotFound when the providers do not know such a place.
+// The timezone is looked up separately when the search did not return it,
+// it is left empty when that lookup fails.
+func ResolveLocation(ctx context.Context, weatherService WeatherService, city string) (models.Location, error) {
+	city = strings.TrimSpace(city)
+	if city == "" {
+		return models.Location{}, fmt.Errorf("empty location: %w", ErrCityNotFound)
+	}
+
+	locations, err := weatherService.SearchLocations(ctx, city)
 	if err != nil {
-		return CurrentWeatherResponse{}, fmt.Errorf("failed to get weather data: %w", err)
+		return models.Location{}, err
+	}
+
+	if len(locations) == 0 {
+		return models.Location{}, fmt.Errorf("location %s not found: %w", city, ErrCityNotFound)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errorResponse weatherApiErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-			return CurrentWeatherResponse{}, fmt.Errorf("failed to decode error response: %w", err)
+	location := locations[0]
+	if location.Timezone == "" {
+		timezone, err := weatherService.GetTimezone(ctx, LocationCoordinatesQuery(location))
+		if err != nil {
+			log.Printf("failed to get timezone of %s: %v", location.Name, err)
 		}
+		location.Timezone = timezone
+	}
+	return location, nil
+}
 
-		if errorResponse.Error.Code == cityNotFoundApiErrorCode {
-			return CurrentWeatherResponse{}, fmt.Errorf("location %s not found: %w", city, ErrCityNotFound)
+func withFailover[T any](providers []WeatherProvider, call func(WeatherProvider) (T, error)) (T, error) {
+	var zero T
+	var lastErr error
+	for _, provider := range providers {
+		result, err := call(provider)
+		if err == nil {
+			return result, nil
 		}
 
-		return CurrentWeatherResponse{}, fmt.Errorf("weather API error: %s", errorResponse.Error.Message)
-	}
+		if !errors.Is(err, ErrWeatherProviderUnavailable) {
+			return zero, err
+		}
 
-	var apiResponse currentWeatherApiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-		return CurrentWeatherResponse{}, fmt.Errorf("failed to decode weather response: %w", err)
+		log.Printf("weather provider %s failed, trying next one: %v", provider.Name(), err)
+		lastErr = err
 	}
-	return CurrentWeatherResponse{
-		Temperature: apiResponse.Current.TempCelsius,
-		Humidity:    apiResponse.Current.Humidity,
-		Condition:   apiResponse.Current.Condition.Text,
-	}, nil
+
+	return zero, fmt.Errorf("all weather providers failed: %w", lastErr)
 }
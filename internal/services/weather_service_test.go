@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+// stubWeatherProvider serves current weather from a test server,
+// 404 responses mean the city is unknown.
+type stubWeatherProvider struct {
+	name            string
+	url             string
+	httpClient      *http.Client
+	maxForecastDays int
+}
+
+func (p *stubWeatherProvider) Name() string {
+	return p.name
+}
+
+func (p *stubWeatherProvider) GetCurrentWeather(
+	ctx context.Context,
+	query LocationQuery,
+) (CurrentWeatherResponse, error) {
+	resp, err := doWeatherProviderRequest(ctx, p.httpClient, p.name, p.url)
+	if err != nil {
+		return CurrentWeatherResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return CurrentWeatherResponse{}, ErrCityNotFound
+	}
+
+	var weather CurrentWeatherResponse
+	err = json.NewDecoder(resp.Body).Decode(&weather)
+	return weather, err
+}
+
+// GetForecast returns one day per requested day, so tests see how many
+// days the provider was asked for.
+func (p *stubWeatherProvider) GetForecast(_ context.Context, _ LocationQuery, days int) (ForecastResponse, error) {
+	return ForecastResponse{Daily: make([]DailyForecast, days)}, nil
+}
+
+func (p *stubWeatherProvider) MaxForecastDays() int {
+	return p.maxForecastDays
+}
+
+func (p *stubWeatherProvider) SearchLocations(context.Context, string) ([]models.Location, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *stubWeatherProvider) GetTimezone(context.Context, LocationQuery) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func newStubWeatherServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestWeatherServiceFailover(t *testing.T) {
+	slowDone := make(chan struct{})
+	t.Cleanup(func() { close(slowDone) })
+
+	tests := []struct {
+		name             string
+		primary          http.HandlerFunc
+		wantErr          error
+		wantTemperature  float64
+		wantFallbackCall bool
+	}{
+		{
+			name: "primary succeeds",
+			primary: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"Temperature": 1}`))
+			},
+			wantTemperature: 1,
+		},
+		{
+			name: "primary responds with 5xx",
+			primary: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantTemperature:  2,
+			wantFallbackCall: true,
+		},
+		{
+			name: "primary times out",
+			primary: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-slowDone:
+				case <-r.Context().Done():
+				}
+			},
+			wantTemperature:  2,
+			wantFallbackCall: true,
+		},
+		{
+			name: "primary does not know the city",
+			primary: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: ErrCityNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient := &http.Client{Timeout: 100 * time.Millisecond}
+			primary, _ := newStubWeatherServer(t, tt.primary)
+			fallback, fallbackRequests := newStubWeatherServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"Temperature": 2}`))
+			})
+
+			ws := &weatherService{
+				providers: []WeatherProvider{
+					&stubWeatherProvider{name: "primary", url: primary.URL, httpClient: httpClient},
+					&stubWeatherProvider{name: "fallback", url: fallback.URL, httpClient: httpClient},
+				},
+			}
+
+			weather, err := ws.GetCurrentWeather(context.Background(), CityQuery("Kyiv"))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if weather.Temperature != tt.wantTemperature {
+				t.Errorf("expected temperature %v, got %v", tt.wantTemperature, weather.Temperature)
+			}
+			if called := fallbackRequests.Load() > 0; called != tt.wantFallbackCall {
+				t.Errorf("expected fallback called %v, got %v", tt.wantFallbackCall, called)
+			}
+		})
+	}
+}
+
+func TestWeatherServiceAllProvidersFail(t *testing.T) {
+	httpClient := &http.Client{Timeout: time.Second}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	primary, _ := newStubWeatherServer(t, failing)
+	fallback, _ := newStubWeatherServer(t, failing)
+
+	ws := &weatherService{
+		providers: []WeatherProvider{
+			&stubWeatherProvider{name: "primary", url: primary.URL, httpClient: httpClient},
+			&stubWeatherProvider{name: "fallback", url: fallback.URL, httpClient: httpClient},
+		},
+	}
+
+	_, err := ws.GetCurrentWeather(context.Background(), CityQuery("Kyiv"))
+	if !errors.Is(err, ErrWeatherProviderUnavailable) {
+		t.Fatalf("expected %v, got %v", ErrWeatherProviderUnavailable, err)
+	}
+}
+
+func TestCurrentWeatherResponseInUnits(t *testing.T) {
+	metric := CurrentWeatherResponse{
+		Temperature: 20,
+		FeelsLike:   -10,
+		Humidity:    65,
+		WindSpeed:   16.09344,
+		Pressure:    1013.25,
+		Visibility:  10,
+		UVIndex:     3,
+		CloudCover:  40,
+		Condition:   "Cloudy",
+	}
+
+	if got := metric.InUnits(models.Metric); got != metric {
+		t.Errorf("expected metric values unchanged, got %+v", got)
+	}
+
+	got := metric.InUnits(models.Imperial)
+	expected := metric
+	expected.Temperature = 68
+	expected.FeelsLike = 14
+	expected.WindSpeed = 10
+	expected.Pressure = 29.92
+	expected.Visibility = 6.21
+	if !sameWeather(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if metric.Temperature != 20 {
+		t.Error("expected InUnits to leave the original response unchanged")
+	}
+}
+
+func TestForecastResponseInUnits(t *testing.T) {
+	metric := ForecastResponse{
+		Daily: []DailyForecast{{
+			MinTemperature:      -5,
+			MaxTemperature:      5,
+			PrecipitationChance: 80,
+			MaxWindSpeed:        32.18688,
+			UVIndex:             1,
+		}},
+		Hourly: []HourlyForecast{{
+			Temperature:         10,
+			PrecipitationChance: 30,
+			WindSpeed:           8.04672,
+			UVIndex:             2,
+		}},
+	}
+
+	got := metric.InUnits(models.Imperial)
+
+	day := got.Daily[0]
+	if !approx(day.MinTemperature, 23) || !approx(day.MaxTemperature, 41) || !approx(day.MaxWindSpeed, 20) {
+		t.Errorf("unexpected daily forecast %+v", day)
+	}
+	if day.PrecipitationChance != 80 || day.UVIndex != 1 {
+		t.Errorf("expected chances and UV index unchanged, got %+v", day)
+	}
+
+	hour := got.Hourly[0]
+	if !approx(hour.Temperature, 50) || !approx(hour.WindSpeed, 5) {
+		t.Errorf("unexpected hourly forecast %+v", hour)
+	}
+	if hour.PrecipitationChance != 30 || hour.UVIndex != 2 {
+		t.Errorf("expected chances and UV index unchanged, got %+v", hour)
+	}
+
+	if metric.Daily[0].MinTemperature != -5 || metric.Hourly[0].Temperature != 10 {
+		t.Error("expected InUnits to leave the original forecast unchanged")
+	}
+
+	unchanged := metric.InUnits(models.Metric)
+	if unchanged.Daily[0] != metric.Daily[0] || unchanged.Hourly[0] != metric.Hourly[0] {
+		t.Errorf("expected metric values unchanged, got %+v", unchanged)
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func sameWeather(a, b CurrentWeatherResponse) bool {
+	return approx(a.Temperature, b.Temperature) &&
+		approx(a.FeelsLike, b.FeelsLike) &&
+		approx(a.WindSpeed, b.WindSpeed) &&
+		approx(a.Pressure, b.Pressure) &&
+		approx(a.Visibility, b.Visibility) &&
+		a.Humidity == b.Humidity &&
+		a.UVIndex == b.UVIndex &&
+		a.CloudCover == b.CloudCover &&
+		a.Condition == b.Condition
+}
+
+func TestWeatherServiceForecastDaysPerProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		days     int
+		wantDays int
+	}{
+		{name: "within what the provider has", days: 2, wantDays: 2},
+		{name: "more than the provider has", days: 7, wantDays: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := &weatherService{
+				providers: []WeatherProvider{&stubWeatherProvider{name: "short", maxForecastDays: 3}},
+			}
+
+			forecast, err := ws.GetForecast(context.Background(), CityQuery("Kyiv"), tt.days)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(forecast.Daily) != tt.wantDays {
+				t.Errorf("expected %d days, got %d", tt.wantDays, len(forecast.Daily))
+			}
+		})
+	}
+}
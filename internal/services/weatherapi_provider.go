@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kievzenit/genesis-case/internal/config"
+	"github.com/kievzenit/genesis-case/internal/models"
+)
+
+const weatherApiProviderName = "weatherapi"
+
+const weatherApiBaseURL = "http://api.weatherapi.com/v1"
+
+type weatherApiProvider struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newWeatherApiProvider(
+	cfg *config.WeatherServiceConfig,
+	httpClient *http.Client,
+) (WeatherProvider, error) {
+	if cfg.ApiKey == "" {
+		return nil, fmt.Errorf("%s provider requires an api key", weatherApiProviderName)
+	}
+
+	return &weatherApiProvider{
+		apiKey:     cfg.ApiKey,
+		httpClient: httpClient,
+	}, nil
+}
+
+type currentWeatherApiResponse struct {
+	Current weatherApiResponse `json:"current"`
+}
+
+type weatherApiResponse struct {
+	TempCelsius      float64                            `json:"temp_c"`
+	FeelsLikeCelsius float64                            `json:"feelslike_c"`
+	Humidity         float64                            `json:"humidity"`
+	WindKph          float64                            `json:"wind_kph"`
+	WindDegree       float64                            `json:"wind_degree"`
+	WindDir          string                             `json:"wind_dir"`
+	PressureMb       float64                            `json:"pressure_mb"`
+	VisibilityKm     float64                            `json:"vis_km"`
+	UV               float64                            `json:"uv"`
+	Cloud            float64                            `json:"cloud"`
+	Condition        currentWeatherApiResponseCondition `json:"condition"`
+}
+
+type currentWeatherApiResponseCondition struct {
+	Text string `json:"text"`
+	Icon string `json:"icon"`
+	Code int    `json:"code"`
+}
+
+type forecastWeatherApiResponse struct {
+	Forecast weatherApiForecast `json:"forecast"`
+}
+
+type weatherApiForecast struct {
+	ForecastDays []weatherApiForecastDay `json:"forecastday"`
+}
+
+type weatherApiForecastDay struct {
+	Date  string                    `json:"date"`
+	Day   weatherApiForecastDayData `json:"day"`
+	Hours []weatherApiForecastHour  `json:"hour"`
+}
+
+type weatherApiForecastDayData struct {
+	MaxTempCelsius float64                            `json:"maxtemp_c"`
+	MinTempCelsius float64                            `json:"mintemp_c"`
+	MaxWindKph     float64                            `json:"maxwind_kph"`
+	ChanceOfRain   float64                            `json:"daily_chance_of_rain"`
+	ChanceOfSnow   float64                            `json:"daily_chance_of_snow"`
+	UV             float64                            `json:"uv"`
+	Condition      currentWeatherApiResponseCondition `json:"condition"`
+}
+
+type weatherApiForecastHour struct {
+	TimeEpoch    int64                              `json:"time_epoch"`
+	TempCelsius  float64                            `json:"temp_c"`
+	WindKph      float64                            `json:"wind_kph"`
+	ChanceOfRain float64                            `json:"chance_of_rain"`
+	ChanceOfSnow float64                            `json:"chance_of_snow"`
+	UV           float64                            `json:"uv"`
+	Condition    currentWeatherApiResponseCondition `json:"condition"`
+}
+
+type weatherApiSearchResult struct {
+	Name    string  `json:"name"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+type timezoneWeatherApiResponse struct {
+	Location weatherApiTimezoneLocation `json:"location"`
+}
+
+type weatherApiTimezoneLocation struct {
+	TzId string `json:"tz_id"`
+}
+
+type weatherApiErrorResponse struct {
+	Error weatherApiInnerErrorResponse `json:"error"`
+}
+
+type weatherApiInnerErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const cityNotFoundApiErrorCode = 1006
+
+func (p *weatherApiProvider) Name() string {
+	return weatherApiProviderName
+}
+
+// MaxForecastDays is what the free plan returns.
+func (p *weatherApiProvider) MaxForecastDays() int {
+	return 3
+}
+
+func (p *weatherApiProvider) GetCurrentWeather(
+	ctx context.Context,
+	locationQuery LocationQuery,
+) (CurrentWeatherResponse, error) {
+	query := url.Values{}
+	query.Set("q", locationQuery.String())
+
+	var apiResponse currentWeatherApiResponse
+	if err := p.get(ctx, "current.json", query, &apiResponse); err != nil {
+		return CurrentWeatherResponse{}, err
+	}
+
+	current := apiResponse.Current
+	return CurrentWeatherResponse{
+		Temperature:   current.TempCelsius,
+		FeelsLike:     current.FeelsLikeCelsius,
+		Humidity:      current.Humidity,
+		WindSpeed:     current.WindKph,
+		WindDegree:    current.WindDegree,
+		WindDirection: current.WindDir,
+		Pressure:      current.PressureMb,
+		Visibility:    current.VisibilityKm,
+		UVIndex:       current.UV,
+		HasUVIndex:    true,
+		CloudCover:    current.Cloud,
+		Condition:     current.Condition.Text,
+		ConditionCode: current.Condition.Code,
+		IconURL:       weatherApiIconURL(current.Condition.Icon),
+	}, nil
+}
+
+func (p *weatherApiProvider) GetForecast(
+	ctx context.Context,
+	locationQuery LocationQuery,
+	days int,
+) (ForecastResponse, error) {
+	query := url.Values{}
+	query.Set("q", locationQuery.String())
+	query.Set("days", strconv.Itoa(days))
+
+	var apiResponse forecastWeatherApiResponse
+	if err := p.get(ctx, "forecast.json", query, &apiResponse); err != nil {
+		return ForecastResponse{}, err
+	}
+
+	var forecast ForecastResponse
+	for _, forecastDay := range apiResponse.Forecast.ForecastDays {
+		date, err := time.Parse(time.DateOnly, forecastDay.Date)
+		if err != nil {
+			return ForecastResponse{}, fmt.Errorf("failed to parse forecast date: %w", err)
+		}
+
+		forecast.Daily = append(forecast.Daily, DailyForecast{
+			Date:                date,
+			MinTemperature:      forecastDay.Day.MinTempCelsius,
+			MaxTemperature:      forecastDay.Day.MaxTempCelsius,
+			PrecipitationChance: math.Max(forecastDay.Day.ChanceOfRain, forecastDay.Day.ChanceOfSnow),
+			MaxWindSpeed:        forecastDay.Day.MaxWindKph,
+			UVIndex:             forecastDay.Day.UV,
+			Condition:           forecastDay.Day.Condition.Text,
+		})
+
+		for _, hour := range forecastDay.Hours {
+			forecast.Hourly = append(forecast.Hourly, HourlyForecast{
+				Time:                time.Unix(hour.TimeEpoch, 0).UTC(),
+				Temperature:         hour.TempCelsius,
+				PrecipitationChance: math.Max(hour.ChanceOfRain, hour.ChanceOfSnow),
+				WindSpeed:           hour.WindKph,
+				UVIndex:             hour.UV,
+				Condition:           hour.Condition.Text,
+			})
+		}
+	}
+
+	return forecast, nil
+}
+
+func (p *weatherApiProvider) SearchLocations(ctx context.Context, text string) ([]models.Location, error) {
+	query := url.Values{}
+	query.Set("q", text)
+
+	var apiResponse []weatherApiSearchResult
+	if err := p.get(ctx, "search.json", query, &apiResponse); err != nil {
+		if errors.Is(err, ErrCityNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	locations := make([]models.Location, 0, len(apiResponse))
+	for _, result := range apiResponse {
+		locations = append(locations, models.Location{
+			Name:      result.Name,
+			Region:    result.Region,
+			Country:   result.Country,
+			Latitude:  result.Lat,
+			Longitude: result.Lon,
+		})
+	}
+	return locations, nil
+}
+
+func (p *weatherApiProvider) GetTimezone(ctx context.Context, locationQuery LocationQuery) (string, error) {
+	query := url.Values{}
+	query.Set("q", locationQuery.String())
+
+	var apiResponse timezoneWeatherApiResponse
+	if err := p.get(ctx, "timezone.json", query, &apiResponse); err != nil {
+		return "", err
+	}
+	return apiResponse.Location.TzId, nil
+}
+
+func (p *weatherApiProvider) get(ctx context.Context, endpoint string, query url.Values, out any) error {
+	query.Set("key", p.apiKey)
+
+	resp, err := doWeatherProviderRequest(
+		ctx,
+		p.httpClient,
+		weatherApiProviderName,
+		weatherApiBaseURL+"/"+endpoint+"?"+query.Encode(),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse weatherApiErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+			return fmt.Errorf("failed to decode error response: %w", err)
+		}
+
+		if errorResponse.Error.Code == cityNotFoundApiErrorCode {
+			return fmt.Errorf("location %s not found: %w", query.Get("q"), ErrCityNotFound)
+		}
+
+		return fmt.Errorf("weather API error: %s", errorResponse.Error.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode weather response: %w", err)
+	}
+
+	return nil
+}
+
+// weatherApiIconURL makes the protocol relative icon urls returned by
+// WeatherAPI usable in emails.
+func weatherApiIconURL(icon string) string {
+	if strings.HasPrefix(icon, "//") {
+		return "https:" + icon
+	}
+	return icon
+}
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions DROP COLUMN units_id;
+
+DROP TABLE IF EXISTS units CASCADE;
+
+COMMIT;
\ No newline at end of file
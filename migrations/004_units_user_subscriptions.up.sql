@@ -0,0 +1,14 @@
+BEGIN;
+
+CREATE TABLE units (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE
+);
+
+INSERT INTO units (id, name) VALUES
+    (1, 'metric'),
+    (2, 'imperial');
+
+ALTER TABLE user_subscriptions ADD COLUMN units_id INT NOT NULL DEFAULT 1 REFERENCES units(id);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    DROP COLUMN region,
+    DROP COLUMN country,
+    DROP COLUMN latitude,
+    DROP COLUMN longitude;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN region VARCHAR(100),
+    ADD COLUMN country VARCHAR(100),
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION;
+
+COMMIT;
\ No newline at end of file
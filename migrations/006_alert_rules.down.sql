@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP TABLE IF EXISTS subscription_alert_rules;
+
+ALTER TABLE user_subscriptions DROP COLUMN last_alert_sent_at;
+
+DELETE FROM user_subscriptions WHERE frequency_id = (SELECT id FROM frequencies WHERE name = 'alert');
+
+DELETE FROM frequencies WHERE name = 'alert';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,17 @@
+BEGIN;
+
+INSERT INTO frequencies (name) VALUES ('alert');
+
+ALTER TABLE user_subscriptions ADD COLUMN last_alert_sent_at TIMESTAMP WITHOUT TIME ZONE;
+
+CREATE TABLE subscription_alert_rules (
+    id SERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES user_subscriptions(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL CHECK (metric IN ('temperature', 'precipitation', 'wind_speed', 'uv_index')),
+    operator VARCHAR(10) NOT NULL CHECK (operator IN ('above', 'below')),
+    threshold DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX idx_subscription_alert_rules_subscription_id ON subscription_alert_rules(subscription_id);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,15 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_user_subscriptions_next_report_at;
+
+ALTER TABLE user_subscriptions
+    DROP COLUMN delivery_time,
+    DROP COLUMN delivery_weekday,
+    DROP COLUMN cron_expression,
+    DROP COLUMN next_report_at;
+
+DELETE FROM user_subscriptions WHERE frequency_id IN (SELECT id FROM frequencies WHERE name IN ('weekly', 'custom'));
+
+DELETE FROM frequencies WHERE name IN ('weekly', 'custom');
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,30 @@
+BEGIN;
+
+INSERT INTO frequencies (name) VALUES
+    ('weekly'),
+    ('custom');
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN delivery_time TIME,
+    ADD COLUMN delivery_weekday SMALLINT CHECK (delivery_weekday BETWEEN 0 AND 6),
+    ADD COLUMN cron_expression VARCHAR(100),
+    ADD COLUMN next_report_at TIMESTAMP WITHOUT TIME ZONE;
+
+-- Existing subscriptions keep their previous schedule,
+-- hourly reports at the top of the hour and daily ones at noon.
+UPDATE user_subscriptions
+SET next_report_at = date_trunc('hour', NOW() AT TIME ZONE 'UTC') + INTERVAL '1 hour'
+WHERE frequency_id = (SELECT id FROM frequencies WHERE name = 'hourly');
+
+UPDATE user_subscriptions
+SET delivery_time = '12:00',
+    next_report_at = CASE
+        WHEN NOW() AT TIME ZONE 'UTC' < date_trunc('day', NOW() AT TIME ZONE 'UTC') + INTERVAL '12 hours'
+            THEN date_trunc('day', NOW() AT TIME ZONE 'UTC') + INTERVAL '12 hours'
+        ELSE date_trunc('day', NOW() AT TIME ZONE 'UTC') + INTERVAL '36 hours'
+    END
+WHERE frequency_id = (SELECT id FROM frequencies WHERE name = 'daily');
+
+CREATE INDEX idx_user_subscriptions_next_report_at ON user_subscriptions(next_report_at);
+
+COMMIT;
\ No newline at end of file
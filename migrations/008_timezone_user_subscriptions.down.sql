@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions DROP COLUMN timezone;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Reports were scheduled in the server's timezone before, which is UTC in the Docker image.
+ALTER TABLE user_subscriptions ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    DROP CONSTRAINT quiet_hours_complete,
+    DROP COLUMN quiet_hours_start,
+    DROP COLUMN quiet_hours_end,
+    DROP COLUMN overnight_summary;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN quiet_hours_start TIME,
+    ADD COLUMN quiet_hours_end TIME,
+    ADD COLUMN overnight_summary BOOLEAN NOT NULL DEFAULT false,
+    ADD CONSTRAINT quiet_hours_complete CHECK ((quiet_hours_start IS NULL) = (quiet_hours_end IS NULL));
+
+COMMIT;
\ No newline at end of file
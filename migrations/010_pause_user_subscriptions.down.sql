@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_user_subscriptions_resume_at;
+
+ALTER TABLE user_subscriptions
+    DROP COLUMN paused,
+    DROP COLUMN resume_at;
+
+COMMIT;
\ No newline at end of file
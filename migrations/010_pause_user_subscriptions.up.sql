@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN paused BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN resume_at TIMESTAMP WITHOUT TIME ZONE;
+
+CREATE INDEX idx_user_subscriptions_resume_at ON user_subscriptions(resume_at) WHERE paused;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,18 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions
+    ADD COLUMN email VARCHAR(320),
+    ADD COLUMN confirmed BOOLEAN DEFAULT FALSE;
+
+UPDATE user_subscriptions s
+SET email = sb.email, confirmed = sb.confirmed
+FROM subscribers sb
+WHERE sb.id = s.subscriber_id;
+
+ALTER TABLE user_subscriptions ALTER COLUMN email SET NOT NULL;
+
+ALTER TABLE user_subscriptions DROP COLUMN subscriber_id;
+
+DROP TABLE subscribers;
+
+COMMIT;
\ No newline at end of file
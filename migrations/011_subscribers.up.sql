@@ -0,0 +1,51 @@
+BEGIN;
+
+CREATE TABLE subscribers (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(320) NOT NULL UNIQUE,
+    token UUID NOT NULL UNIQUE,
+    confirmed BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Every address keeps the token of its first subscription. Confirmation links
+-- sent for its other subscriptions are matched by the token of the subscription,
+-- which is kept in user_subscriptions. An address is confirmed when any of its
+-- subscriptions was.
+INSERT INTO subscribers (email, token, confirmed)
+SELECT DISTINCT ON (LOWER(email))
+    LOWER(email),
+    token,
+    BOOL_OR(COALESCE(confirmed, FALSE)) OVER (PARTITION BY LOWER(email))
+FROM user_subscriptions
+ORDER BY LOWER(email), id;
+
+ALTER TABLE user_subscriptions ADD COLUMN subscriber_id INT REFERENCES subscribers(id) ON DELETE CASCADE;
+
+UPDATE user_subscriptions s
+SET subscriber_id = sb.id
+FROM subscribers sb
+WHERE sb.email = LOWER(s.email);
+
+ALTER TABLE user_subscriptions ALTER COLUMN subscriber_id SET NOT NULL;
+
+CREATE INDEX idx_user_subscriptions_subscriber_id ON user_subscriptions(subscriber_id);
+
+UPDATE pending_confirmation_emails p
+SET token = sb.token
+FROM user_subscriptions s
+JOIN subscribers sb ON sb.id = s.subscriber_id
+WHERE s.token = p.token;
+
+-- One pending confirmation per address is enough.
+DELETE FROM pending_confirmation_emails p
+USING pending_confirmation_emails other
+WHERE p.token = other.token
+    AND p.completed = FALSE
+    AND other.completed = FALSE
+    AND p.id > other.id;
+
+ALTER TABLE user_subscriptions
+    DROP COLUMN email,
+    DROP COLUMN confirmed;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE login_links;
+
+COMMIT;
\ No newline at end of file
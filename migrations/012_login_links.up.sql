@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Login links are stored without their tokens, the tokens are signed
+-- and only the id and expiry they carry are looked up here. The delivery
+-- columns work like the ones of pending_confirmation_emails.
+CREATE TABLE login_links (
+    id SERIAL PRIMARY KEY,
+    subscriber_id INT NOT NULL REFERENCES subscribers(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITHOUT TIME ZONE,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_try_after TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_login_links_subscriber_id_created_at ON login_links(subscriber_id, created_at);
+
+COMMIT;
\ No newline at end of file
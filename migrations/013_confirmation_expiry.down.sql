@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE subscribers DROP COLUMN confirmation_expires_at;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,12 @@
+BEGIN;
+
+ALTER TABLE subscribers ADD COLUMN confirmation_expires_at TIMESTAMP WITHOUT TIME ZONE;
+
+-- Addresses waiting for confirmation get the default period from now on.
+UPDATE subscribers
+SET confirmation_expires_at = (NOW() AT TIME ZONE 'UTC') + INTERVAL '48 hours'
+WHERE confirmed = FALSE;
+
+CREATE INDEX idx_subscribers_confirmation_expires_at ON subscribers(confirmation_expires_at) WHERE NOT confirmed;
+
+COMMIT;
\ No newline at end of file
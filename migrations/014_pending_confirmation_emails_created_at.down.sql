@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE pending_confirmation_emails DROP COLUMN created_at;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE pending_confirmation_emails
+    ADD COLUMN created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC');
+
+CREATE INDEX idx_pending_confirmation_emails_to_address_created_at
+    ON pending_confirmation_emails(to_address, created_at);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,8 @@
+BEGIN;
+
+UPDATE user_subscriptions SET legacy_token = gen_random_uuid() WHERE legacy_token IS NULL;
+
+ALTER TABLE user_subscriptions ALTER COLUMN legacy_token SET NOT NULL;
+ALTER TABLE user_subscriptions RENAME COLUMN legacy_token TO token;
+
+COMMIT;
\ No newline at end of file
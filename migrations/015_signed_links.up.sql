@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Emails link to signed, purpose scoped tokens now. The old tokens are kept
+-- only so that unsubscribe links of emails sent before keep working.
+ALTER TABLE user_subscriptions RENAME COLUMN token TO legacy_token;
+ALTER TABLE user_subscriptions ALTER COLUMN legacy_token DROP NOT NULL;
+
+COMMIT;
\ No newline at end of file
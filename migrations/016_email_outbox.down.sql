@@ -0,0 +1,38 @@
+BEGIN;
+
+ALTER TABLE login_links
+    ADD COLUMN completed BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN next_try_after TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC');
+
+UPDATE login_links l SET completed = false, attempts = e.attempts, next_try_after = e.next_try_after
+FROM email_outbox e
+WHERE e.type = 'login' AND e.status = 'pending' AND (e.payload->>'login_link_id')::INT = l.id;
+
+ALTER TABLE login_links ALTER COLUMN completed SET DEFAULT FALSE, ALTER COLUMN next_try_after DROP DEFAULT;
+
+DELETE FROM email_outbox WHERE type <> 'confirmation';
+
+DROP INDEX idx_email_outbox_confirmation_token;
+DROP INDEX idx_email_outbox_status_next_try_after;
+
+ALTER TABLE email_outbox
+    ADD COLUMN token UUID,
+    ADD COLUMN completed BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE email_outbox SET
+    token = (payload->>'token')::UUID,
+    completed = status IN ('sent', 'cancelled');
+
+ALTER TABLE email_outbox ALTER COLUMN token SET NOT NULL;
+ALTER TABLE email_outbox
+    DROP COLUMN type,
+    DROP COLUMN payload,
+    DROP COLUMN status,
+    DROP COLUMN last_error,
+    DROP COLUMN sent_at;
+
+ALTER INDEX idx_email_outbox_to_address_created_at RENAME TO idx_pending_confirmation_emails_to_address_created_at;
+ALTER TABLE email_outbox RENAME TO pending_confirmation_emails;
+
+COMMIT;
\ No newline at end of file
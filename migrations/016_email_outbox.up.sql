@@ -0,0 +1,38 @@
+BEGIN;
+
+-- Every outgoing email goes through the outbox. The payload holds what the
+-- template of the email type needs, or the ids of the rows it is rendered from.
+ALTER TABLE pending_confirmation_emails RENAME TO email_outbox;
+ALTER INDEX idx_pending_confirmation_emails_to_address_created_at RENAME TO idx_email_outbox_to_address_created_at;
+
+ALTER TABLE email_outbox
+    ADD COLUMN type VARCHAR(32) NOT NULL DEFAULT 'confirmation',
+    ADD COLUMN payload JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN sent_at TIMESTAMP WITHOUT TIME ZONE;
+
+UPDATE email_outbox SET
+    payload = jsonb_build_object('token', token),
+    status = CASE
+        WHEN completed THEN 'sent'
+        WHEN attempts >= 3 THEN 'failed'
+        ELSE 'pending'
+    END;
+
+ALTER TABLE email_outbox ALTER COLUMN type DROP DEFAULT;
+ALTER TABLE email_outbox DROP COLUMN token, DROP COLUMN completed;
+
+CREATE INDEX idx_email_outbox_status_next_try_after ON email_outbox(status, next_try_after);
+CREATE INDEX idx_email_outbox_confirmation_token ON email_outbox((payload->>'token')) WHERE type = 'confirmation';
+
+-- Login links are delivered through the outbox as well.
+INSERT INTO email_outbox (type, to_address, payload, status, attempts, next_try_after, created_at)
+SELECT 'login', sb.email, jsonb_build_object('login_link_id', l.id), 'pending', l.attempts, l.next_try_after, l.created_at
+FROM login_links l
+JOIN subscribers sb ON sb.id = l.subscriber_id
+WHERE l.completed = false AND l.attempts < 3 AND l.expires_at > NOW() AT TIME ZONE 'UTC';
+
+ALTER TABLE login_links DROP COLUMN completed, DROP COLUMN attempts, DROP COLUMN next_try_after;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE user_subscriptions DROP COLUMN legacy_token_expires_at;
+
+COMMIT;
\ No newline at end of file
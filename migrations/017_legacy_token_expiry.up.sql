@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Unsubscribe and confirmation links from before links were signed are
+-- accepted for a grace period only, later emails carry signed links.
+ALTER TABLE user_subscriptions ADD COLUMN legacy_token_expires_at TIMESTAMP WITHOUT TIME ZONE;
+
+UPDATE user_subscriptions
+SET legacy_token_expires_at = (NOW() AT TIME ZONE 'UTC') + INTERVAL '30 days'
+WHERE legacy_token IS NOT NULL;
+
+COMMIT;
\ No newline at end of file
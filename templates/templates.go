@@ -0,0 +1,8 @@
+// Package templates embeds the default email and page templates,
+// so the binary does not depend on the directory it is run from.
+package templates
+
+import "embed"
+
+//go:embed email pages
+var FS embed.FS